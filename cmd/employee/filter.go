@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// RowFilterSource provides the condition on the employee rows a user may read
+type RowFilterSource interface {
+	RowFilter(ctx context.Context, userID string) (*model.RowFilter, error)
+}
+
+// employeeColumns maps the employee fields the row policy may refer to onto the columns of getAllEmployees
+var employeeColumns = map[string]string{
+	"id":                 "e.id",
+	"name":               "e.name",
+	"email":              "e.email",
+	"department_id":      "e.department_id",
+	"department_name":    "d.name",
+	"employment_type_id": "e.employment_type_id",
+	"employment_type":    "et.name",
+	"position":           "e.position",
+	"joined_at":          "e.joined_at",
+}
+
+// PDPRowFilterSource requests row filters compiled from the row policy from the PDP
+type PDPRowFilterSource struct {
+	pdpHost string
+	client  *http.Client
+}
+
+// NewPDPRowFilterSource creates a PDPRowFilterSource for the PDP at pdpHost
+func NewPDPRowFilterSource(pdpHost string) *PDPRowFilterSource {
+	return &PDPRowFilterSource{
+		pdpHost: pdpHost,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// RowFilter returns the filter on the employees the user may view
+func (s *PDPRowFilterSource) RowFilter(ctx context.Context, userID string) (*model.RowFilter, error) {
+	body, err := json.Marshal(model.RowFilterRequest{
+		EvaluationRequest: model.EvaluationRequest{
+			UserID:       userID,
+			ResourceType: "employees",
+			Action:       "view",
+		},
+		Columns: employeeColumns,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal row filter request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.pdpHost+"/filters", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create row filter request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request row filter: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("row filter request failed with status %d", resp.StatusCode)
+	}
+
+	var filter model.RowFilter
+	if err := json.NewDecoder(resp.Body).Decode(&filter); err != nil {
+		return nil, fmt.Errorf("failed to decode row filter: %w", err)
+	}
+	return &filter, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// stubRowFilterSource returns a fixed row filter
+type stubRowFilterSource struct {
+	filter *model.RowFilter
+	err    error
+}
+
+func (s *stubRowFilterSource) RowFilter(ctx context.Context, userID string) (*model.RowFilter, error) {
+	return s.filter, s.err
+}
+
+func TestHandleListEmployees_rowFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     string
+		source     *stubRowFilterSource
+		wantStatus int
+		wantWhere  string
+		wantArgs   []interface{}
+	}{
+		{
+			name:       "Filtered_rows",
+			userID:     "44444444-4444-4444-4444-444444444444",
+			source:     &stubRowFilterSource{filter: &model.RowFilter{SQL: "e.id = $1", Args: []interface{}{"44444444-4444-4444-4444-444444444444"}}},
+			wantStatus: http.StatusOK,
+			wantWhere:  "WHERE e.id = $1",
+			wantArgs:   []interface{}{"44444444-4444-4444-4444-444444444444"},
+		},
+		{
+			name:       "Missing_user",
+			source:     &stubRowFilterSource{filter: &model.RowFilter{SQL: "TRUE"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "PDP_error",
+			userID:     "44444444-4444-4444-4444-444444444444",
+			source:     &stubRowFilterSource{err: errors.New("connection refused")},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSQL string
+			var gotArgs []interface{}
+			handler := NewEmployeeHandler(&mockDB{
+				queryFunc: func(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+					gotSQL, gotArgs = sql, args
+					return &mockRows{}, nil
+				},
+			})
+			handler.SetRowFilterSource(tt.source)
+
+			req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+			if tt.userID != "" {
+				req.Header.Set("X-User-ID", tt.userID)
+			}
+			rec := httptest.NewRecorder()
+			handler.HandleListEmployees(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("HandleListEmployees() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !strings.Contains(gotSQL, tt.wantWhere) {
+				t.Errorf("query = %s, want it to contain %q", gotSQL, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("query args = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestPDPRowFilterSource_RowFilter(t *testing.T) {
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/filters" {
+			http.NotFound(w, r)
+			return
+		}
+		var req model.RowFilterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.UserID != "44444444-4444-4444-4444-444444444444" || req.ResourceType != "employees" ||
+			req.Action != "view" || req.Columns["id"] != "e.id" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(model.RowFilter{SQL: "e.id = $1", Args: []interface{}{req.UserID}})
+	}))
+	defer pdp.Close()
+
+	source := NewPDPRowFilterSource(pdp.URL)
+	filter, err := source.RowFilter(context.Background(), "44444444-4444-4444-4444-444444444444")
+	if err != nil {
+		t.Fatalf("RowFilter() error = %v", err)
+	}
+	if filter.SQL != "e.id = $1" || len(filter.Args) != 1 {
+		t.Errorf("RowFilter() = %+v, want the PDP's filter", filter)
+	}
+
+	if _, err := source.RowFilter(context.Background(), "unknown"); err == nil {
+		t.Errorf("RowFilter() for a rejected request error = nil, want error")
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
 	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
 )
 
@@ -31,7 +33,8 @@ type DB interface {
 }
 
 type EmployeeHandler struct {
-	db DB
+	db         DB
+	rowFilters RowFilterSource
 }
 
 func NewEmployeeHandler(db DB) *EmployeeHandler {
@@ -40,6 +43,11 @@ func NewEmployeeHandler(db DB) *EmployeeHandler {
 	}
 }
 
+// SetRowFilterSource enables reading only the rows the requesting user may view
+func (h *EmployeeHandler) SetRowFilterSource(source RowFilterSource) {
+	h.rowFilters = source
+}
+
 func main() {
 	log.Printf("Starting Employee service on :8083")
 
@@ -68,6 +76,10 @@ func main() {
 
 	// Initialize handler
 	employeeHandler := NewEmployeeHandler(db)
+	if pdpHost := os.Getenv("PDP_HOST"); pdpHost != "" {
+		employeeHandler.SetRowFilterSource(NewPDPRowFilterSource(pdpHost))
+		log.Printf("Reading only permitted rows with row filters from %s", pdpHost)
+	}
 
 	// Set up routing
 	mux := http.NewServeMux()
@@ -89,8 +101,28 @@ func main() {
 	log.Fatal(server.ListenAndServe())
 }
 
+// HandleListEmployees lists the employees. The service trusts X-User-ID and returns every field,
+// so it must only be reachable through the PEP, which authenticates the user, checks the view
+// decision and filters the fields of the response.
 func (h *EmployeeHandler) HandleListEmployees(w http.ResponseWriter, r *http.Request) {
-	employees, err := h.getAllEmployees(r.Context())
+	var filter *model.RowFilter
+	if h.rowFilters != nil {
+		userID := r.Header.Get("X-User-ID")
+		if userID == "" {
+			http.Error(w, "Missing X-User-ID header", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		filter, err = h.rowFilters.RowFilter(r.Context(), userID)
+		if err != nil {
+			log.Printf("Failed to get row filter: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	employees, err := h.getAllEmployees(r.Context(), filter)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -104,7 +136,15 @@ func (h *EmployeeHandler) HandleListEmployees(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(response)
 }
 
-func (h *EmployeeHandler) getAllEmployees(ctx context.Context) ([]Employee, error) {
+// getAllEmployees reads the employees, only those matching the row filter if one is given
+func (h *EmployeeHandler) getAllEmployees(ctx context.Context, filter *model.RowFilter) ([]Employee, error) {
+	where := ""
+	var args []interface{}
+	if filter != nil {
+		where = "WHERE " + filter.SQL
+		args = filter.Args
+	}
+
 	query := `
     SELECT
         e.id,
@@ -119,10 +159,11 @@ func (h *EmployeeHandler) getAllEmployees(ctx context.Context) ([]Employee, erro
     FROM employees e
     JOIN departments d ON e.department_id = d.id
     JOIN employment_types et ON e.employment_type_id = et.id
+    ` + where + `
     ORDER BY e.name
 `
 
-	rows, err := h.db.Query(ctx, query)
+	rows, err := h.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// getTestResourceGrantees returns the holders of permissions on the employees resource,
+// including a user whose roles no longer grant the permission
+func getTestResourceGrantees(ctx context.Context, resourceID string) ([]model.ResourceGrantee, error) {
+	if resourceID != testEmployeesRes {
+		return nil, nil
+	}
+	return []model.ResourceGrantee{
+		{UserID: testManagerUser, UserName: "Alice", Role: testManagerRole, RoleName: "manager", Action: "break_glass"},
+		{UserID: testManagerUser, UserName: "Alice", Role: testManagerRole, RoleName: "manager", Action: "view"},
+		{UserID: testEmployeeUser, UserName: "Dave", Role: testEmployeeRole, RoleName: "employee", Action: "view"},
+		{UserID: "55555555-5555-5555-5555-555555555555", UserName: "Eve", Role: testEmployeeRole, RoleName: "employee", Action: "view"},
+	}, nil
+}
+
+func TestPDPHandler_HandleResourceAccess(t *testing.T) {
+	tests := []struct {
+		name         string
+		resourceType string
+		query        string
+		caller       string
+		wantStatus   int
+		wantEntries  []string
+	}{
+		{
+			name:         "All_actions",
+			resourceType: "employees",
+			caller:       testAdminUser,
+			wantStatus:   http.StatusOK,
+			wantEntries:  []string{"Alice:break_glass", "Alice:view", "Dave:view"},
+		},
+		{
+			name:         "One_action",
+			resourceType: "employees",
+			query:        "?action=view",
+			caller:       testAdminUser,
+			wantStatus:   http.StatusOK,
+			wantEntries:  []string{"Alice:view", "Dave:view"},
+		},
+		{
+			name:         "No_grantees",
+			resourceType: "departments",
+			caller:       testAdminUser,
+			wantStatus:   http.StatusOK,
+			wantEntries:  []string{},
+		},
+		{
+			name:         "Unknown_resource",
+			resourceType: "payroll",
+			caller:       testAdminUser,
+			wantStatus:   http.StatusNotFound,
+		},
+		{
+			name:         "Invalid_format",
+			resourceType: "employees",
+			query:        "?format=xml",
+			caller:       testAdminUser,
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "Not_admin",
+			resourceType: "employees",
+			caller:       testManagerUser,
+			wantStatus:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := newBreakGlassMockRepo()
+			mockRepo.GetResourceGranteesFunc = getTestResourceGrantees
+			handler := NewPDPHandler(mockRepo)
+			handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+
+			req := httptest.NewRequest(http.MethodGet, "/resources/"+tt.resourceType+"/access"+tt.query, nil)
+			setCallerToken(req, tt.caller)
+			rec := httptest.NewRecorder()
+			handler.HandleResourceAccess(rec, req, tt.resourceType)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("HandleResourceAccess() status = %v, want %v, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var report model.ResourceAccessReport
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatalf("Failed to decode access report: %v", err)
+			}
+			entries := []string{}
+			for _, access := range report.Access {
+				entries = append(entries, access.UserName+":"+access.Action)
+				if access.Action == "view" && len(access.AllowedFields) == 0 {
+					t.Errorf("%s view fields = %v, want the fields the user sees", access.UserName, access.AllowedFields)
+				}
+			}
+			if !reflect.DeepEqual(entries, tt.wantEntries) {
+				t.Errorf("access = %v, want %v", entries, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_HandleResourceAccess_csv(t *testing.T) {
+	mockRepo := newBreakGlassMockRepo()
+	mockRepo.GetResourceGranteesFunc = getTestResourceGrantees
+	handler := NewPDPHandler(mockRepo)
+	handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+
+	rec := httptest.NewRecorder()
+	handler.HandleResourceAccess(rec, adminRequest(http.MethodGet, "/resources/employees/access?action=view&format=csv", nil), "employees")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HandleResourceAccess() status = %v, want %v", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv" {
+		t.Errorf("Content-Type = %q, want text/csv", got)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("CSV rows = %d, want a header and 2 rows: %v", len(records), records)
+	}
+	if want := []string{"user_id", "user_name", "action", "purpose", "roles", "role_names", "allowed_fields"}; !reflect.DeepEqual(records[0], want) {
+		t.Errorf("CSV header = %v, want %v", records[0], want)
+	}
+	if records[2][1] != "Dave" || records[2][3] != "" || records[2][5] != "employee" || records[2][6] == "" {
+		t.Errorf("CSV row = %v, want Dave's view access through the employee role", records[2])
+	}
+}
+
+func TestPDPHandler_HandleResourceAccess_purposes(t *testing.T) {
+	mockRepo := newBreakGlassMockRepo()
+	mockRepo.GetResourceGranteesFunc = getTestResourceGrantees
+	mockRepo.GetPurposeFieldsFunc = getTestPurposeFields
+	mockRepo.GetRolePurposesFunc = func(ctx context.Context, userID string) ([]model.RolePurpose, error) {
+		if userID != testManagerUser {
+			return nil, nil
+		}
+		return []model.RolePurpose{
+			{Role: testManagerRole, ResourceID: testEmployeesRes, Purpose: "performance_review"},
+			{Role: testManagerRole, ResourceID: testEmployeesRes, Purpose: "payroll"},
+		}, nil
+	}
+	handler := NewPDPHandler(mockRepo)
+	handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+
+	rec := httptest.NewRecorder()
+	handler.HandleResourceAccess(rec, adminRequest(http.MethodGet, "/resources/employees/access?action=view", nil), "employees")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HandleResourceAccess() status = %v, want %v", rec.Code, http.StatusOK)
+	}
+
+	var report model.ResourceAccessReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode access report: %v", err)
+	}
+	want := []model.ResourceAccess{
+		{
+			UserID:        testManagerUser,
+			UserName:      "Alice",
+			Action:        "view",
+			Roles:         []string{testManagerRole},
+			RoleNames:     []string{"manager"},
+			AllowedFields: []string{"id", "name", "joined_at"},
+			PurposeFields: map[string][]string{
+				"payroll":            {"id", "name", "email", "employment_type_id", "employment_type", "joined_at"},
+				"performance_review": {"id", "name", "department_id", "department_name", "position", "joined_at"},
+			},
+		},
+		{
+			UserID:        testEmployeeUser,
+			UserName:      "Dave",
+			Action:        "view",
+			Roles:         []string{testEmployeeRole},
+			RoleNames:     []string{"employee"},
+			AllowedFields: []string{"id", "name", "department_name", "employment_type"},
+		},
+	}
+	if !reflect.DeepEqual(report.Access, want) {
+		t.Errorf("access = %+v, want %+v", report.Access, want)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// adminResourceType is the resource the manage permission for admin endpoints is granted on
+const adminResourceType = "admin"
+
+// requireAdmin checks that the authenticated caller may use administrative endpoints.
+// It writes an error response and returns false otherwise.
+func (h *PDPHandler) requireAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, ok := h.authenticateCaller(w, r)
+	if !ok {
+		return "", false
+	}
+	return h.authorizeAdmin(w, r, userID)
+}
+
+// authorizeAdmin checks that the authenticated caller may use administrative endpoints.
+// It writes an error response and returns false otherwise.
+func (h *PDPHandler) authorizeAdmin(w http.ResponseWriter, r *http.Request, userID string) (string, bool) {
+	ctx := r.Context()
+
+	// The caller's roles come from the same source as those of enforced decisions
+	_, grants, err := h.grantsForUser(ctx, userID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get roles for admin check: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+
+	resourceID, err := h.repository(ctx).GetResourceIDByType(ctx, adminResourceType)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get admin resource ID: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+
+	input := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id": userID,
+		},
+		"resource": map[string]interface{}{
+			"id":   resourceID,
+			"name": adminResourceType,
+		},
+		"role_permissions": rolePermissionsInput(grants.permissions),
+	}
+
+	allowed, err := evalAllow(ctx, h.policy(ctx).opaAdmin, input)
+	if err != nil {
+		log.Printf("[ERROR] Admin policy evaluation error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+	if !allowed {
+		log.Printf("[AUDIT] Admin access denied: user=%s, %s %s", userID, r.Method, r.URL.Path)
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return "", false
+	}
+
+	return userID, true
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// Routes of the OpenID AuthZEN Authorization API
+const (
+	authZENEvaluationPath    = "/access/v1/evaluation"
+	authZENEvaluationsPath   = "/access/v1/evaluations"
+	authZENConfigurationPath = "/.well-known/authzen-configuration"
+)
+
+// Evaluation semantics of an Access Evaluations API request
+const (
+	// executeAll evaluates every request
+	executeAll = "execute_all"
+	// denyOnFirstDeny stops at the first denied request
+	denyOnFirstDeny = "deny_on_first_deny"
+	// permitOnFirstPermit stops at the first permitted request
+	permitOnFirstPermit = "permit_on_first_permit"
+)
+
+// HandleAuthZENEvaluation handles Access Evaluation API requests.
+// Denied requests are a decision, not an error, so they are answered with 200 OK.
+func (h *PDPHandler) HandleAuthZENEvaluation(w http.ResponseWriter, r *http.Request) {
+	echoRequestID(w, r)
+
+	var req model.AuthZENEvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] Error decoding AuthZEN request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	evalReq, err := fromAuthZEN(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.evaluate(r.Context(), evalReq)
+	if err != nil {
+		log.Printf("[ERROR] AuthZEN evaluation error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] AuthZEN Decision: decision=%v, subject=%s, resourceType=%s, action=%s, policyRevision=%s",
+		response.Allow, evalReq.UserID, evalReq.ResourceType, evalReq.Action, response.PolicyRevision)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toAuthZEN(response))
+}
+
+// HandleAuthZENEvaluations handles Access Evaluations API requests. The top-level subject,
+// resource, action and context are defaults for each evaluation; without evaluations the
+// request is a single Access Evaluation.
+func (h *PDPHandler) HandleAuthZENEvaluations(w http.ResponseWriter, r *http.Request) {
+	echoRequestID(w, r)
+
+	var batch model.AuthZENEvaluationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		log.Printf("[ERROR] Error decoding AuthZEN request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(batch.Evaluations) == 0 {
+		batch.Evaluations = []model.AuthZENEvaluationRequest{{}}
+	}
+	if len(batch.Evaluations) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("Batch exceeds %d evaluations", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	semantic := batch.Options.EvaluationsSemantic
+	switch semantic {
+	case "":
+		semantic = executeAll
+	case executeAll, denyOnFirstDeny, permitOnFirstPermit:
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported evaluations_semantic %q", semantic), http.StatusBadRequest)
+		return
+	}
+
+	ctx := h.batchContext(r.Context())
+	results := make([]model.AuthZENEvaluationResponse, 0, len(batch.Evaluations))
+	if semantic == executeAll {
+		// Requests that cannot be mapped are answered with an error, the others are evaluated together
+		reqs := make([]model.EvaluationRequest, len(batch.Evaluations))
+		mapErrs := make([]error, len(batch.Evaluations))
+		for i, item := range batch.Evaluations {
+			reqs[i], mapErrs[i] = fromAuthZEN(withAuthZENDefaults(item, batch.AuthZENEvaluationRequest))
+		}
+		for i, result := range h.evaluateBatch(ctx, reqs, model.EvaluationRequest{}) {
+			switch {
+			case mapErrs[i] != nil:
+				results = append(results, authZENError(http.StatusBadRequest, mapErrs[i]))
+			case result.Decision == nil:
+				results = append(results, authZENError(http.StatusInternalServerError, errors.New(result.Error)))
+			default:
+				results = append(results, toAuthZEN(*result.Decision))
+			}
+		}
+	} else {
+		// Short-circuiting semantics evaluate in order and stop at the deciding evaluation
+		for _, item := range batch.Evaluations {
+			req, err := fromAuthZEN(withAuthZENDefaults(item, batch.AuthZENEvaluationRequest))
+			if err != nil {
+				results = append(results, authZENError(http.StatusBadRequest, err))
+				continue
+			}
+			response, err := h.evaluate(ctx, req)
+			if err != nil {
+				log.Printf("[ERROR] AuthZEN evaluation error: %v", err)
+				results = append(results, authZENError(http.StatusInternalServerError, err))
+				continue
+			}
+			results = append(results, toAuthZEN(response))
+			if (semantic == denyOnFirstDeny && !response.Allow) || (semantic == permitOnFirstPermit && response.Allow) {
+				break
+			}
+		}
+	}
+
+	log.Printf("[INFO] AuthZEN Batch Decision: requested=%d, evaluated=%d, semantic=%s",
+		len(batch.Evaluations), len(results), semantic)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.AuthZENEvaluationsResponse{Evaluations: results})
+}
+
+// HandleAuthZENConfiguration publishes the PDP metadata for AuthZEN clients
+func (h *PDPHandler) HandleAuthZENConfiguration(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := scheme + "://" + r.Host
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.AuthZENConfiguration{
+		PolicyDecisionPoint:       baseURL,
+		AccessEvaluationEndpoint:  baseURL + authZENEvaluationPath,
+		AccessEvaluationsEndpoint: baseURL + authZENEvaluationsPath,
+	})
+}
+
+// echoRequestID returns the caller's X-Request-ID as AuthZEN requires
+func echoRequestID(w http.ResponseWriter, r *http.Request) {
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		w.Header().Set("X-Request-ID", id)
+	}
+}
+
+// withAuthZENDefaults fills the subject, resource, action and context an evaluation leaves out from the defaults
+func withAuthZENDefaults(req, defaults model.AuthZENEvaluationRequest) model.AuthZENEvaluationRequest {
+	if req.Subject == nil {
+		req.Subject = defaults.Subject
+	}
+	if req.Resource == nil {
+		req.Resource = defaults.Resource
+	}
+	if req.Action == nil {
+		req.Action = defaults.Action
+	}
+	if req.Context == nil {
+		req.Context = defaults.Context
+	}
+	return req
+}
+
+// fromAuthZEN maps an AuthZEN request to the internal evaluation request.
+// The context may carry the purpose of use, the user to act as, the data to filter and the environment.
+func fromAuthZEN(req model.AuthZENEvaluationRequest) (model.EvaluationRequest, error) {
+	if req.Subject == nil || req.Subject.ID == "" {
+		return model.EvaluationRequest{}, errors.New("subject.id is required")
+	}
+	if req.Resource == nil || req.Resource.Type == "" {
+		return model.EvaluationRequest{}, errors.New("resource.type is required")
+	}
+	if req.Action == nil || req.Action.Name == "" {
+		return model.EvaluationRequest{}, errors.New("action.name is required")
+	}
+
+	evalReq := model.EvaluationRequest{
+		UserID:       req.Subject.ID,
+		SubjectType:  req.Subject.Type,
+		ResourceType: req.Resource.Type,
+		ResourceID:   req.Resource.ID,
+		Action:       req.Action.Name,
+		Data:         req.Context["data"],
+	}
+	for key, value := range map[string]*string{"purpose": &evalReq.Purpose, "act_as": &evalReq.ActAs} {
+		if raw, ok := req.Context[key]; ok {
+			s, ok := raw.(string)
+			if !ok {
+				return model.EvaluationRequest{}, fmt.Errorf("context.%s must be a string", key)
+			}
+			*value = s
+		}
+	}
+	if raw, ok := req.Context["environment"]; ok {
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return model.EvaluationRequest{}, fmt.Errorf("context.environment is invalid: %w", err)
+		}
+		if err := json.Unmarshal(b, &evalReq.Environment); err != nil {
+			return model.EvaluationRequest{}, fmt.Errorf("context.environment is invalid: %w", err)
+		}
+	}
+	return evalReq, nil
+}
+
+// toAuthZEN maps a decision to an AuthZEN response. Everything the PDP decided
+// besides allow, such as the allowed fields, is returned in the context.
+func toAuthZEN(response model.PolicyResponse) model.AuthZENEvaluationResponse {
+	var decisionContext map[string]interface{}
+	b, err := json.Marshal(response)
+	if err == nil {
+		err = json.Unmarshal(b, &decisionContext)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to convert decision to AuthZEN context: %v", err)
+	}
+	delete(decisionContext, "allow")
+
+	return model.AuthZENEvaluationResponse{Decision: response.Allow, Context: decisionContext}
+}
+
+// authZENError is the denied decision of an evaluation that failed
+func authZENError(status int, err error) model.AuthZENEvaluationResponse {
+	return model.AuthZENEvaluationResponse{
+		Decision: false,
+		Context: map[string]interface{}{
+			"error": map[string]interface{}{
+				"status":  status,
+				"message": err.Error(),
+			},
+		},
+	}
+}
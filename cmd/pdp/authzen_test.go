@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+func TestPDPHandler_HandleAuthZENEvaluation(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantDecision bool
+		wantFields   int
+	}{
+		{
+			name:         "Manager_views_employees",
+			body:         `{"subject": {"type": "user", "id": "` + testManagerUser + `"}, "resource": {"type": "employees"}, "action": {"name": "view"}}`,
+			wantStatus:   http.StatusOK,
+			wantDecision: true,
+			wantFields:   9,
+		},
+		{
+			name:         "Employee_edits_employees",
+			body:         `{"subject": {"type": "user", "id": "` + testEmployeeUser + `"}, "resource": {"type": "employees"}, "action": {"name": "edit"}}`,
+			wantStatus:   http.StatusOK,
+			wantDecision: false,
+		},
+		{
+			name:         "Purpose_in_context",
+			body:         `{"subject": {"type": "user", "id": "` + testManagerUser + `"}, "resource": {"type": "employees"}, "action": {"name": "view"}, "context": {"purpose": "payroll"}}`,
+			wantStatus:   http.StatusOK,
+			wantDecision: false,
+		},
+		{
+			name:         "Environment_in_context",
+			body:         `{"subject": {"type": "user", "id": "` + testManagerUser + `"}, "resource": {"type": "employees"}, "action": {"name": "view"}, "context": {"environment": {"client_ip": "10.1.2.3", "request_time": "2026-10-19T10:00:00+09:00", "timezone": "Asia/Tokyo"}}}`,
+			wantStatus:   http.StatusOK,
+			wantDecision: true,
+			wantFields:   9,
+		},
+		{
+			name:       "Invalid_environment",
+			body:       `{"subject": {"type": "user", "id": "` + testManagerUser + `"}, "resource": {"type": "employees"}, "action": {"name": "view"}, "context": {"environment": {"request_time": "yesterday"}}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Missing_action",
+			body:       `{"subject": {"type": "user", "id": "` + testManagerUser + `"}, "resource": {"type": "employees"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid_purpose",
+			body:       `{"subject": {"type": "user", "id": "` + testManagerUser + `"}, "resource": {"type": "employees"}, "action": {"name": "view"}, "context": {"purpose": 1}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(newBreakGlassMockRepo())
+
+			req := httptest.NewRequest(http.MethodPost, authZENEvaluationPath, strings.NewReader(tt.body))
+			req.Header.Set("X-Request-ID", "request-1")
+			rec := httptest.NewRecorder()
+			handler.HandleAuthZENEvaluation(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("HandleAuthZENEvaluation() status = %v, want %v, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("X-Request-ID"); got != "request-1" {
+				t.Errorf("X-Request-ID = %q, want %q", got, "request-1")
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response model.AuthZENEvaluationResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Decision != tt.wantDecision {
+				t.Errorf("decision = %v, want %v", response.Decision, tt.wantDecision)
+			}
+			if _, ok := response.Context["allow"]; ok {
+				t.Errorf("context = %v, want the decision only in decision", response.Context)
+			}
+			fields, _ := response.Context["allowed_fields"].([]interface{})
+			if len(fields) != tt.wantFields {
+				t.Errorf("context allowed_fields = %v, want %d fields", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_HandleAuthZENEvaluations(t *testing.T) {
+	defaults := `"subject": {"type": "user", "id": "` + testEmployeeUser + `"}, "resource": {"type": "employees"}, "action": {"name": "view"}`
+	evaluations := `"evaluations": [
+		{},
+		{"action": {"name": "edit"}},
+		{"subject": {"type": "user", "id": ""}},
+		{"subject": {"type": "user", "id": "` + testManagerUser + `"}}
+	]`
+
+	tests := []struct {
+		name          string
+		body          string
+		wantStatus    int
+		wantDecisions []bool
+		wantErrors    []int
+	}{
+		{
+			name:          "Execute_all",
+			body:          `{` + defaults + `, ` + evaluations + `}`,
+			wantStatus:    http.StatusOK,
+			wantDecisions: []bool{true, false, false, true},
+			wantErrors:    []int{0, 0, http.StatusBadRequest, 0},
+		},
+		{
+			name:          "Deny_on_first_deny",
+			body:          `{` + defaults + `, ` + evaluations + `, "options": {"evaluations_semantic": "deny_on_first_deny"}}`,
+			wantStatus:    http.StatusOK,
+			wantDecisions: []bool{true, false},
+			wantErrors:    []int{0, 0},
+		},
+		{
+			name:          "Permit_on_first_permit",
+			body:          `{` + defaults + `, ` + evaluations + `, "options": {"evaluations_semantic": "permit_on_first_permit"}}`,
+			wantStatus:    http.StatusOK,
+			wantDecisions: []bool{true},
+			wantErrors:    []int{0},
+		},
+		{
+			name:          "Without_evaluations",
+			body:          `{` + defaults + `}`,
+			wantStatus:    http.StatusOK,
+			wantDecisions: []bool{true},
+			wantErrors:    []int{0},
+		},
+		{
+			name:       "Unsupported_semantic",
+			body:       `{` + defaults + `, "options": {"evaluations_semantic": "first_applicable"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(newBreakGlassMockRepo())
+
+			rec := httptest.NewRecorder()
+			handler.HandleAuthZENEvaluations(rec, httptest.NewRequest(http.MethodPost, authZENEvaluationsPath, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("HandleAuthZENEvaluations() status = %v, want %v, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response model.AuthZENEvaluationsResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Evaluations) != len(tt.wantDecisions) {
+				t.Fatalf("HandleAuthZENEvaluations() returned %d evaluations, want %d", len(response.Evaluations), len(tt.wantDecisions))
+			}
+			for i, result := range response.Evaluations {
+				if result.Decision != tt.wantDecisions[i] {
+					t.Errorf("evaluation %d decision = %v, want %v", i, result.Decision, tt.wantDecisions[i])
+				}
+				var status int
+				if e, ok := result.Context["error"].(map[string]interface{}); ok {
+					status = int(e["status"].(float64))
+				}
+				if status != tt.wantErrors[i] {
+					t.Errorf("evaluation %d error status = %d, want %d", i, status, tt.wantErrors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPDPHandler_HandleAuthZENConfiguration(t *testing.T) {
+	handler := NewPDPHandler(newBreakGlassMockRepo())
+
+	rec := httptest.NewRecorder()
+	handler.HandleAuthZENConfiguration(rec, httptest.NewRequest(http.MethodGet, "http://pdp.local:8081"+authZENConfigurationPath, nil))
+
+	var config model.AuthZENConfiguration
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to decode configuration: %v", err)
+	}
+	want := model.AuthZENConfiguration{
+		PolicyDecisionPoint:       "http://pdp.local:8081",
+		AccessEvaluationEndpoint:  "http://pdp.local:8081/access/v1/evaluation",
+		AccessEvaluationsEndpoint: "http://pdp.local:8081/access/v1/evaluations",
+	}
+	if config != want {
+		t.Errorf("HandleAuthZENConfiguration() = %+v, want %+v", config, want)
+	}
+}
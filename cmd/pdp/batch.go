@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+const (
+	// maxBatchSize is the most evaluations a batch request may contain
+	maxBatchSize = 100
+	// batchConcurrency is how many evaluations of a batch run at once, each looking up the
+	// PRP on a connection of the repository's pool
+	batchConcurrency = 8
+)
+
+// HandleBatchEvaluation evaluates many requests at once. The evaluations run concurrently
+// against the same policy and share the lookups of their subjects; their results are
+// returned in request order, each with its decision or error.
+func (h *PDPHandler) HandleBatchEvaluation(w http.ResponseWriter, r *http.Request) {
+	var batch model.BatchEvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		log.Printf("[ERROR] Error decoding batch request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(batch.Evaluations) == 0 {
+		http.Error(w, "No evaluations in batch", http.StatusBadRequest)
+		return
+	}
+	if len(batch.Evaluations) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("Batch exceeds %d evaluations", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[INFO] Received batch of %d evaluation requests", len(batch.Evaluations))
+
+	results := h.evaluateBatch(h.batchContext(r.Context()), batch.Evaluations, batch.Defaults)
+
+	var allowed, denied, failed int
+	for _, result := range results {
+		switch {
+		case result.Decision == nil:
+			failed++
+		case result.Decision.Allow:
+			allowed++
+		default:
+			denied++
+		}
+	}
+	log.Printf("[INFO] Batch Decision: evaluations=%d, allowed=%d, denied=%d, errors=%d",
+		len(results), allowed, denied, failed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.BatchEvaluationResponse{Evaluations: results})
+}
+
+// batchContext returns a context in which evaluations use the active policy and share subject lookups
+func (h *PDPHandler) batchContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, activePolicyKey{}, h.active.Load())
+	return context.WithValue(ctx, repositoryKey{}, newSubjectCache(h.repo))
+}
+
+// evaluateBatch evaluates the requests concurrently and returns their results in order
+func (h *PDPHandler) evaluateBatch(ctx context.Context, reqs []model.EvaluationRequest, defaults model.EvaluationRequest) []model.BatchEvaluationResult {
+	results := make([]model.BatchEvaluationResult, len(reqs))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req model.EvaluationRequest) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = h.evaluateBatchItem(ctx, withDefaults(req, defaults))
+			if results[i].Error != "" {
+				log.Printf("[ERROR] Batch evaluation %d error: %s", i, results[i].Error)
+			}
+		}(i, req)
+	}
+	wg.Wait()
+	return results
+}
+
+// evaluateBatchItem evaluates one request of a batch
+func (h *PDPHandler) evaluateBatchItem(ctx context.Context, req model.EvaluationRequest) model.BatchEvaluationResult {
+	var err error
+	switch {
+	case req.UserID == "":
+		err = errors.New("user_id is required")
+	case req.ResourceType == "":
+		err = errors.New("resource_type is required")
+	case req.Action == "":
+		err = errors.New("action is required")
+	}
+	if err != nil {
+		return model.BatchEvaluationResult{Error: err.Error()}
+	}
+
+	response, err := h.evaluate(ctx, req)
+	if err != nil {
+		return model.BatchEvaluationResult{Error: err.Error()}
+	}
+	return model.BatchEvaluationResult{Decision: &response}
+}
+
+// withDefaults fills the fields the request leaves empty from the defaults
+func withDefaults(req, defaults model.EvaluationRequest) model.EvaluationRequest {
+	fill := func(value *string, fallback string) {
+		if *value == "" {
+			*value = fallback
+		}
+	}
+	fill(&req.UserID, defaults.UserID)
+	fill(&req.ResourceType, defaults.ResourceType)
+	fill(&req.ResourceID, defaults.ResourceID)
+	fill(&req.Action, defaults.Action)
+	fill(&req.ActAs, defaults.ActAs)
+	fill(&req.Purpose, defaults.Purpose)
+	fill(&req.SubjectType, defaults.SubjectType)
+	if req.Data == nil {
+		req.Data = defaults.Data
+	}
+	if req.Environment == nil {
+		req.Environment = defaults.Environment
+	}
+	return req
+}
+
+type repositoryKey struct{}
+
+// repository returns the repository an evaluation reads from. The evaluations
+// of a batch read through a cache so that each subject is looked up once.
+func (h *PDPHandler) repository(ctx context.Context) interfaces.Repository {
+	if repo, ok := ctx.Value(repositoryKey{}).(interfaces.Repository); ok {
+		return repo
+	}
+	return h.repo
+}
+
+// subjectCache memoizes the per-subject lookups of a batch. Concurrent lookups of the
+// same subject wait for the first one instead of querying the repository again.
+type subjectCache struct {
+	interfaces.Repository
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+// newSubjectCache creates a subjectCache reading from repo
+func newSubjectCache(repo interfaces.Repository) *subjectCache {
+	return &subjectCache{Repository: repo, entries: make(map[string]*cacheEntry)}
+}
+
+// memoize returns the value cached under key, fetching it on first use
+func memoize[T any](c *subjectCache, key string, fetch func() (T, error)) (T, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.value, entry.err = fetch()
+	})
+	value, _ := entry.value.(T)
+	return value, entry.err
+}
+
+type userRoles struct {
+	roles       []string
+	permissions []model.RBACPermission
+}
+
+func (c *subjectCache) GetUserRoles(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+	cached, err := memoize(c, "roles:"+userID, func() (userRoles, error) {
+		roles, permissions, err := c.Repository.GetUserRoles(ctx, userID)
+		return userRoles{roles, permissions}, err
+	})
+	return cached.roles, cached.permissions, err
+}
+
+func (c *subjectCache) GetFieldPermissions(ctx context.Context, userID string) ([]model.FieldPermission, error) {
+	return memoize(c, "fields:"+userID, func() ([]model.FieldPermission, error) {
+		return c.Repository.GetFieldPermissions(ctx, userID)
+	})
+}
+
+func (c *subjectCache) GetRoleParents(ctx context.Context, userID string) ([]model.RoleParent, error) {
+	return memoize(c, "parents:"+userID, func() ([]model.RoleParent, error) {
+		return c.Repository.GetRoleParents(ctx, userID)
+	})
+}
+
+func (c *subjectCache) GetRolePurposes(ctx context.Context, userID string) ([]model.RolePurpose, error) {
+	return memoize(c, "purposes:"+userID, func() ([]model.RolePurpose, error) {
+		return c.Repository.GetRolePurposes(ctx, userID)
+	})
+}
+
+func (c *subjectCache) GetPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.RBACPermission, error) {
+	return memoize(c, "role_permissions:"+strings.Join(roleIDs, ","), func() ([]model.RBACPermission, error) {
+		return c.Repository.GetPermissionsForRoles(ctx, roleIDs)
+	})
+}
+
+func (c *subjectCache) GetFieldPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.FieldPermission, error) {
+	return memoize(c, "role_fields:"+strings.Join(roleIDs, ","), func() ([]model.FieldPermission, error) {
+		return c.Repository.GetFieldPermissionsForRoles(ctx, roleIDs)
+	})
+}
+
+func (c *subjectCache) GetRoleParentsForRoles(ctx context.Context, roleIDs []string) ([]model.RoleParent, error) {
+	return memoize(c, "role_parents:"+strings.Join(roleIDs, ","), func() ([]model.RoleParent, error) {
+		return c.Repository.GetRoleParentsForRoles(ctx, roleIDs)
+	})
+}
+
+func (c *subjectCache) GetRolePurposesForRoles(ctx context.Context, roleIDs []string) ([]model.RolePurpose, error) {
+	return memoize(c, "role_purposes:"+strings.Join(roleIDs, ","), func() ([]model.RolePurpose, error) {
+		return c.Repository.GetRolePurposesForRoles(ctx, roleIDs)
+	})
+}
+
+func (c *subjectCache) GetPurposeFields(ctx context.Context) ([]model.PurposeField, error) {
+	return memoize(c, "purpose_fields", func() ([]model.PurposeField, error) {
+		return c.Repository.GetPurposeFields(ctx)
+	})
+}
+
+func (c *subjectCache) GetActiveBreakGlassGrants(ctx context.Context, userID string) ([]model.BreakGlassGrant, error) {
+	return memoize(c, "break_glass:"+userID, func() ([]model.BreakGlassGrant, error) {
+		return c.Repository.GetActiveBreakGlassGrants(ctx, userID)
+	})
+}
+
+func (c *subjectCache) GetResourceIDByType(ctx context.Context, resourceType string) (string, error) {
+	return memoize(c, "resource:"+resourceType, func() (string, error) {
+		return c.Repository.GetResourceIDByType(ctx, resourceType)
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+func TestPDPHandler_HandleBatchEvaluation(t *testing.T) {
+	mockRepo := newBreakGlassMockRepo()
+	getUserRoles := mockRepo.GetUserRolesFunc
+	var mu sync.Mutex
+	lookups := make(map[string]int)
+	mockRepo.GetUserRolesFunc = func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+		mu.Lock()
+		lookups[userID]++
+		mu.Unlock()
+		return getUserRoles(ctx, userID)
+	}
+	handler := NewPDPHandler(mockRepo)
+
+	batch := model.BatchEvaluationRequest{
+		Defaults: model.EvaluationRequest{
+			UserID:       testEmployeeUser,
+			ResourceType: "employees",
+			Action:       "view",
+		},
+		Evaluations: []model.EvaluationRequest{
+			{},
+			{Action: "edit"},
+			{ResourceType: "departments"},
+			{UserID: testManagerUser},
+			{ResourceType: "employees", Action: "view", UserID: testEmployeeUser, Purpose: "payroll"},
+		},
+	}
+	for i := 0; i < 20; i++ {
+		batch.Evaluations = append(batch.Evaluations, model.EvaluationRequest{UserID: testManagerUser})
+	}
+
+	body, _ := json.Marshal(batch)
+	rec := httptest.NewRecorder()
+	handler.HandleBatchEvaluation(rec, httptest.NewRequest(http.MethodPost, "/evaluations", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HandleBatchEvaluation() status = %v, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var response model.BatchEvaluationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Evaluations) != len(batch.Evaluations) {
+		t.Fatalf("HandleBatchEvaluation() returned %d results, want %d", len(response.Evaluations), len(batch.Evaluations))
+	}
+
+	wantAllow := []bool{true, false, false, true, false}
+	for i, want := range wantAllow {
+		result := response.Evaluations[i]
+		if result.Error != "" || result.Decision == nil {
+			t.Errorf("evaluation %d = %+v, want a decision", i, result)
+			continue
+		}
+		if result.Decision.Allow != want {
+			t.Errorf("evaluation %d allow = %v, want %v", i, result.Decision.Allow, want)
+		}
+	}
+	if got := len(response.Evaluations[3].Decision.AllowedFields); got != 9 {
+		t.Errorf("manager allowed fields = %d, want 9", got)
+	}
+
+	// Each subject is looked up once for the whole batch
+	if lookups[testEmployeeUser] != 1 || lookups[testManagerUser] != 1 {
+		t.Errorf("role lookups = %v, want one per subject", lookups)
+	}
+}
+
+func TestPDPHandler_HandleBatchEvaluation_invalid(t *testing.T) {
+	tooMany := make([]model.EvaluationRequest, maxBatchSize+1)
+
+	tests := []struct {
+		name       string
+		batch      model.BatchEvaluationRequest
+		wantStatus int
+		wantErrors []string
+	}{
+		{
+			name:       "Empty_batch",
+			batch:      model.BatchEvaluationRequest{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Too_many_evaluations",
+			batch:      model.BatchEvaluationRequest{Evaluations: tooMany},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Incomplete_evaluations",
+			batch: model.BatchEvaluationRequest{
+				Defaults: model.EvaluationRequest{ResourceType: "employees", Action: "view"},
+				Evaluations: []model.EvaluationRequest{
+					{},
+					{UserID: testEmployeeUser},
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantErrors: []string{"user_id is required", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(newBreakGlassMockRepo())
+
+			body, _ := json.Marshal(tt.batch)
+			rec := httptest.NewRecorder()
+			handler.HandleBatchEvaluation(rec, httptest.NewRequest(http.MethodPost, "/evaluations", bytes.NewReader(body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("HandleBatchEvaluation() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response model.BatchEvaluationResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			for i, want := range tt.wantErrors {
+				if got := response.Evaluations[i].Error; got != want {
+					t.Errorf("evaluation %d error = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
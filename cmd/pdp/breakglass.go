@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+const (
+	// defaultBreakGlassDuration is how long a grant lasts when no duration is requested
+	defaultBreakGlassDuration = time.Hour
+	// maxBreakGlassDuration is the longest duration a grant may be requested for
+	maxBreakGlassDuration = 4 * time.Hour
+)
+
+// HandleBreakGlassRequest grants time-boxed emergency access to a resource. Only an authenticated
+// caller may request a grant, and only for themselves.
+func (h *PDPHandler) HandleBreakGlassRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	callerID, ok := h.authenticateCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.BreakGlassRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] Error decoding break-glass request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" || req.ResourceType == "" {
+		http.Error(w, "user_id and resource_type are required", http.StatusBadRequest)
+		return
+	}
+	if req.UserID != callerID {
+		log.Printf("[AUDIT] Break-glass request denied: caller=%s requested a grant for user=%s, resourceType=%s",
+			callerID, req.UserID, req.ResourceType)
+		http.Error(w, "Break-glass access may only be requested for yourself", http.StatusForbidden)
+		return
+	}
+
+	duration := defaultBreakGlassDuration
+	if req.DurationMinutes > 0 {
+		duration = time.Duration(req.DurationMinutes) * time.Minute
+	}
+	if req.DurationMinutes < 0 || duration > maxBreakGlassDuration {
+		http.Error(w, fmt.Sprintf("duration_minutes must be between 1 and %d", int(maxBreakGlassDuration.Minutes())), http.StatusBadRequest)
+		return
+	}
+
+	resourceID, err := h.repository(ctx).GetResourceIDByType(ctx, req.ResourceType)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get resource ID for break-glass request: %v", err)
+		http.Error(w, "Unknown resource type", http.StatusBadRequest)
+		return
+	}
+
+	_, grants, err := h.grantsForUser(ctx, req.UserID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get roles for break-glass request: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	input := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id": req.UserID,
+		},
+		"resource": map[string]interface{}{
+			"id":   resourceID,
+			"name": req.ResourceType,
+		},
+		"role_permissions": rolePermissionsInput(grants.permissions),
+		"justification":    req.Justification,
+	}
+
+	allowed, err := evalAllow(ctx, h.policy(ctx).opaBreakGlassRequest, input)
+	if err != nil {
+		log.Printf("[ERROR] Break-glass policy evaluation error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		log.Printf("[AUDIT] Break-glass request denied: user=%s, resourceType=%s, justification=%q",
+			req.UserID, req.ResourceType, req.Justification)
+		http.Error(w, "Break-glass access denied", http.StatusForbidden)
+		return
+	}
+
+	grant := &model.BreakGlassGrant{
+		UserID:        req.UserID,
+		ResourceID:    resourceID,
+		ResourceType:  req.ResourceType,
+		Justification: req.Justification,
+		ExpiresAt:     time.Now().Add(duration).UTC(),
+	}
+	if err := h.repo.CreateBreakGlassGrant(ctx, grant); err != nil {
+		log.Printf("[ERROR] Failed to create break-glass grant: %v", err)
+		if errors.Is(err, interfaces.ErrNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[AUDIT] Break-glass access granted: grant=%s, user=%s, resourceType=%s, expiresAt=%s, justification=%q",
+		grant.ID, grant.UserID, grant.ResourceType, grant.ExpiresAt.Format(time.RFC3339), grant.Justification)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(grant)
+}
+
+// HandleBreakGlassRevoke revokes a break-glass grant before it expires
+func (h *PDPHandler) HandleBreakGlassRevoke(w http.ResponseWriter, r *http.Request, grantID string) {
+	adminID, ok := h.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	if grantID == "" {
+		http.Error(w, "Missing grant ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.RevokeBreakGlassGrant(r.Context(), grantID, adminID); err != nil {
+		log.Printf("[ERROR] Failed to revoke break-glass grant: %v", err)
+		if errors.Is(err, interfaces.ErrNotFound) {
+			http.Error(w, "Grant not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[AUDIT] Break-glass grant revoked: grant=%s, revokedBy=%s", grantID, adminID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyBreakGlass replaces the regular decision with the break-glass policy's
+// decision while the user holds an active grant for the resource
+func (h *PDPHandler) applyBreakGlass(ctx context.Context, req model.EvaluationRequest, input map[string]interface{}, response model.PolicyResponse) (model.PolicyResponse, error) {
+	grants, err := h.repository(ctx).GetActiveBreakGlassGrants(ctx, req.UserID)
+	if err != nil {
+		// Grants only ever elevate access, so the regular decision still applies
+		log.Printf("[ERROR] Failed to get break-glass grants: %v", err)
+		return response, nil
+	}
+	if len(grants) == 0 {
+		return response, nil
+	}
+
+	grantInputs := make([]map[string]interface{}, len(grants))
+	for i, grant := range grants {
+		grantInputs[i] = map[string]interface{}{
+			"id":            grant.ID,
+			"resource_type": grant.ResourceType,
+			"expires_at":    grant.ExpiresAt.UTC().Format(time.RFC3339),
+		}
+	}
+	input["break_glass_grants"] = grantInputs
+
+	results, err := h.policy(ctx).opaBreakGlass.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return model.PolicyResponse{}, fmt.Errorf("break-glass policy evaluation error: %w", err)
+	}
+
+	breakGlassResponse, err := parsePolicyResult(results)
+	if err != nil {
+		return model.PolicyResponse{}, err
+	}
+	if !breakGlassResponse.Allow {
+		return response, nil
+	}
+
+	result, _ := results[0].Expressions[0].Value.(map[string]interface{})
+	grantID, _ := result["grant_id"].(string)
+	for i := range grants {
+		if grants[i].ID == grantID {
+			breakGlassResponse.BreakGlass = &grants[i]
+			break
+		}
+	}
+	breakGlassResponse.Message = "Access granted - break-glass"
+
+	log.Printf("[AUDIT] Break-glass access used: grant=%s, user=%s, resourceType=%s, resourceID=%s, action=%s, regularAllow=%v, allowedFields=%v",
+		grantID, req.UserID, req.ResourceType, req.ResourceID, req.Action, response.Allow, breakGlassResponse.AllowedFields)
+
+	return breakGlassResponse, nil
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+const (
+	testManagerUser  = "11111111-1111-1111-1111-111111111111"
+	testEmployeeUser = "44444444-4444-4444-4444-444444444444"
+	testAdminUser    = "99999999-9999-9999-9999-999999999999"
+	testManagerRole  = "11111111-1111-1111-1111-111111111111"
+	testEmployeeRole = "22222222-2222-2222-2222-222222222222"
+	testAdminRole    = "44444444-4444-4444-4444-444444444444"
+	testEmployeesRes = "11111111-1111-1111-1111-111111111111"
+	testAdminRes     = "44444444-4444-4444-4444-444444444444"
+)
+
+// testRolePermissions are the permissions of the roles of newBreakGlassMockRepo
+var testRolePermissions = map[string][]model.RBACPermission{
+	testManagerRole: {
+		{Role: testManagerRole, ResourceID: testEmployeesRes, Action: "view"},
+		{Role: testManagerRole, ResourceID: testEmployeesRes, Action: "break_glass"},
+	},
+	testEmployeeRole: {
+		{Role: testEmployeeRole, ResourceID: testEmployeesRes, Action: "view"},
+	},
+	testAdminRole: {
+		{Role: testAdminRole, ResourceID: testAdminRes, Action: "manage"},
+	},
+}
+
+// newBreakGlassMockRepo returns a repository with a manager allowed to break glass,
+// an employee and an administrator
+func newBreakGlassMockRepo() *mocks.MockRepository {
+	userRoles := map[string]string{
+		testManagerUser:  testManagerRole,
+		testEmployeeUser: testEmployeeRole,
+		testAdminUser:    testAdminRole,
+	}
+
+	return &mocks.MockRepository{
+		GetFieldPermissionsFunc: getTestBreakGlassFieldPermissions,
+		GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+			role, ok := userRoles[userID]
+			if !ok {
+				return nil, nil, nil
+			}
+			return []string{role}, testRolePermissions[role], nil
+		},
+		GetPermissionsForRolesFunc: func(ctx context.Context, roleIDs []string) ([]model.RBACPermission, error) {
+			var permissions []model.RBACPermission
+			for _, role := range roleIDs {
+				permissions = append(permissions, testRolePermissions[role]...)
+			}
+			return permissions, nil
+		},
+		GetFieldPermissionsForRolesFunc: func(ctx context.Context, roleIDs []string) ([]model.FieldPermission, error) {
+			all, err := getTestBreakGlassFieldPermissions(ctx, "")
+			if err != nil {
+				return nil, err
+			}
+			var permissions []model.FieldPermission
+			for _, fp := range all {
+				if slices.Contains(roleIDs, fp.Role) {
+					permissions = append(permissions, fp)
+				}
+			}
+			return permissions, nil
+		},
+		GetResourceIDByTypeFunc: getTestResourceID,
+	}
+}
+
+// getTestBreakGlassFieldPermissions adds the emergency fields of the manager role to the seeded field permissions
+func getTestBreakGlassFieldPermissions(ctx context.Context, userID string) ([]model.FieldPermission, error) {
+	permissions, err := getTestFieldPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []string{"id", "name", "email", "department_id", "department_name", "employment_type_id", "employment_type", "position", "joined_at"} {
+		permissions = append(permissions, model.FieldPermission{
+			Role:       testManagerRole,
+			ResourceID: testEmployeesRes,
+			Action:     "break_glass",
+			Field:      field,
+		})
+	}
+	return permissions, nil
+}
+
+func TestPDPHandler_HandleBreakGlassRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		callerID   string
+		request    model.BreakGlassRequest
+		wantStatus int
+		wantGrant  bool
+	}{
+		{
+			name:     "Manager_with_justification",
+			callerID: testManagerUser,
+			request: model.BreakGlassRequest{
+				UserID:          testManagerUser,
+				ResourceType:    "employees",
+				Justification:   "INC-1234 payroll outage, need to verify records",
+				DurationMinutes: 30,
+			},
+			wantStatus: http.StatusCreated,
+			wantGrant:  true,
+		},
+		{
+			name:     "Short_justification",
+			callerID: testManagerUser,
+			request: model.BreakGlassRequest{
+				UserID:        testManagerUser,
+				ResourceType:  "employees",
+				Justification: "urgent",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "Employee_without_permission",
+			callerID: testEmployeeUser,
+			request: model.BreakGlassRequest{
+				UserID:        testEmployeeUser,
+				ResourceType:  "employees",
+				Justification: "INC-1234 payroll outage, need to verify records",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "Duration_too_long",
+			callerID: testManagerUser,
+			request: model.BreakGlassRequest{
+				UserID:          testManagerUser,
+				ResourceType:    "employees",
+				Justification:   "INC-1234 payroll outage, need to verify records",
+				DurationMinutes: 24 * 60,
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Unauthenticated_caller",
+			request: model.BreakGlassRequest{
+				UserID:        testManagerUser,
+				ResourceType:  "employees",
+				Justification: "INC-1234 payroll outage, need to verify records",
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			// A grant may not be opened on behalf of someone else who holds break_glass
+			name:     "Grant_for_another_user",
+			callerID: testEmployeeUser,
+			request: model.BreakGlassRequest{
+				UserID:        testManagerUser,
+				ResourceType:  "employees",
+				Justification: "INC-1234 payroll outage, need to verify records",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *model.BreakGlassGrant
+			mockRepo := newBreakGlassMockRepo()
+			mockRepo.CreateBreakGlassGrantFunc = func(ctx context.Context, grant *model.BreakGlassGrant) error {
+				grant.ID = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+				created = grant
+				return nil
+			}
+			handler := NewPDPHandler(mockRepo)
+			handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+
+			reqBody, err := json.Marshal(tt.request)
+			if err != nil {
+				t.Fatalf("Failed to marshal request: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/break-glass", bytes.NewBuffer(reqBody))
+			setCallerToken(req, tt.callerID)
+			rec := httptest.NewRecorder()
+			handler.HandleBreakGlassRequest(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("HandleBreakGlassRequest() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if (created != nil) != tt.wantGrant {
+				t.Fatalf("HandleBreakGlassRequest() created grant = %v, want %v", created != nil, tt.wantGrant)
+			}
+			if created != nil {
+				if d := time.Until(created.ExpiresAt); d <= 25*time.Minute || d > 30*time.Minute {
+					t.Errorf("HandleBreakGlassRequest() grant expires in %v, want 30m", d)
+				}
+			}
+		})
+	}
+}
+
+func TestPDPHandler_HandleBreakGlassRequest_pip(t *testing.T) {
+	request := model.BreakGlassRequest{
+		UserID:        testEmployeeUser,
+		ResourceType:  "employees",
+		Justification: "INC-1234 payroll outage, need to verify records",
+	}
+	tests := []struct {
+		name       string
+		userRoles  map[string][]string
+		wantStatus int
+	}{
+		{
+			// The PRP binds the employee role only, the PIP the manager role
+			name:       "Manager_in_PIP",
+			userRoles:  map[string][]string{testEmployeeUser: {testManagerRole}},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "No_roles_in_PIP",
+			userRoles:  map[string][]string{},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := newBreakGlassMockRepo()
+			mockRepo.CreateBreakGlassGrantFunc = func(ctx context.Context, grant *model.BreakGlassGrant) error {
+				return nil
+			}
+			handler := NewPDPHandler(mockRepo)
+			handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+			handler.SetPolicyInformationProvider(pkg.NewPIPClient(newRolesPIP(t, tt.userRoles).URL, time.Second))
+
+			reqBody, err := json.Marshal(request)
+			if err != nil {
+				t.Fatalf("Failed to marshal request: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/break-glass", bytes.NewBuffer(reqBody))
+			setCallerToken(req, testEmployeeUser)
+			rec := httptest.NewRecorder()
+			handler.HandleBreakGlassRequest(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("HandleBreakGlassRequest() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_HandleBreakGlassRevoke(t *testing.T) {
+	tests := []struct {
+		name       string
+		callerID   string
+		revokeErr  error
+		wantStatus int
+	}{
+		{
+			name:       "Admin_revokes",
+			callerID:   testAdminUser,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Manager_is_not_admin",
+			callerID:   testManagerUser,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Unknown_grant",
+			callerID:   testAdminUser,
+			revokeErr:  fmt.Errorf("grant: %w", interfaces.ErrNotFound),
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var revokedBy string
+			mockRepo := newBreakGlassMockRepo()
+			mockRepo.RevokeBreakGlassGrantFunc = func(ctx context.Context, grantID, by string) error {
+				revokedBy = by
+				return tt.revokeErr
+			}
+			handler := NewPDPHandler(mockRepo)
+			handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+
+			req := httptest.NewRequest(http.MethodDelete, "/break-glass/aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa", nil)
+			setCallerToken(req, tt.callerID)
+			rec := httptest.NewRecorder()
+			handler.HandleBreakGlassRevoke(rec, req, "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("HandleBreakGlassRevoke() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNoContent && revokedBy != tt.callerID {
+				t.Errorf("HandleBreakGlassRevoke() revoked by = %q, want %q", revokedBy, tt.callerID)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_evaluateRBAC_breakGlass(t *testing.T) {
+	mockRepo := newBreakGlassMockRepo()
+	mockRepo.GetActiveBreakGlassGrantsFunc = func(ctx context.Context, userID string) ([]model.BreakGlassGrant, error) {
+		return []model.BreakGlassGrant{{
+			ID:           "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+			UserID:       userID,
+			ResourceID:   testEmployeesRes,
+			ResourceType: "employees",
+			ExpiresAt:    time.Now().Add(time.Hour),
+		}}, nil
+	}
+	handler := NewPDPHandler(mockRepo)
+
+	tests := []struct {
+		name           string
+		userID         string
+		action         string
+		wantAllow      bool
+		wantFields     int
+		wantBreakGlass bool
+	}{
+		{
+			// The manager may not edit, but the grant gives the emergency fields of the PRP
+			name:           "Grant_overrides_regular_decision",
+			userID:         testManagerUser,
+			action:         "edit",
+			wantAllow:      true,
+			wantFields:     9,
+			wantBreakGlass: true,
+		},
+		{
+			// Without emergency fields for their roles the grant gives nothing
+			name:       "Grant_without_emergency_fields",
+			userID:     testEmployeeUser,
+			action:     "view",
+			wantAllow:  true,
+			wantFields: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := handler.evaluateRBAC(context.Background(), model.EvaluationRequest{
+				UserID:       tt.userID,
+				ResourceType: "employees",
+				ResourceID:   testEmployeesRes,
+				Action:       tt.action,
+			})
+			if err != nil {
+				t.Fatalf("evaluateRBAC() error = %v", err)
+			}
+
+			if got.Allow != tt.wantAllow {
+				t.Errorf("evaluateRBAC() allow = %v, want %v", got.Allow, tt.wantAllow)
+			}
+			if len(got.AllowedFields) != tt.wantFields {
+				t.Errorf("evaluateRBAC() allowed fields = %v, want %d fields", got.AllowedFields, tt.wantFields)
+			}
+			if (got.BreakGlass != nil) != tt.wantBreakGlass {
+				t.Errorf("evaluateRBAC() break glass = %+v, want grant %v", got.BreakGlass, tt.wantBreakGlass)
+			}
+			if tt.wantBreakGlass && got.BreakGlass.ID != "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa" {
+				t.Errorf("evaluateRBAC() break glass = %+v, want the active grant", got.BreakGlass)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+// errNoCallerToken is returned when a request carries no bearer token
+var errNoCallerToken = errors.New("missing bearer token")
+
+// CallerAuthenticator identifies the callers of administrative and self-service endpoints by a
+// bearer JWT signed with an HS256 secret or an RS256 key, whose sub claim is the caller's user ID
+type CallerAuthenticator struct {
+	Secret    []byte
+	PublicKey *rsa.PublicKey
+	Issuer    string
+	Audience  string
+}
+
+// SetCallerAuthenticator sets how callers of administrative and self-service endpoints are authenticated.
+// Without one, those endpoints reject every request.
+func (h *PDPHandler) SetCallerAuthenticator(authenticator *CallerAuthenticator) {
+	h.callers = authenticator
+}
+
+// callerAuthenticatorFromEnv returns an authenticator verifying tokens with the HS256 secret
+// PDP_CALLER_JWT_SECRET or the RS256 public key in PDP_CALLER_JWT_PUBLIC_KEY, checking
+// PDP_CALLER_JWT_ISSUER and PDP_CALLER_JWT_AUDIENCE if set, or nil if no key is configured
+func callerAuthenticatorFromEnv() (*CallerAuthenticator, error) {
+	authenticator := &CallerAuthenticator{
+		Issuer:   os.Getenv("PDP_CALLER_JWT_ISSUER"),
+		Audience: os.Getenv("PDP_CALLER_JWT_AUDIENCE"),
+	}
+	if secret := os.Getenv("PDP_CALLER_JWT_SECRET"); secret != "" {
+		authenticator.Secret = []byte(secret)
+	}
+	if path := os.Getenv("PDP_CALLER_JWT_PUBLIC_KEY"); path != "" {
+		publicKey, err := pkg.LoadRSAPublicKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PDP_CALLER_JWT_PUBLIC_KEY: %w", err)
+		}
+		authenticator.PublicKey = publicKey
+	}
+	if authenticator.Secret == nil && authenticator.PublicKey == nil {
+		return nil, nil
+	}
+	return authenticator, nil
+}
+
+// Authenticate returns the user ID of the caller from the verified bearer token of the request
+func (a *CallerAuthenticator) Authenticate(r *http.Request) (string, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", errNoCallerToken
+	}
+
+	claims, err := pkg.VerifyJWT(token, func(alg, _ string) (interface{}, error) {
+		switch {
+		case alg == pkg.AlgHS256 && a.Secret != nil:
+			return a.Secret, nil
+		case alg == pkg.AlgRS256 && a.PublicKey != nil:
+			return a.PublicKey, nil
+		}
+		return nil, fmt.Errorf("algorithm %s not accepted", alg)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return "", fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if a.Audience != "" && !pkg.HasAudience(claims["aud"], a.Audience) {
+		return "", fmt.Errorf("token not issued for audience %s", a.Audience)
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return "", errors.New("token has no subject")
+	}
+	return sub, nil
+}
+
+// authenticateCaller returns the user ID of the authenticated caller. It writes an error
+// response and returns false when caller authentication is not configured or fails.
+func (h *PDPHandler) authenticateCaller(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.callers == nil {
+		http.Error(w, "Caller authentication is not configured", http.StatusUnauthorized)
+		return "", false
+	}
+
+	callerID, err := h.callers.Authenticate(r)
+	if err != nil {
+		log.Printf("[AUDIT] Caller authentication failed: %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "Invalid or missing bearer token", http.StatusUnauthorized)
+		return "", false
+	}
+	return callerID, true
+}
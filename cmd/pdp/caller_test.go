@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+// testCallerSecret signs the tokens of callers of administrative and self-service endpoints in tests
+var testCallerSecret = []byte("test-caller-secret")
+
+// newTestCallerAuthenticator returns an authenticator accepting tokens signed with testCallerSecret
+func newTestCallerAuthenticator() *CallerAuthenticator {
+	return &CallerAuthenticator{Secret: testCallerSecret}
+}
+
+// setCallerToken authenticates the request as the user with a token signed with testCallerSecret.
+// An empty user ID makes the request unauthenticated.
+func setCallerToken(req *http.Request, userID string) {
+	if userID == "" {
+		req.Header.Del("Authorization")
+		return
+	}
+	token, err := pkg.SignJWT(map[string]interface{}{
+		"sub": userID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}, pkg.AlgHS256, "", testCallerSecret)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+func TestPDPHandler_requireAdmin(t *testing.T) {
+	sign := func(claims map[string]interface{}, secret []byte) string {
+		token, err := pkg.SignJWT(claims, pkg.AlgHS256, "", secret)
+		if err != nil {
+			t.Fatalf("SignJWT() error = %v", err)
+		}
+		return "Bearer " + token
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name          string
+		authenticator *CallerAuthenticator
+		authorization string
+		userIDHeader  string
+		wantStatus    int
+	}{
+		{
+			name:          "Admin_token",
+			authenticator: newTestCallerAuthenticator(),
+			authorization: sign(map[string]interface{}{"sub": testAdminUser, "exp": exp}, testCallerSecret),
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Non_admin_token",
+			authenticator: newTestCallerAuthenticator(),
+			authorization: sign(map[string]interface{}{"sub": testManagerUser, "exp": exp}, testCallerSecret),
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			// The X-User-ID header is not a credential
+			name:          "Header_only",
+			authenticator: newTestCallerAuthenticator(),
+			userIDHeader:  testAdminUser,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong_secret",
+			authenticator: newTestCallerAuthenticator(),
+			authorization: sign(map[string]interface{}{"sub": testAdminUser, "exp": exp}, []byte("other-secret")),
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong_audience",
+			authenticator: &CallerAuthenticator{Secret: testCallerSecret, Audience: "pdp"},
+			authorization: sign(map[string]interface{}{"sub": testAdminUser, "exp": exp, "aud": "pep"}, testCallerSecret),
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Not_configured",
+			authorization: sign(map[string]interface{}{"sub": testAdminUser, "exp": exp}, testCallerSecret),
+			wantStatus:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(newBreakGlassMockRepo())
+			if tt.authenticator != nil {
+				handler.SetCallerAuthenticator(tt.authenticator)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/policies/versions", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.userIDHeader != "" {
+				req.Header.Set("X-User-ID", tt.userIDHeader)
+			}
+			rec := httptest.NewRecorder()
+			adminID, ok := handler.requireAdmin(rec, req)
+
+			if tt.wantStatus == http.StatusOK {
+				if !ok || adminID != testAdminUser {
+					t.Errorf("requireAdmin() = %q, %v, want the admin; status = %v", adminID, ok, rec.Code)
+				}
+				return
+			}
+			if ok || rec.Code != tt.wantStatus {
+				t.Errorf("requireAdmin() ok = %v, status = %v, want %v", ok, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
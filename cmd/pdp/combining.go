@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// Algorithms combining the decisions of the policies of a resource type
+const (
+	// combineDenyOverrides denies if any policy denies, and permits if any other permits
+	combineDenyOverrides = "deny-overrides"
+	// combinePermitOverrides permits if any policy permits, and denies if any other denies
+	combinePermitOverrides = "permit-overrides"
+	// combineFirstApplicable takes the decision of the first policy that applies
+	combineFirstApplicable = "first-applicable"
+	// combineOnlyOneApplicable takes the decision of the only policy that applies
+	combineOnlyOneApplicable = "only-one-applicable"
+)
+
+// How the fields of the permitting policies are combined
+const (
+	// fieldsIntersection allows the fields every permitting policy allows
+	fieldsIntersection = "intersection"
+	// fieldsUnion allows the fields any permitting policy allows
+	fieldsUnion = "union"
+)
+
+// Decisions of a policy, and of their combination
+const (
+	decisionPermit        = "permit"
+	decisionDeny          = "deny"
+	decisionNotApplicable = "not_applicable"
+	decisionIndeterminate = "indeterminate"
+)
+
+// validateCombining checks the combining algorithm and defaults the field combination:
+// the overriding algorithms intersect or unite the fields of the permitting policies,
+// the applicable algorithms take the fields of the deciding policy
+func (c *modelConfig) validateCombining() error {
+	switch c.Algorithm {
+	case combineDenyOverrides:
+		if c.Fields == "" {
+			c.Fields = fieldsIntersection
+		}
+	case combinePermitOverrides:
+		if c.Fields == "" {
+			c.Fields = fieldsUnion
+		}
+	case combineFirstApplicable, combineOnlyOneApplicable:
+		if c.Fields != "" {
+			return fmt.Errorf("fields cannot be combined with %s, which takes the fields of the deciding policy", c.Algorithm)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown combining algorithm %q, want %q, %q, %q or %q", c.Algorithm,
+			combineDenyOverrides, combinePermitOverrides, combineFirstApplicable, combineOnlyOneApplicable)
+	}
+
+	if c.Fields != fieldsIntersection && c.Fields != fieldsUnion {
+		return fmt.Errorf("unknown field combination %q, want %q or %q", c.Fields, fieldsIntersection, fieldsUnion)
+	}
+	return nil
+}
+
+// policyDecision is the decision of one of the combined policies with its response
+type policyDecision struct {
+	policy   string
+	decision string
+	response model.PolicyResponse
+}
+
+// evaluateModels evaluates the request with the policies configured for the resource type and
+// combines their decisions with its combining algorithm. Decisions that are not permitted are
+// denied; the allowed fields are combined from the permitting policies that restrict fields,
+// and without any the data is returned unfiltered.
+func (h *PDPHandler) evaluateModels(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error) {
+	config := h.modelsFor(ctx, req.ResourceType)
+	if config.rbacOnly() {
+		return h.evaluateRBAC(ctx, req)
+	}
+
+	var decisions []policyDecision
+	for _, name := range config.Policies {
+		d, err := h.decide(ctx, name, req)
+		if err != nil {
+			return model.PolicyResponse{}, fmt.Errorf("%s evaluation error: %w", name, err)
+		}
+		decisions = append(decisions, d)
+		if config.Algorithm == combineFirstApplicable && d.decision != decisionNotApplicable {
+			break
+		}
+	}
+
+	decision, contributing := combineDecisions(config.Algorithm, decisions)
+	trace := &model.CombinationTrace{
+		Algorithm: config.Algorithm,
+		Fields:    config.Fields,
+		Policies:  make([]model.PolicyDecision, len(decisions)),
+		Decision:  decision,
+	}
+	models := make(map[string]bool, len(decisions))
+	for i, d := range decisions {
+		trace.Policies[i] = model.PolicyDecision{Policy: d.policy, Decision: d.decision, AllowedFields: d.response.AllowedFields}
+		if d.decision != decisionNotApplicable {
+			models[d.policy] = d.decision == decisionPermit
+		}
+	}
+
+	var response model.PolicyResponse
+	switch decision {
+	case decisionPermit:
+		response = combinePermits(config.Fields, contributing, req)
+		trace.AllowedFields = response.AllowedFields
+	case decisionDeny:
+		response = model.PolicyResponse{Allow: false, Message: contributing[0].response.Message, AllowedFields: []string{}}
+	case decisionIndeterminate:
+		response = model.PolicyResponse{Allow: false, Message: "Access denied - more than one policy applicable", AllowedFields: []string{}}
+	default:
+		response = model.PolicyResponse{Allow: false, Message: "Access denied - no policy applicable", AllowedFields: []string{}}
+	}
+	response.Models = models
+
+	log.Printf("[DEBUG] Combined policies for %s with %s: %+v", req.ResourceType, config.Algorithm, trace)
+	explainerFrom(ctx).recordCombination(trace)
+	return response, nil
+}
+
+// decide evaluates the request with one of the configured policies, a registered model or a Rego query
+func (h *PDPHandler) decide(ctx context.Context, name string, req model.EvaluationRequest) (policyDecision, error) {
+	if isQueryPolicy(name) {
+		return h.decideQuery(ctx, name, req)
+	}
+
+	m, ok := h.models.Lookup(name)
+	if !ok {
+		return policyDecision{}, fmt.Errorf("unknown policy model %q for %s", name, req.ResourceType)
+	}
+	response, err := m.Decide(ctx, req)
+	if err != nil {
+		return policyDecision{}, err
+	}
+	d := policyDecision{policy: name, decision: decisionDeny, response: response}
+	if response.Allow {
+		d.decision = decisionPermit
+	}
+	return d, nil
+}
+
+// decideQuery evaluates a Rego query configured as a policy. The query applies unless it is
+// undefined, and is either a boolean or an object with "allow" and optionally "allowed_fields".
+func (h *PDPHandler) decideQuery(ctx context.Context, query string, req model.EvaluationRequest) (policyDecision, error) {
+	prepared, ok := h.policy(ctx).queries[query]
+	if !ok {
+		return policyDecision{}, fmt.Errorf("query %s is not prepared", query)
+	}
+	input, err := h.queryInput(ctx, req)
+	if err != nil {
+		return policyDecision{}, err
+	}
+
+	explain := explainerFrom(ctx)
+	results, err := h.policy(ctx).tracedQuery(prepared, explain).Eval(ctx, explain.evalOptions(input)...)
+	if err != nil {
+		return policyDecision{}, err
+	}
+	d := policyDecision{policy: query, decision: decisionNotApplicable}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return d, nil
+	}
+
+	var allowedFields []string
+	var allowed bool
+	switch value := results[0].Expressions[0].Value.(type) {
+	case bool:
+		allowed = value
+	case map[string]interface{}:
+		allowed, _ = value["allow"].(bool)
+		if raw, ok := value["allowed_fields"].([]interface{}); ok {
+			allowedFields = make([]string, 0, len(raw))
+			for _, field := range raw {
+				if str, ok := field.(string); ok {
+					allowedFields = append(allowedFields, str)
+				}
+			}
+		}
+	default:
+		return policyDecision{}, fmt.Errorf("invalid result of %s: expected boolean or object, got %T", query, value)
+	}
+
+	if !allowed {
+		d.decision = decisionDeny
+		d.response = model.PolicyResponse{Allow: false, Message: fmt.Sprintf("Access denied by %s", query)}
+		return d, nil
+	}
+	d.decision = decisionPermit
+	d.response = model.PolicyResponse{Allow: true, AllowedFields: allowedFields, FilteredData: req.Data}
+	if allowedFields != nil {
+		d.response.FilteredData = filterData(req.Data, req.ResourceType, allowedFields)
+	}
+	return d, nil
+}
+
+// queryInput builds the input of the Rego queries configured as policies: the user with
+// their attributes and relationships, the requested record with its attributes, the action,
+// the environment and the data
+func (h *PDPHandler) queryInput(ctx context.Context, req model.EvaluationRequest) (map[string]interface{}, error) {
+	userAttributes, err := h.userAttributes(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	relationships, err := h.userRelationships(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	resourceAttributes, err := h.resourceAttributes(ctx, req.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	input := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":            req.UserID,
+			"attributes":    userAttributes,
+			"relationships": relationships,
+		},
+		"resource": map[string]interface{}{
+			"type":       req.ResourceType,
+			"id":         req.ResourceID,
+			"attributes": resourceAttributes,
+		},
+		"action": map[string]interface{}{
+			"name": req.Action,
+		},
+		"environment": environmentInput(req.Environment),
+	}
+	if req.Data != nil {
+		input["data"] = req.Data
+	}
+	return input, nil
+}
+
+// combineDecisions combines the decisions of the policies with the algorithm. It returns the
+// combined decision and the decisions it was reached from: the permitting policies of a permit,
+// the first denying policy of a deny and the deciding policy of the applicable algorithms.
+func combineDecisions(algorithm string, decisions []policyDecision) (string, []policyDecision) {
+	var permits, denies []policyDecision
+	for _, d := range decisions {
+		switch d.decision {
+		case decisionPermit:
+			permits = append(permits, d)
+		case decisionDeny:
+			denies = append(denies, d)
+		}
+	}
+
+	switch algorithm {
+	case combineDenyOverrides:
+		if len(denies) > 0 {
+			return decisionDeny, denies[:1]
+		}
+		if len(permits) > 0 {
+			return decisionPermit, permits
+		}
+	case combinePermitOverrides:
+		if len(permits) > 0 {
+			return decisionPermit, permits
+		}
+		if len(denies) > 0 {
+			return decisionDeny, denies[:1]
+		}
+	case combineFirstApplicable:
+		for _, d := range decisions {
+			if d.decision != decisionNotApplicable {
+				return d.decision, []policyDecision{d}
+			}
+		}
+	case combineOnlyOneApplicable:
+		switch applicable := len(permits) + len(denies); {
+		case applicable > 1:
+			return decisionIndeterminate, nil
+		case len(permits) == 1:
+			return decisionPermit, permits
+		case len(denies) == 1:
+			return decisionDeny, denies
+		}
+	}
+	return decisionNotApplicable, nil
+}
+
+// combinePermits builds the response of a permit from the permitting policies. The fields of
+// the policies restricting fields are intersected or united; a policy without field rules has no
+// opinion on fields, so it neither narrows an intersection nor widens a union. Only when no
+// permitting policy restricts fields are all fields allowed.
+func combinePermits(fields string, permits []policyDecision, req model.EvaluationRequest) model.PolicyResponse {
+	var (
+		base    *model.PolicyResponse
+		allowed []string
+	)
+	for i := range permits {
+		response := &permits[i].response
+		if response.AllowedFields == nil {
+			continue
+		}
+		switch {
+		case base == nil:
+			base = response
+			allowed = slices.Clone(response.AllowedFields)
+		case fields == fieldsUnion:
+			for _, field := range response.AllowedFields {
+				if !slices.Contains(allowed, field) {
+					allowed = append(allowed, field)
+				}
+			}
+		default:
+			allowed = slices.DeleteFunc(allowed, func(field string) bool {
+				return !slices.Contains(response.AllowedFields, field)
+			})
+		}
+	}
+
+	var breakGlass *model.BreakGlassGrant
+	for _, d := range permits {
+		if d.response.BreakGlass != nil {
+			breakGlass = d.response.BreakGlass
+			break
+		}
+	}
+
+	if base == nil {
+		return model.PolicyResponse{Allow: true, FilteredData: req.Data, BreakGlass: breakGlass}
+	}
+	if slices.Equal(allowed, base.AllowedFields) && base.BreakGlass == breakGlass {
+		return *base
+	}
+
+	response := *base
+	response.AllowedFields = allowed
+	response.FilteredData = filterData(req.Data, req.ResourceType, allowed)
+	response.BreakGlass = breakGlass
+	response.FieldSources = nil
+	for _, d := range permits {
+		for field, sources := range d.response.FieldSources {
+			if !slices.Contains(allowed, field) {
+				continue
+			}
+			if response.FieldSources == nil {
+				response.FieldSources = make(map[string][]string)
+			}
+			for _, source := range sources {
+				if !slices.Contains(response.FieldSources[field], source) {
+					response.FieldSources[field] = append(response.FieldSources[field], source)
+				}
+			}
+		}
+	}
+	return response
+}
+
+// filterData keeps the allowed fields of the items of the resource type in the data, like
+// filter_data of the RBAC policy. Items without any allowed field are dropped.
+func filterData(data interface{}, resourceType string, allowedFields []string) interface{} {
+	object, ok := data.(map[string]interface{})
+	if !ok || len(allowedFields) == 0 {
+		return nil
+	}
+	items, _ := object[resourceType].([]interface{})
+
+	filtered := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kept := make(map[string]interface{})
+		for _, field := range allowedFields {
+			if value, ok := fields[field]; ok && value != nil {
+				kept[field] = value
+			}
+		}
+		if len(kept) > 0 {
+			filtered = append(filtered, kept)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	return map[string]interface{}{resourceType: filtered}
+}
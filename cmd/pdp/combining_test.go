@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// testContactPolicy permits viewing the contact fields of employees and does not apply to other actions
+const testContactPolicy = `package policy.contact
+
+import future.keywords.if
+
+decision := {"allow": true, "allowed_fields": ["id", "name", "email"]} if {
+    input.action.name == "view"
+}
+`
+
+// newCombiningHandler creates a handler with the contact policy evaluating employees with the configuration
+func newCombiningHandler(t *testing.T, config string) *PDPHandler {
+	t.Helper()
+	dir := copyPolicies(t)
+	if err := os.WriteFile(filepath.Join(dir, "contact.rego"), []byte(testContactPolicy), 0o644); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+	data := `{"config": {"models": {"employees": ` + config + `}}}`
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write policy data: %v", err)
+	}
+	policies, err := LoadPolicySet(dir)
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+	handler, err := newPDPHandler(newModelsMockRepo(), policies)
+	if err != nil {
+		t.Fatalf("newPDPHandler() error = %v", err)
+	}
+	return handler
+}
+
+func TestPDPHandler_evaluate_combining(t *testing.T) {
+	const contact = "data.policy.contact.decision"
+	record := map[string]interface{}{
+		"id": testEmployeeUser, "name": "Bob Engineer", "email": "bob@example.com", "department_name": "Engineering",
+	}
+
+	tests := []struct {
+		name       string
+		config     string
+		action     string
+		wantAllow  bool
+		wantFields []string
+		wantModels map[string]bool
+		wantTrace  []model.PolicyDecision
+		wantResult string
+	}{
+		{
+			name:       "Deny_overrides_intersects_fields",
+			config:     `{"policies": ["rbac", "` + contact + `"]}`,
+			action:     "view",
+			wantAllow:  true,
+			wantFields: []string{"id", "name"},
+			wantModels: map[string]bool{"rbac": true, contact: true},
+			wantResult: decisionPermit,
+		},
+		{
+			name:       "Deny_overrides_unites_fields",
+			config:     `{"policies": ["rbac", "` + contact + `"], "algorithm": "deny-overrides", "fields": "union"}`,
+			action:     "view",
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "department_name", "employment_type", "email"},
+			wantModels: map[string]bool{"rbac": true, contact: true},
+			wantResult: decisionPermit,
+		},
+		{
+			name:       "Permit_overrides_unites_fields",
+			config:     `{"policies": ["rbac", "` + contact + `"], "algorithm": "permit-overrides"}`,
+			action:     "view",
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "department_name", "employment_type", "email"},
+			wantModels: map[string]bool{"rbac": true, contact: true},
+			wantResult: decisionPermit,
+		},
+		{
+			// The contact policy does not apply to editing, so the RBAC denial decides
+			name:       "Permit_overrides_not_applicable",
+			config:     `{"policies": ["rbac", "` + contact + `"], "algorithm": "permit-overrides"}`,
+			action:     "edit",
+			wantAllow:  false,
+			wantModels: map[string]bool{"rbac": false},
+			wantResult: decisionDeny,
+		},
+		{
+			name:       "Permit_overrides_permit_wins",
+			config:     `{"policies": ["abac", "rebac"], "algorithm": "permit-overrides"}`,
+			action:     "view",
+			wantAllow:  true,
+			wantModels: map[string]bool{"abac": true, "rebac": false},
+			wantResult: decisionPermit,
+		},
+		{
+			name:       "First_applicable_skips_the_rest",
+			config:     `{"policies": ["` + contact + `", "rbac"], "algorithm": "first-applicable"}`,
+			action:     "view",
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "email"},
+			wantModels: map[string]bool{contact: true},
+			wantTrace: []model.PolicyDecision{
+				{Policy: contact, Decision: decisionPermit, AllowedFields: []string{"id", "name", "email"}},
+			},
+			wantResult: decisionPermit,
+		},
+		{
+			name:       "First_applicable_falls_through",
+			config:     `{"policies": ["` + contact + `", "rbac"], "algorithm": "first-applicable"}`,
+			action:     "edit",
+			wantAllow:  false,
+			wantModels: map[string]bool{"rbac": false},
+			wantResult: decisionDeny,
+		},
+		{
+			name:       "Only_one_applicable_ambiguous",
+			config:     `{"policies": ["` + contact + `", "rbac"], "algorithm": "only-one-applicable"}`,
+			action:     "view",
+			wantAllow:  false,
+			wantModels: map[string]bool{"rbac": true, contact: true},
+			wantResult: decisionIndeterminate,
+		},
+		{
+			name:       "Only_one_applicable",
+			config:     `{"policies": ["` + contact + `"], "algorithm": "only-one-applicable"}`,
+			action:     "edit",
+			wantAllow:  false,
+			wantModels: map[string]bool{},
+			wantResult: decisionNotApplicable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newCombiningHandler(t, tt.config)
+			explain, err := newExplainer(explainNotes)
+			if err != nil {
+				t.Fatalf("newExplainer() error = %v", err)
+			}
+			ctx := context.WithValue(context.Background(), explainerKey{}, explain)
+
+			response, err := handler.evaluate(ctx, model.EvaluationRequest{
+				UserID:       testEmployeeUser,
+				ResourceType: "employees",
+				ResourceID:   testEmployeeUser,
+				Action:       tt.action,
+				Data:         map[string]interface{}{"employees": []interface{}{record}},
+			})
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+			if response.Allow != tt.wantAllow {
+				t.Errorf("evaluate() allow = %v, want %v (%s)", response.Allow, tt.wantAllow, response.Message)
+			}
+			if tt.wantFields != nil && !sameFields(response.AllowedFields, tt.wantFields) {
+				t.Errorf("evaluate() allowed fields = %v, want %v", response.AllowedFields, tt.wantFields)
+			}
+			if !reflect.DeepEqual(response.Models, tt.wantModels) {
+				t.Errorf("evaluate() models = %v, want %v", response.Models, tt.wantModels)
+			}
+
+			if explain.explanation == nil || explain.explanation.Combination == nil {
+				t.Fatal("explanation has no combination trace")
+			}
+			combination := explain.explanation.Combination
+			if combination.Decision != tt.wantResult {
+				t.Errorf("combination decision = %q, want %q", combination.Decision, tt.wantResult)
+			}
+			if tt.wantTrace != nil && !reflect.DeepEqual(combination.Policies, tt.wantTrace) {
+				t.Errorf("combination policies = %+v, want %+v", combination.Policies, tt.wantTrace)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_evaluate_combiningFilteredData(t *testing.T) {
+	handler := newCombiningHandler(t, `{"policies": ["rbac", "data.policy.contact.decision"]}`)
+	data := map[string]interface{}{"employees": []interface{}{
+		map[string]interface{}{"id": testManagerUser, "name": "John Manager", "email": "john@example.com", "position": "Manager"},
+		map[string]interface{}{"email": "nobody@example.com"},
+	}}
+
+	response, err := handler.evaluate(context.Background(), model.EvaluationRequest{
+		UserID:       testEmployeeUser,
+		ResourceType: "employees",
+		Action:       "view",
+		Data:         data,
+	})
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+
+	// The employee role allows id and name of the contact fields; items without them are dropped
+	want := map[string]interface{}{"employees": []interface{}{
+		map[string]interface{}{"id": testManagerUser, "name": "John Manager"},
+	}}
+	if !reflect.DeepEqual(response.FilteredData, want) {
+		t.Errorf("evaluate() filtered data = %v, want %v", response.FilteredData, want)
+	}
+	for field := range response.FieldSources {
+		if !slices.Contains(response.AllowedFields, field) {
+			t.Errorf("evaluate() field sources include %q, which is not allowed", field)
+		}
+	}
+}
+
+// A model without field rules has no opinion on fields, so it keeps the fields RBAC restricts
+func TestPDPHandler_evaluate_combiningFieldlessPermit(t *testing.T) {
+	managerFields := []string{"id", "name", "email", "department_id", "department_name", "employment_type_id", "employment_type", "position", "joined_at"}
+	record := map[string]interface{}{
+		"id": testEmployeeUser, "name": "Bob Engineer", "email": "bob@example.com", "salary": 5000,
+	}
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "Permit_overrides_union",
+			config: `{"policies": ["rbac", "rebac"], "algorithm": "permit-overrides", "fields": "union"}`,
+		},
+		{
+			name:   "Deny_overrides_union",
+			config: `{"policies": ["rbac", "rebac"], "algorithm": "deny-overrides", "fields": "union"}`,
+		},
+		{
+			name:   "Deny_overrides_intersection",
+			config: `{"policies": ["rbac", "rebac"], "algorithm": "deny-overrides", "fields": "intersection"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newModelsHandler(t, newModelsMockRepo(), tt.config)
+
+			// The manager manages the employee, so ReBAC permits without restricting fields
+			response, err := handler.evaluate(context.Background(), model.EvaluationRequest{
+				UserID:       testManagerUser,
+				ResourceType: "employees",
+				ResourceID:   testEmployeeUser,
+				Action:       "view",
+				Data:         map[string]interface{}{"employees": []interface{}{record}},
+			})
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+			if !response.Allow || !reflect.DeepEqual(response.Models, map[string]bool{"rbac": true, "rebac": true}) {
+				t.Fatalf("evaluate() allow = %v, models = %v, want both models to permit", response.Allow, response.Models)
+			}
+			if !sameFields(response.AllowedFields, managerFields) {
+				t.Errorf("evaluate() allowed fields = %v, want the fields of the manager role", response.AllowedFields)
+			}
+			want := map[string]interface{}{"employees": []interface{}{
+				map[string]interface{}{"id": testEmployeeUser, "name": "Bob Engineer", "email": "bob@example.com"},
+			}}
+			if !reflect.DeepEqual(response.FilteredData, want) {
+				t.Errorf("evaluate() filtered data = %v, want %v", response.FilteredData, want)
+			}
+		})
+	}
+}
+
+func TestPolicyModels_combining(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]interface{}
+		want    *modelConfig
+		wantErr bool
+	}{
+		{
+			name:   "Permit_overrides_defaults_to_union",
+			config: map[string]interface{}{"policies": []interface{}{"rbac", "rebac"}, "algorithm": "permit-overrides"},
+			want:   &modelConfig{Policies: []string{"rbac", "rebac"}, Algorithm: combinePermitOverrides, Fields: fieldsUnion},
+		},
+		{
+			name:   "First_applicable",
+			config: map[string]interface{}{"policies": []interface{}{"rebac", "rbac"}, "algorithm": "first-applicable"},
+			want:   &modelConfig{Policies: []string{"rebac", "rbac"}, Algorithm: combineFirstApplicable},
+		},
+		{
+			name:    "Unknown_algorithm",
+			config:  map[string]interface{}{"policies": []interface{}{"rbac"}, "algorithm": "majority"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown_field_combination",
+			config:  map[string]interface{}{"policies": []interface{}{"rbac"}, "fields": "all"},
+			wantErr: true,
+		},
+		{
+			name:    "Fields_with_first_applicable",
+			config:  map[string]interface{}{"policies": []interface{}{"rbac"}, "algorithm": "first-applicable", "fields": "union"},
+			wantErr: true,
+		},
+		{
+			name:    "No_policies",
+			config:  map[string]interface{}{"algorithm": "deny-overrides"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]interface{}{"config": map[string]interface{}{"models": map[string]interface{}{
+				"employees": tt.config,
+			}}}
+			got, err := policyModels(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("policyModels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got["employees"], tt.want) {
+				t.Errorf("policyModels() = %+v, want %+v", got["employees"], tt.want)
+			}
+		})
+	}
+}
+
+// sameFields reports whether the fields are the same regardless of their order
+func sameFields(got, want []string) bool {
+	got, want = slices.Clone(got), slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	return slices.Equal(got, want)
+}
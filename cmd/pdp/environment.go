@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// defaultTimezone is the timezone of requests whose environment carries no valid one
+const defaultTimezone = "UTC"
+
+// environmentInput builds the environment section of the policy input from the context the PEP
+// observed. Requests without an environment, e.g. from other callers than the PEP, are evaluated
+// at the time the PDP receives them. The time is given in the timezone the PEP is configured with
+// and in nanoseconds since the epoch for the time built-ins of Rego. The timezone the client
+// declared is passed as client_timezone for information only.
+func environmentInput(env *model.Environment) map[string]interface{} {
+	if env == nil {
+		env = &model.Environment{}
+	}
+
+	requestTime := env.RequestTime
+	if requestTime.IsZero() {
+		requestTime = time.Now()
+	}
+	timezone := env.Timezone
+	if timezone == "" {
+		timezone = defaultTimezone
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Printf("[WARN] Unknown timezone %q, evaluating in %s", timezone, defaultTimezone)
+		timezone, location = defaultTimezone, time.UTC
+	}
+
+	input := map[string]interface{}{
+		"time":      requestTime.In(location).Format(time.RFC3339Nano),
+		"time_ns":   requestTime.UnixNano(),
+		"timezone":  timezone,
+		"client_ip": env.ClientIP,
+	}
+	if env.ClientTimezone != "" {
+		input["client_timezone"] = env.ClientTimezone
+	}
+	if env.TLS != nil {
+		input["tls"] = map[string]interface{}{
+			"version":            env.TLS.Version,
+			"cipher_suite":       env.TLS.CipherSuite,
+			"server_name":        env.TLS.ServerName,
+			"client_certificate": env.TLS.ClientCertificate,
+		}
+	}
+	return input
+}
+
+// validateBusinessHours checks the timezone in config.business_hours of the policy data,
+// in which business hours are evaluated instead of the timezone of the request environment
+func validateBusinessHours(data map[string]interface{}) error {
+	config, _ := data["config"].(map[string]interface{})
+	businessHours, _ := config["business_hours"].(map[string]interface{})
+	raw, ok := businessHours["timezone"]
+	if !ok {
+		return nil
+	}
+	timezone, ok := raw.(string)
+	if !ok || timezone == "" || timezone == "Local" {
+		return errors.New("config.business_hours.timezone must be an IANA timezone name")
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("config.business_hours.timezone: %w", err)
+	}
+	return nil
+}
+
+// validateNetworkZones checks the network zones in config.network_zones of the policy data,
+// which map zone names to the CIDRs they consist of
+func validateNetworkZones(data map[string]interface{}) error {
+	config, _ := data["config"].(map[string]interface{})
+	raw, ok := config["network_zones"]
+	if !ok {
+		return nil
+	}
+	zones, ok := raw.(map[string]interface{})
+	if !ok {
+		return errors.New("config.network_zones must map zone names to lists of CIDRs")
+	}
+
+	for zone, value := range zones {
+		cidrs, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("config.network_zones.%s must be a list of CIDRs", zone)
+		}
+		for _, item := range cidrs {
+			cidr, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("config.network_zones.%s must be a list of CIDRs", zone)
+			}
+			if _, err := netip.ParsePrefix(cidr); err != nil {
+				return fmt.Errorf("config.network_zones.%s: %w", zone, err)
+			}
+		}
+	}
+	return nil
+}
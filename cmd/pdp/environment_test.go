@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// testOfficePolicy permits requests from the corporate network during business hours
+const testOfficePolicy = `package policy.office
+
+import data.policy.environment
+import future.keywords.if
+
+default allow := false
+
+allow if {
+    environment.in_zone("corporate")
+    environment.business_hours
+}
+`
+
+func TestEnvironmentInput(t *testing.T) {
+	// Monday 10:00 in Tokyo
+	requestTime := time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		env  *model.Environment
+		want map[string]interface{}
+	}{
+		{
+			name: "From_the_PEP",
+			env: &model.Environment{
+				ClientIP:       "10.1.2.3",
+				RequestTime:    requestTime,
+				Timezone:       "Asia/Tokyo",
+				ClientTimezone: "Europe/Berlin",
+				TLS:            &model.TLSInfo{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256", ClientCertificate: true},
+			},
+			want: map[string]interface{}{
+				"time":            "2026-10-19T10:00:00+09:00",
+				"time_ns":         requestTime.UnixNano(),
+				"timezone":        "Asia/Tokyo",
+				"client_timezone": "Europe/Berlin",
+				"client_ip":       "10.1.2.3",
+				"tls": map[string]interface{}{
+					"version":            "TLS 1.3",
+					"cipher_suite":       "TLS_AES_128_GCM_SHA256",
+					"server_name":        "",
+					"client_certificate": true,
+				},
+			},
+		},
+		{
+			name: "Unknown_timezone",
+			env:  &model.Environment{RequestTime: requestTime, Timezone: "Mars/Olympus"},
+			want: map[string]interface{}{
+				"time":      "2026-10-19T01:00:00Z",
+				"time_ns":   requestTime.UnixNano(),
+				"timezone":  "UTC",
+				"client_ip": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := environmentInput(tt.env); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("environmentInput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Without_environment", func(t *testing.T) {
+		before := time.Now().UnixNano()
+		got := environmentInput(nil)
+		if ns := got["time_ns"].(int64); ns < before || ns > time.Now().UnixNano() {
+			t.Errorf("environmentInput() time_ns = %d, want the time of the evaluation", ns)
+		}
+		if got["timezone"] != "UTC" {
+			t.Errorf("environmentInput() timezone = %v, want UTC", got["timezone"])
+		}
+	})
+}
+
+func TestValidateBusinessHours(t *testing.T) {
+	tests := []struct {
+		name          string
+		businessHours interface{}
+		wantErr       bool
+	}{
+		{name: "Not_configured"},
+		{name: "Without_timezone", businessHours: map[string]interface{}{"start": 9.0, "end": 18.0}},
+		{name: "Valid_timezone", businessHours: map[string]interface{}{"timezone": "Asia/Tokyo"}},
+		{name: "Unknown_timezone", businessHours: map[string]interface{}{"timezone": "Mars/Olympus"}, wantErr: true},
+		{name: "Local_timezone", businessHours: map[string]interface{}{"timezone": "Local"}, wantErr: true},
+		{name: "Not_a_string", businessHours: map[string]interface{}{"timezone": 9.0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{}
+			if tt.businessHours != nil {
+				config["business_hours"] = tt.businessHours
+			}
+			if err := validateBusinessHours(map[string]interface{}{"config": config}); (err != nil) != tt.wantErr {
+				t.Errorf("validateBusinessHours() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNetworkZones(t *testing.T) {
+	tests := []struct {
+		name    string
+		zones   interface{}
+		wantErr bool
+	}{
+		{name: "Valid", zones: map[string]interface{}{"corporate": []interface{}{"10.0.0.0/8", "2001:db8::/32"}}},
+		{name: "Not_an_object", zones: []interface{}{"10.0.0.0/8"}, wantErr: true},
+		{name: "Not_a_list", zones: map[string]interface{}{"corporate": "10.0.0.0/8"}, wantErr: true},
+		{name: "Invalid_CIDR", zones: map[string]interface{}{"corporate": []interface{}{"10.0.0.0/33"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]interface{}{"config": map[string]interface{}{"network_zones": tt.zones}}
+			if err := validateNetworkZones(data); (err != nil) != tt.wantErr {
+				t.Errorf("validateNetworkZones() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_evaluate_environment(t *testing.T) {
+	dir := copyPolicies(t)
+	if err := os.WriteFile(filepath.Join(dir, "office.rego"), []byte(testOfficePolicy), 0o644); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+	data := `{"config": {
+		"models": {"employees": ["rbac", "data.policy.office.allow"]},
+		"network_zones": {"corporate": ["10.0.0.0/8"]}
+	}}`
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write policy data: %v", err)
+	}
+	policies, err := LoadPolicySet(dir)
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+	handler, err := newPDPHandler(newModelsMockRepo(), policies)
+	if err != nil {
+		t.Fatalf("newPDPHandler() error = %v", err)
+	}
+
+	// Monday 10:00 in Tokyo, 01:00 UTC
+	monday := time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		env       *model.Environment
+		wantAllow bool
+	}{
+		{
+			name:      "Corporate_network_in_business_hours",
+			env:       &model.Environment{ClientIP: "10.1.2.3", RequestTime: monday, Timezone: "Asia/Tokyo"},
+			wantAllow: true,
+		},
+		{
+			name:      "Outside_the_corporate_network",
+			env:       &model.Environment{ClientIP: "203.0.113.5", RequestTime: monday, Timezone: "Asia/Tokyo"},
+			wantAllow: false,
+		},
+		{
+			name:      "Outside_business_hours_in_the_request_timezone",
+			env:       &model.Environment{ClientIP: "10.1.2.3", RequestTime: monday, Timezone: "UTC"},
+			wantAllow: false,
+		},
+		{
+			name:      "Without_environment",
+			wantAllow: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := handler.evaluate(context.Background(), model.EvaluationRequest{
+				UserID:       testEmployeeUser,
+				ResourceType: "employees",
+				Action:       "view",
+				Environment:  tt.env,
+			})
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+			if response.Allow != tt.wantAllow {
+				t.Errorf("evaluate() allow = %v, want %v (%s)", response.Allow, tt.wantAllow, response.Message)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_rbacInput_environment(t *testing.T) {
+	handler := NewPDPHandler(newBreakGlassMockRepo())
+	env := &model.Environment{ClientIP: "10.1.2.3", RequestTime: time.Now(), Timezone: "Asia/Tokyo"}
+
+	input, err := handler.rbacInput(context.Background(), model.EvaluationRequest{
+		UserID: testEmployeeUser, ResourceType: "employees", Action: "view", Environment: env,
+	})
+	if err != nil {
+		t.Fatalf("rbacInput() error = %v", err)
+	}
+	if want := environmentInput(env); !reflect.DeepEqual(input["environment"], want) {
+		t.Errorf("rbacInput() environment = %v, want %v", input["environment"], want)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// Evaluation targets of the queries the PDP prepares
+const (
+	// targetRego evaluates queries with the Rego evaluator of OPA
+	targetRego = "rego"
+	// targetWasm compiles queries to Wasm when the policy is loaded and evaluates them with the OPA Wasm runtime
+	targetWasm = "wasm"
+)
+
+// evalTargetFromEnv returns the evaluation target configured by PDP_EVAL_TARGET, Rego by default
+func evalTargetFromEnv() (string, error) {
+	target := os.Getenv("PDP_EVAL_TARGET")
+	if target == "" {
+		return targetRego, nil
+	}
+	if err := validateEvalTarget(target); err != nil {
+		return "", fmt.Errorf("invalid PDP_EVAL_TARGET: %w", err)
+	}
+	return target, nil
+}
+
+// validateEvalTarget checks that the target is known and built into the PDP
+func validateEvalTarget(target string) error {
+	switch target {
+	case targetRego:
+		return nil
+	case targetWasm:
+		if !wasmAvailable {
+			return errors.New("the PDP was built without the Wasm runtime, build it with -tags opa_wasm")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown evaluation target %q, want %q or %q", target, targetRego, targetWasm)
+	}
+}
+
+// SetEvalTarget sets the target the PDP evaluates its queries on and prepares the active policy
+// for it. The previous target is kept if the active policy cannot be prepared for the new one.
+func (h *PDPHandler) SetEvalTarget(target string) error {
+	if err := validateEvalTarget(target); err != nil {
+		return err
+	}
+	previous := h.target
+	h.target = target
+	if err := h.swapPolicies(h.active.Load().policies); err != nil {
+		h.target = previous
+		return err
+	}
+	return nil
+}
+
+// tracedQuery returns the query to evaluate for the request. Explained requests are evaluated
+// with the Rego counterpart of queries compiled to Wasm, since the Wasm runtime does not trace.
+func (p *activePolicy) tracedQuery(query *rego.PreparedEvalQuery, explain *explainer) *rego.PreparedEvalQuery {
+	if traced, ok := p.traced[query]; ok && explain != nil {
+		return traced
+	}
+	return query
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestEvalTargetFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{name: "Default", want: targetRego},
+		{name: "Rego", target: "rego", want: targetRego},
+		{name: "Wasm", target: "wasm", want: targetWasm, wantErr: !wasmAvailable},
+		{name: "Unknown", target: "jit", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PDP_EVAL_TARGET", tt.target)
+			got, err := evalTargetFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evalTargetFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("evalTargetFromEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_SetEvalTarget(t *testing.T) {
+	handler := NewPDPHandler(newBreakGlassMockRepo())
+	active := handler.active.Load()
+
+	if err := handler.SetEvalTarget("jit"); err == nil {
+		t.Fatal("SetEvalTarget() error = nil, want an error for an unknown target")
+	}
+	if handler.target != targetRego || handler.active.Load() != active {
+		t.Errorf("SetEvalTarget() changed the target to %q after an error", handler.target)
+	}
+
+	if err := handler.SetEvalTarget(targetWasm); (err != nil) == wasmAvailable {
+		t.Fatalf("SetEvalTarget(%q) error = %v, Wasm available %v", targetWasm, err, wasmAvailable)
+	}
+	want := targetRego
+	if wasmAvailable {
+		want = targetWasm
+	}
+	if got := handler.active.Load().target; got != want {
+		t.Errorf("active policy target = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/topdown/lineage"
+)
+
+// Explain modes accepted in the explain query parameter of POST /evaluation
+const (
+	// explainFull returns every trace event of the RBAC evaluation
+	explainFull = "full"
+	// explainNotes returns only the notes the policy emits with trace()
+	explainNotes = "notes"
+)
+
+// explainer collects the explanation of an evaluation. It travels in the request context
+// so that only the evaluations of an explain request are traced.
+type explainer struct {
+	mode        string
+	tracer      *topdown.BufferTracer
+	explanation *model.Explanation
+}
+
+type explainerKey struct{}
+
+// newExplainer creates an explainer for the explain mode
+func newExplainer(mode string) (*explainer, error) {
+	if mode != explainFull && mode != explainNotes {
+		return nil, fmt.Errorf("invalid explain mode %q, want %q or %q", mode, explainFull, explainNotes)
+	}
+	return &explainer{mode: mode, tracer: topdown.NewBufferTracer()}, nil
+}
+
+// explainerFrom returns the explainer of the request, or nil if the request is not explained
+func explainerFrom(ctx context.Context) *explainer {
+	e, _ := ctx.Value(explainerKey{}).(*explainer)
+	return e
+}
+
+// evalOptions returns the options tracing the evaluation of the decision
+func (e *explainer) evalOptions(input map[string]interface{}) []rego.EvalOption {
+	options := []rego.EvalOption{rego.EvalInput(input)}
+	if e != nil {
+		options = append(options, rego.EvalQueryTracer(e.tracer))
+	}
+	return options
+}
+
+// record evaluates the explanation query for the input and keeps it with the trace of the decision
+func (e *explainer) record(ctx context.Context, query *rego.PreparedEvalQuery, input map[string]interface{}) error {
+	if e == nil {
+		return nil
+	}
+
+	results, err := query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return fmt.Errorf("explanation evaluation error: %w", err)
+	}
+
+	var raw struct {
+		MatchedRoles  []string `json:"matched_roles"`
+		CombinedRoles []string `json:"combined_roles"`
+		Permissions   []struct {
+			RoleID     string `json:"role_id"`
+			ResourceID string `json:"resource_id"`
+			ActionID   string `json:"action_id"`
+		} `json:"permissions"`
+		FieldSources map[string][]string `json:"field_sources"`
+	}
+	if len(results) > 0 {
+		b, err := json.Marshal(results[0].Expressions[0].Value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal explanation: %w", err)
+		}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("failed to parse explanation: %w", err)
+		}
+	}
+
+	permissions := make([]model.RBACPermission, len(raw.Permissions))
+	for i, perm := range raw.Permissions {
+		permissions[i] = model.RBACPermission{
+			Role:       perm.RoleID,
+			ResourceID: perm.ResourceID,
+			Action:     perm.ActionID,
+		}
+	}
+
+	e.explanation = &model.Explanation{
+		Mode:          e.mode,
+		MatchedRoles:  nonNil(raw.MatchedRoles),
+		CombinedRoles: nonNil(raw.CombinedRoles),
+		Permissions:   permissions,
+		FieldSources:  raw.FieldSources,
+		Trace:         e.trace(),
+	}
+	return nil
+}
+
+// recordCombination keeps how the decisions of the policies of the resource type were combined.
+// The trace is renewed to include every policy evaluated.
+func (e *explainer) recordCombination(combination *model.CombinationTrace) {
+	if e == nil {
+		return
+	}
+	if e.explanation == nil {
+		e.explanation = &model.Explanation{
+			Mode:          e.mode,
+			MatchedRoles:  []string{},
+			CombinedRoles: []string{},
+			Permissions:   []model.RBACPermission{},
+		}
+	}
+	e.explanation.Trace = e.trace()
+	e.explanation.Combination = combination
+}
+
+// trace returns the lines of the trace of the evaluations so far
+func (e *explainer) trace() []string {
+	events := []*topdown.Event(*e.tracer)
+	if e.mode == explainNotes {
+		events = lineage.Notes(events)
+	}
+	var trace bytes.Buffer
+	topdown.PrettyTraceWithLocation(&trace, events)
+	return nonNil(splitLines(trace.String()))
+}
+
+// nonNil returns an empty slice instead of nil so that it is encoded as an empty JSON array
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+func TestPDPHandler_HandleEvaluation_explain(t *testing.T) {
+	request := model.EvaluationRequest{
+		UserID:       testEmployeeUser,
+		ResourceType: "employees",
+		Action:       "view",
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		caller     string
+		wantStatus int
+		wantTrace  string
+	}{
+		{
+			name:       "Notes",
+			mode:       explainNotes,
+			caller:     testAdminUser,
+			wantStatus: http.StatusOK,
+			wantTrace:  "Allowed fields:",
+		},
+		{
+			name:       "Full_trace",
+			mode:       explainFull,
+			caller:     testAdminUser,
+			wantStatus: http.StatusOK,
+			wantTrace:  "Enter data.policy.rbac.result",
+		},
+		{
+			name:       "Not_admin",
+			mode:       explainNotes,
+			caller:     testManagerUser,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Missing_caller",
+			mode:       explainNotes,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Invalid_mode",
+			mode:       "verbose",
+			caller:     testAdminUser,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(newBreakGlassMockRepo())
+			handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+
+			req := adminRequest(http.MethodPost, "/evaluation?explain="+tt.mode, request)
+			setCallerToken(req, tt.caller)
+			rec := httptest.NewRecorder()
+			handler.HandleEvaluation(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("HandleEvaluation() status = %v, want %v, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response model.PolicyResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			explanation := response.Explanation
+			if explanation == nil {
+				t.Fatalf("HandleEvaluation() explanation = nil, want an explanation")
+			}
+			if explanation.Mode != tt.mode {
+				t.Errorf("explanation mode = %q, want %q", explanation.Mode, tt.mode)
+			}
+			if !reflect.DeepEqual(explanation.MatchedRoles, []string{testEmployeeRole}) ||
+				!reflect.DeepEqual(explanation.CombinedRoles, []string{testEmployeeRole}) {
+				t.Errorf("explanation roles = %v, %v, want the employee role", explanation.MatchedRoles, explanation.CombinedRoles)
+			}
+			wantPermissions := []model.RBACPermission{{Role: testEmployeeRole, ResourceID: testEmployeesRes, Action: "view"}}
+			if !reflect.DeepEqual(explanation.Permissions, wantPermissions) {
+				t.Errorf("explanation permissions = %+v, want %+v", explanation.Permissions, wantPermissions)
+			}
+			if got := explanation.FieldSources["email"]; got != nil {
+				t.Errorf("explanation field sources of email = %v, want none", got)
+			}
+			if got := explanation.FieldSources["name"]; !reflect.DeepEqual(got, []string{testEmployeeRole}) {
+				t.Errorf("explanation field sources of name = %v, want the employee role", got)
+			}
+			if !strings.Contains(strings.Join(explanation.Trace, "\n"), tt.wantTrace) {
+				t.Errorf("explanation trace does not contain %q:\n%s", tt.wantTrace, strings.Join(explanation.Trace, "\n"))
+			}
+		})
+	}
+}
+
+func TestPDPHandler_HandleEvaluation_withoutExplain(t *testing.T) {
+	handler := NewPDPHandler(newBreakGlassMockRepo())
+
+	rec := httptest.NewRecorder()
+	handler.HandleEvaluation(rec, adminRequest(http.MethodPost, "/evaluation", model.EvaluationRequest{
+		UserID:       testEmployeeUser,
+		ResourceType: "employees",
+		Action:       "view",
+	}))
+
+	var response model.PolicyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !response.Allow || response.Explanation != nil {
+		t.Errorf("HandleEvaluation() = %+v, want an allowed decision without explanation", response)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// recordRef is the unknown the row policy is partially evaluated for
+const recordRef = "input.record"
+
+// errMissingColumn is returned when the row filter refers to a field the caller mapped no column for
+var errMissingColumn = errors.New("no column for field")
+
+// errInvalidColumn is returned when a field is mapped to something other than a column name
+var errInvalidColumn = errors.New("invalid column")
+
+// columnPattern matches a lower-case column name, optionally qualified by a table name or alias.
+// Columns are written into the SQL as they are, so nothing else may be mapped.
+var columnPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// filterOperators maps the comparisons a residual query may contain onto filter operators
+var filterOperators = map[string]string{
+	"eq":    model.FilterEq,
+	"equal": model.FilterEq,
+	"neq":   model.FilterNeq,
+	"lt":    model.FilterLt,
+	"lte":   model.FilterLte,
+	"gt":    model.FilterGt,
+	"gte":   model.FilterGte,
+}
+
+// sqlOperators are the SQL operators of the filter comparisons
+var sqlOperators = map[string]string{
+	model.FilterEq:  "=",
+	model.FilterNeq: "<>",
+	model.FilterLt:  "<",
+	model.FilterLte: "<=",
+	model.FilterGt:  ">",
+	model.FilterGte: ">=",
+}
+
+// flippedOperators are the comparisons with their operands swapped
+var flippedOperators = map[string]string{
+	model.FilterEq:  model.FilterEq,
+	model.FilterNeq: model.FilterNeq,
+	model.FilterLt:  model.FilterGt,
+	model.FilterLte: model.FilterGte,
+	model.FilterGt:  model.FilterLt,
+	model.FilterGte: model.FilterLte,
+}
+
+// HandleRowFilter compiles the row policy for a subject into a row filter, so that
+// services only read the rows the subject may see instead of filtering every row afterwards
+func (h *PDPHandler) HandleRowFilter(w http.ResponseWriter, r *http.Request) {
+	var req model.RowFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] Error decoding row filter request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" || req.ResourceType == "" || req.Action == "" {
+		http.Error(w, "user_id, resource_type and action are required", http.StatusBadRequest)
+		return
+	}
+	if req.ActAs != "" {
+		http.Error(w, "act_as is not supported for row filters", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), activePolicyKey{}, h.active.Load())
+	filter, err := h.rowFilter(ctx, req)
+	if errors.Is(err, errMissingColumn) || errors.Is(err, errInvalidColumn) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Row filter error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Row Filter: user=%s, resourceType=%s, action=%s, sql=%q, args=%v, policyRevision=%s",
+		req.UserID, req.ResourceType, req.Action, filter.SQL, filter.Args, filter.PolicyRevision)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filter)
+}
+
+// rowFilter partially evaluates the row policy with the record unknown and
+// translates the residual queries into a row filter
+func (h *PDPHandler) rowFilter(ctx context.Context, req model.RowFilterRequest) (*model.RowFilter, error) {
+	input, err := h.rbacInput(ctx, req.EvaluationRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	partial, err := h.policy(ctx).opaRows.Partial(ctx, rego.EvalInput(input), rego.EvalUnknowns([]string{recordRef}))
+	if err != nil {
+		return nil, fmt.Errorf("partial evaluation error: %w", err)
+	}
+	if len(partial.Support) > 0 {
+		return nil, fmt.Errorf("row policy needs %d support modules, which cannot be translated", len(partial.Support))
+	}
+
+	filter, err := filterFromQueries(partial.Queries)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []interface{}
+	sql, err := filterSQL(filter, req.Columns, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.RowFilter{
+		SQL:            sql,
+		Args:           nonNilArgs(args),
+		Filter:         filter,
+		PolicyRevision: h.policy(ctx).policies.Revision,
+	}, nil
+}
+
+// filterFromQueries translates residual queries, which are alternatives of conjunctions, into a filter.
+// Without queries no row may be read; an empty query lets every row be read.
+func filterFromQueries(queries []ast.Body) (model.FilterNode, error) {
+	alternatives := make([]model.FilterNode, 0, len(queries))
+	for _, query := range queries {
+		if len(query) == 0 {
+			return model.FilterNode{Op: model.FilterTrue}, nil
+		}
+
+		conditions := make([]model.FilterNode, 0, len(query))
+		for _, expr := range query {
+			condition, err := filterFromExpr(expr)
+			if err != nil {
+				return model.FilterNode{}, err
+			}
+			conditions = append(conditions, condition)
+		}
+		alternatives = append(alternatives, combineFilters(model.FilterAnd, conditions))
+	}
+
+	if len(alternatives) == 0 {
+		return model.FilterNode{Op: model.FilterFalse}, nil
+	}
+	return combineFilters(model.FilterOr, alternatives), nil
+}
+
+// combineFilters combines filters with a logical operator, leaving a single filter as it is
+func combineFilters(op string, filters []model.FilterNode) model.FilterNode {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return model.FilterNode{Op: op, Args: filters}
+}
+
+// filterFromExpr translates a comparison of a record field with a value
+func filterFromExpr(expr *ast.Expr) (model.FilterNode, error) {
+	if !expr.IsCall() || len(expr.Operands()) != 2 {
+		return model.FilterNode{}, fmt.Errorf("unsupported row policy expression %s", expr)
+	}
+	op, ok := filterOperators[expr.Operator().String()]
+	if !ok {
+		return model.FilterNode{}, fmt.Errorf("unsupported row policy operator in %s", expr)
+	}
+
+	left, right := expr.Operands()[0], expr.Operands()[1]
+	if _, ok := recordField(left); !ok {
+		left, right = right, left
+		op = flippedOperators[op]
+	}
+	field, ok := recordField(left)
+	if !ok {
+		return model.FilterNode{}, fmt.Errorf("row policy expression %s does not compare a record field", expr)
+	}
+	if _, isRef := right.Value.(ast.Ref); isRef {
+		return model.FilterNode{}, fmt.Errorf("row policy expression %s compares two references", expr)
+	}
+	value, err := ast.JSON(right.Value)
+	if err != nil {
+		return model.FilterNode{}, fmt.Errorf("row policy expression %s does not compare with a value: %w", expr, err)
+	}
+
+	condition := model.FilterNode{Op: op, Field: field, Value: value}
+	if expr.Negated {
+		condition = model.FilterNode{Op: model.FilterNot, Args: []model.FilterNode{condition}}
+	}
+	return condition, nil
+}
+
+// recordField returns the name of the record field the term refers to
+func recordField(term *ast.Term) (string, bool) {
+	ref, ok := term.Value.(ast.Ref)
+	if !ok || len(ref) != 3 || !ref.HasPrefix(ast.MustParseRef(recordRef)) {
+		return "", false
+	}
+	field, ok := ref[2].Value.(ast.String)
+	return string(field), ok
+}
+
+// filterSQL translates the filter into a SQL predicate on the columns, appending its parameters to args
+func filterSQL(filter model.FilterNode, columns map[string]string, args *[]interface{}) (string, error) {
+	switch filter.Op {
+	case model.FilterTrue:
+		return "TRUE", nil
+	case model.FilterFalse:
+		return "FALSE", nil
+	case model.FilterAnd, model.FilterOr:
+		parts := make([]string, len(filter.Args))
+		for i, arg := range filter.Args {
+			part, err := filterSQL(arg, columns, args)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = "(" + part + ")"
+		}
+		return strings.Join(parts, " "+strings.ToUpper(filter.Op)+" "), nil
+	case model.FilterNot:
+		part, err := filterSQL(filter.Args[0], columns, args)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + part + ")", nil
+	}
+
+	operator, ok := sqlOperators[filter.Op]
+	if !ok {
+		return "", fmt.Errorf("unsupported filter operator %q", filter.Op)
+	}
+	column, ok := columns[filter.Field]
+	if !ok {
+		return "", fmt.Errorf("%w %s", errMissingColumn, filter.Field)
+	}
+	if !columnPattern.MatchString(column) {
+		return "", fmt.Errorf("%w %q for field %s", errInvalidColumn, column, filter.Field)
+	}
+	*args = append(*args, filter.Value)
+	return fmt.Sprintf("%s %s $%d", column, operator, len(*args)), nil
+}
+
+// nonNilArgs returns an empty slice instead of nil so that it is encoded as an empty JSON array
+func nonNilArgs(args []interface{}) []interface{} {
+	if args == nil {
+		return []interface{}{}
+	}
+	return args
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/open-policy-agent/opa/ast"
+)
+
+func TestPDPHandler_HandleRowFilter(t *testing.T) {
+	columns := map[string]string{"id": "e.id", "department_id": "e.department_id"}
+
+	tests := []struct {
+		name       string
+		request    model.RowFilterRequest
+		wantStatus int
+		wantSQL    string
+		wantArgs   []interface{}
+		wantFilter model.FilterNode
+	}{
+		{
+			name: "Manager_reads_every_row",
+			request: model.RowFilterRequest{
+				EvaluationRequest: model.EvaluationRequest{UserID: testManagerUser, ResourceType: "employees", Action: "view"},
+				Columns:           columns,
+			},
+			wantStatus: http.StatusOK,
+			wantSQL:    "TRUE",
+			wantArgs:   []interface{}{},
+			wantFilter: model.FilterNode{Op: model.FilterTrue},
+		},
+		{
+			name: "Employee_reads_own_row",
+			request: model.RowFilterRequest{
+				EvaluationRequest: model.EvaluationRequest{UserID: testEmployeeUser, ResourceType: "employees", Action: "view"},
+				Columns:           columns,
+			},
+			wantStatus: http.StatusOK,
+			wantSQL:    "e.id = $1",
+			wantArgs:   []interface{}{testEmployeeUser},
+			wantFilter: model.FilterNode{Op: model.FilterEq, Field: "id", Value: testEmployeeUser},
+		},
+		{
+			name: "No_access",
+			request: model.RowFilterRequest{
+				EvaluationRequest: model.EvaluationRequest{UserID: testAdminUser, ResourceType: "employees", Action: "view"},
+				Columns:           columns,
+			},
+			wantStatus: http.StatusOK,
+			wantSQL:    "FALSE",
+			wantArgs:   []interface{}{},
+			wantFilter: model.FilterNode{Op: model.FilterFalse},
+		},
+		{
+			name: "Missing_column",
+			request: model.RowFilterRequest{
+				EvaluationRequest: model.EvaluationRequest{UserID: testEmployeeUser, ResourceType: "employees", Action: "view"},
+				Columns:           map[string]string{"department_id": "e.department_id"},
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Invalid_column",
+			request: model.RowFilterRequest{
+				EvaluationRequest: model.EvaluationRequest{UserID: testEmployeeUser, ResourceType: "employees", Action: "view"},
+				Columns:           map[string]string{"id": "e.id OR TRUE --"},
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Impersonation",
+			request: model.RowFilterRequest{
+				EvaluationRequest: model.EvaluationRequest{UserID: testManagerUser, ResourceType: "employees", Action: "view", ActAs: testEmployeeUser},
+				Columns:           columns,
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(newBreakGlassMockRepo())
+
+			body, _ := json.Marshal(tt.request)
+			rec := httptest.NewRecorder()
+			handler.HandleRowFilter(rec, httptest.NewRequest(http.MethodPost, "/filters", bytes.NewReader(body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("HandleRowFilter() status = %v, want %v, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var filter model.RowFilter
+			if err := json.NewDecoder(rec.Body).Decode(&filter); err != nil {
+				t.Fatalf("Failed to decode filter: %v", err)
+			}
+			if filter.SQL != tt.wantSQL || !reflect.DeepEqual(filter.Args, tt.wantArgs) {
+				t.Errorf("HandleRowFilter() sql = %q, args = %v, want %q, %v", filter.SQL, filter.Args, tt.wantSQL, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(filter.Filter, tt.wantFilter) {
+				t.Errorf("HandleRowFilter() filter = %+v, want %+v", filter.Filter, tt.wantFilter)
+			}
+		})
+	}
+}
+
+func TestFilterFromQueries(t *testing.T) {
+	columns := map[string]string{"id": "e.id", "department_id": "e.department_id", "level": "e.level"}
+
+	tests := []struct {
+		name     string
+		queries  []string
+		wantSQL  string
+		wantArgs []interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "Alternatives_of_conjunctions",
+			queries:  []string{`input.record.department_id = "d1"; 3 < input.record.level`, `"u1" = input.record.id`},
+			wantSQL:  "((e.department_id = $1) AND (e.level > $2)) OR (e.id = $3)",
+			wantArgs: []interface{}{"d1", json.Number("3"), "u1"},
+		},
+		{
+			name:     "Negation",
+			queries:  []string{`not input.record.department_id = "d1"`},
+			wantSQL:  "NOT (e.department_id = $1)",
+			wantArgs: []interface{}{"d1"},
+		},
+		{
+			name:    "Two_references",
+			queries: []string{`input.record.id = input.record.department_id`},
+			wantErr: true,
+		},
+		{
+			name:    "Unsupported_operator",
+			queries: []string{`startswith(input.record.id, "u")`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := make([]ast.Body, len(tt.queries))
+			for i, query := range tt.queries {
+				queries[i] = ast.MustParseBody(query)
+			}
+
+			filter, err := filterFromQueries(queries)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("filterFromQueries() = %+v, want error", filter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("filterFromQueries() error = %v", err)
+			}
+
+			var args []interface{}
+			sql, err := filterSQL(filter, columns, &args)
+			if err != nil {
+				t.Fatalf("filterSQL() error = %v", err)
+			}
+			if sql != tt.wantSQL || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("filterSQL() = %q, %v, want %q, %v", sql, args, tt.wantSQL, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// impersonationResourceType is the resource the impersonate permission is granted on
+const impersonationResourceType = "users"
+
+// evaluate evaluates a request with the policy models of its resource type, acting as the
+// target user when the request impersonates someone.
+// The whole evaluation uses the policy active when it started, or the policy of its batch,
+// and the PRP snapshot current when it started if the snapshot is fresh.
+func (h *PDPHandler) evaluate(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error) {
+	active := h.policy(ctx)
+	ctx = context.WithValue(ctx, activePolicyKey{}, active)
+	ctx, snapshotVersion := h.snapshotContext(ctx)
+
+	var (
+		response model.PolicyResponse
+		err      error
+	)
+	if req.ActAs == "" {
+		response, err = h.evaluateModels(ctx, req)
+	} else {
+		response, err = h.evaluateImpersonation(ctx, req)
+	}
+	if err != nil {
+		return model.PolicyResponse{}, err
+	}
+
+	response.PolicyRevision = active.policies.Revision
+	response.SnapshotVersion = snapshotVersion
+	return response, nil
+}
+
+// evaluateImpersonation checks that the operator may impersonate the target user
+// and then evaluates the request itself as the target user
+func (h *PDPHandler) evaluateImpersonation(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error) {
+	impersonation := &model.Impersonation{
+		OperatorID: req.UserID,
+		TargetID:   req.ActAs,
+	}
+
+	allowed, err := h.mayImpersonate(ctx, impersonation)
+	if err != nil {
+		return model.PolicyResponse{}, err
+	}
+	if !allowed {
+		log.Printf("[AUDIT] Impersonation denied: operator=%s, target=%s, resourceType=%s, action=%s",
+			impersonation.OperatorID, impersonation.TargetID, req.ResourceType, req.Action)
+		return model.PolicyResponse{
+			Allow:         false,
+			Message:       "Access denied - impersonation not permitted",
+			Impersonation: impersonation,
+		}, nil
+	}
+
+	targetReq := req
+	targetReq.UserID = req.ActAs
+	targetReq.ActAs = ""
+
+	response, err := h.evaluateModels(ctx, targetReq)
+	if err != nil {
+		return model.PolicyResponse{}, err
+	}
+	response.Impersonation = impersonation
+
+	log.Printf("[AUDIT] Impersonated decision: operator=%s, target=%s, resourceType=%s, resourceID=%s, action=%s, allow=%v, allowedFields=%v",
+		impersonation.OperatorID, impersonation.TargetID, req.ResourceType, req.ResourceID, req.Action,
+		response.Allow, response.AllowedFields)
+
+	return response, nil
+}
+
+// mayImpersonate evaluates the impersonation policy for the operator and the target
+func (h *PDPHandler) mayImpersonate(ctx context.Context, impersonation *model.Impersonation) (bool, error) {
+	// Both subjects' roles come from the same source as those of the decision
+	_, operator, err := h.grantsForUser(ctx, impersonation.OperatorID)
+	if err != nil {
+		return false, err
+	}
+
+	// The target's permissions tell the policy whether the target is privileged
+	_, target, err := h.grantsForUser(ctx, impersonation.TargetID)
+	if err != nil {
+		return false, err
+	}
+
+	resourceID, err := h.repository(ctx).GetResourceIDByType(ctx, impersonationResourceType)
+	if err != nil {
+		return false, err
+	}
+
+	input := map[string]interface{}{
+		"operator": map[string]interface{}{
+			"id": impersonation.OperatorID,
+		},
+		"target": map[string]interface{}{
+			"id":               impersonation.TargetID,
+			"role_permissions": rolePermissionsInput(target.permissions),
+		},
+		"resource": map[string]interface{}{
+			"id":   resourceID,
+			"name": impersonationResourceType,
+		},
+		"role_permissions": rolePermissionsInput(operator.permissions),
+	}
+
+	return evalAllow(ctx, h.policy(ctx).opaImpersonation, input)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+func TestPDPHandler_evaluateImpersonation(t *testing.T) {
+	const (
+		supportUser  = "88888888-8888-8888-8888-888888888888"
+		employeeUser = "44444444-4444-4444-4444-444444444444"
+		adminUser    = "99999999-9999-9999-9999-999999999999"
+		supportRole  = "33333333-3333-3333-3333-333333333333"
+		employeeRole = "22222222-2222-2222-2222-222222222222"
+		adminRole    = "44444444-4444-4444-4444-444444444444"
+		employeesRes = "11111111-1111-1111-1111-111111111111"
+		usersRes     = "33333333-3333-3333-3333-333333333333"
+		adminRes     = "44444444-4444-4444-4444-444444444444"
+	)
+
+	mockRepo := &mocks.MockRepository{
+		GetFieldPermissionsFunc: getTestFieldPermissions,
+		GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+			switch userID {
+			case supportUser:
+				return []string{supportRole}, []model.RBACPermission{
+					{Role: supportRole, ResourceID: usersRes, Action: "impersonate"},
+				}, nil
+			case employeeUser:
+				return []string{employeeRole}, []model.RBACPermission{
+					{Role: employeeRole, ResourceID: employeesRes, Action: "view"},
+				}, nil
+			case adminUser:
+				return []string{adminRole}, []model.RBACPermission{
+					{Role: adminRole, ResourceID: adminRes, Action: "manage"},
+				}, nil
+			}
+			return nil, nil, nil
+		},
+		GetResourceIDByTypeFunc: getTestResourceID,
+	}
+
+	tests := []struct {
+		name       string
+		request    model.EvaluationRequest
+		wantAllow  bool
+		wantFields []string
+	}{
+		{
+			name: "Support_acts_as_employee",
+			request: model.EvaluationRequest{
+				UserID:       supportUser,
+				ResourceType: "employees",
+				ResourceID:   employeesRes,
+				Action:       "view",
+				ActAs:        employeeUser,
+			},
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "department_name", "employment_type"},
+		},
+		{
+			name: "Employee_cannot_impersonate",
+			request: model.EvaluationRequest{
+				UserID:       employeeUser,
+				ResourceType: "employees",
+				ResourceID:   employeesRes,
+				Action:       "view",
+				ActAs:        supportUser,
+			},
+			wantAllow: false,
+		},
+		{
+			// Acting as an administrator would escalate the operator's privileges
+			name: "Support_cannot_act_as_admin",
+			request: model.EvaluationRequest{
+				UserID:       supportUser,
+				ResourceType: "admin",
+				ResourceID:   adminRes,
+				Action:       "manage",
+				ActAs:        adminUser,
+			},
+			wantAllow: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(mockRepo)
+			got, err := handler.evaluate(context.Background(), tt.request)
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+
+			if got.Allow != tt.wantAllow {
+				t.Errorf("evaluate() allow = %v, want %v", got.Allow, tt.wantAllow)
+			}
+			if got.Impersonation == nil {
+				t.Fatalf("evaluate() impersonation = nil, want the decision to be flagged")
+			}
+			if got.Impersonation.OperatorID != tt.request.UserID || got.Impersonation.TargetID != tt.request.ActAs {
+				t.Errorf("evaluate() impersonation = %+v, want operator %s and target %s",
+					got.Impersonation, tt.request.UserID, tt.request.ActAs)
+			}
+			if len(got.AllowedFields) != len(tt.wantFields) {
+				t.Errorf("evaluate() allowed fields = %v, want %v", got.AllowedFields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_evaluateImpersonation_pip(t *testing.T) {
+	const (
+		supportUser = "88888888-8888-8888-8888-888888888888"
+		usersRes    = "33333333-3333-3333-3333-333333333333"
+	)
+
+	repo := newBreakGlassMockRepo()
+	rolePermissions := map[string][]model.RBACPermission{
+		testSupportRole: {{Role: testSupportRole, ResourceID: usersRes, Action: "impersonate"}},
+	}
+	for role, permissions := range testRolePermissions {
+		rolePermissions[role] = permissions
+	}
+	repo.GetPermissionsForRolesFunc = func(ctx context.Context, roleIDs []string) ([]model.RBACPermission, error) {
+		var permissions []model.RBACPermission
+		for _, role := range roleIDs {
+			permissions = append(permissions, rolePermissions[role]...)
+		}
+		return permissions, nil
+	}
+
+	tests := []struct {
+		name      string
+		userRoles map[string][]string
+		wantAllow bool
+	}{
+		{
+			name:      "Target_unprivileged_in_PIP",
+			userRoles: map[string][]string{supportUser: {testSupportRole}, testEmployeeUser: {testEmployeeRole}},
+			wantAllow: true,
+		},
+		{
+			// The PRP assigns the target only the employee role, but the PIP makes them an administrator
+			name:      "Target_privileged_in_PIP",
+			userRoles: map[string][]string{supportUser: {testSupportRole}, testEmployeeUser: {testAdminRole}},
+			wantAllow: false,
+		},
+		{
+			// The PIP does not grant the operator the support role
+			name:      "Operator_without_role_in_PIP",
+			userRoles: map[string][]string{testEmployeeUser: {testEmployeeRole}},
+			wantAllow: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(repo)
+			handler.SetPolicyInformationProvider(pkg.NewPIPClient(newRolesPIP(t, tt.userRoles).URL, time.Second))
+
+			impersonation := &model.Impersonation{OperatorID: supportUser, TargetID: testEmployeeUser}
+			allowed, err := handler.mayImpersonate(context.Background(), impersonation)
+			if err != nil {
+				t.Fatalf("mayImpersonate() error = %v", err)
+			}
+			if allowed != tt.wantAllow {
+				t.Errorf("mayImpersonate() = %v, want %v", allowed, tt.wantAllow)
+			}
+		})
+	}
+}
@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/open-policy-agent/opa/rego"
@@ -49,6 +52,74 @@ func main() {
 	// Initialize PDP handler
 	pdpHandler := NewPDPHandler(repo)
 
+	// Optionally evaluate a candidate policy in shadow mode
+	if candidatePath := os.Getenv("PDP_SHADOW_POLICY"); candidatePath != "" {
+		shadow, closeDiffLog, err := newShadowEvaluatorFromEnv(candidatePath)
+		if err != nil {
+			log.Fatalf("[ERROR] Failed to initialize shadow evaluation: %v", err)
+		}
+		defer closeDiffLog()
+		go shadow.Run(context.Background())
+		pdpHandler.SetShadowEvaluator(shadow)
+		log.Printf("[INFO] Shadow evaluation enabled with candidate policy %s", candidatePath)
+	}
+
+	// Optionally evaluate decisions from an in-memory snapshot of the PRP
+	if os.Getenv("PDP_PRP_SNAPSHOT") == "true" {
+		maxStaleness, err := snapshotMaxStalenessFromEnv()
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		listener := repository.NewChangeListener(dbConfig.ConnString())
+		defer listener.Close(context.Background())
+		snapshot := NewPRPSnapshot(repo, listener, maxStaleness)
+		go snapshot.Run(context.Background())
+		pdpHandler.SetPRPSnapshot(snapshot)
+		log.Printf("[INFO] PRP snapshot enabled, reading the PRP directly when not in sync for %s", maxStaleness)
+	}
+
+	// Optionally source subject information from the PIP
+	pip, err := pipFromEnv()
+	if err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+	if pip != nil {
+		pdpHandler.SetPolicyInformationProvider(pip)
+	}
+
+	// Administrative and self-service endpoints require callers to present a signed token
+	callers, err := callerAuthenticatorFromEnv()
+	if err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+	if callers != nil {
+		pdpHandler.SetCallerAuthenticator(callers)
+	} else {
+		log.Printf("[WARN] PDP_CALLER_JWT_SECRET and PDP_CALLER_JWT_PUBLIC_KEY are not set, administrative and self-service endpoints are disabled")
+	}
+
+	if tenantID := os.Getenv("PDP_TENANT_ID"); tenantID != "" {
+		pdpHandler.SetTenantID(tenantID)
+	}
+
+	// Reload the policies when their source changes
+	pollInterval, err := policyPollIntervalFromEnv()
+	if err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+	source, err := policySourceFromEnv(pdpHandler)
+	if err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+	pdpHandler.SetPolicySource(source)
+	watcher := NewPolicyWatcher(pdpHandler, source, pollInterval)
+	// Activate the source's policies before serving, e.g. the active version in the PRP
+	watcher.Check(context.Background())
+	if pollInterval > 0 {
+		go watcher.Run(context.Background())
+		log.Printf("[INFO] Watching policies in %s for changes every %s", source, pollInterval)
+	}
+
 	// Set up routing
 	mux := http.NewServeMux()
 	mux.HandleFunc("/evaluation", func(w http.ResponseWriter, r *http.Request) {
@@ -58,6 +129,123 @@ func main() {
 		}
 		pdpHandler.HandleEvaluation(w, r)
 	})
+	mux.HandleFunc("/evaluations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleBatchEvaluation(w, r)
+	})
+	mux.HandleFunc(authZENEvaluationPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleAuthZENEvaluation(w, r)
+	})
+	mux.HandleFunc(authZENEvaluationsPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleAuthZENEvaluations(w, r)
+	})
+	mux.HandleFunc(authZENConfigurationPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleAuthZENConfiguration(w, r)
+	})
+	mux.HandleFunc("/filters", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleRowFilter(w, r)
+	})
+	mux.HandleFunc("/break-glass", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleBreakGlassRequest(w, r)
+	})
+	mux.HandleFunc("/break-glass/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleBreakGlassRevoke(w, r, strings.TrimPrefix(r.URL.Path, "/break-glass/"))
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleMetrics(w, r)
+	})
+	mux.HandleFunc("/policy/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandlePolicyStatus(w, r)
+	})
+	mux.HandleFunc("/policies/versions", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			pdpHandler.HandleListPolicyVersions(w, r)
+		case http.MethodPost:
+			pdpHandler.HandleCreatePolicyVersion(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/policies/versions/", func(w http.ResponseWriter, r *http.Request) {
+		version, operation, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/policies/versions/"), "/")
+		switch {
+		case operation == "diff" && r.Method == http.MethodGet:
+			pdpHandler.HandleDiffPolicyVersion(w, r, version)
+		case operation == "validate" && r.Method == http.MethodPost:
+			pdpHandler.HandleValidatePolicyVersion(w, r, version)
+		case operation == "activate" && r.Method == http.MethodPost:
+			pdpHandler.HandleActivatePolicyVersion(w, r, version)
+		case operation == "diff" || operation == "validate" || operation == "activate":
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		userID, operation, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/users/"), "/")
+		switch {
+		case userID == "" || operation != "permissions":
+			http.NotFound(w, r)
+		case r.Method != http.MethodGet:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			pdpHandler.HandleUserPermissions(w, r, userID)
+		}
+	})
+	mux.HandleFunc("/resources/", func(w http.ResponseWriter, r *http.Request) {
+		resourceType, operation, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/resources/"), "/")
+		switch {
+		case resourceType == "" || operation != "access":
+			http.NotFound(w, r)
+		case r.Method != http.MethodGet:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			pdpHandler.HandleResourceAccess(w, r, resourceType)
+		}
+	})
+	mux.HandleFunc("/policies/rollback", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pdpHandler.HandleRollbackPolicyVersion(w, r)
+	})
 
 	server := &http.Server{
 		Handler:      mux,
@@ -71,45 +259,218 @@ func main() {
 
 // PDPHandler handles PDP requests
 type PDPHandler struct {
-	repo    interfaces.Repository
-	opaRBAC *rego.PreparedEvalQuery
+	repo     interfaces.Repository
+	tenantID string
+	active   atomic.Pointer[activePolicy]
+	reload   reloadStatus
+	source   PolicySource
+	shadow   *ShadowEvaluator
+	snapshot *PRPSnapshot
+	pip      interfaces.PolicyInformationProvider
+	callers  *CallerAuthenticator
+	models   *EvaluatorRegistry
+	target   string
+}
+
+// defaultTenantID is the tenant whose policy versions the PDP serves unless PDP_TENANT_ID is set
+const defaultTenantID = "11111111-1111-1111-1111-111111111111"
+
+// activePolicy is the policy set in force with its prepared queries.
+// It is swapped as a whole when the policies are reloaded.
+type activePolicy struct {
+	policies             *PolicySet
+	loadedAt             time.Time
+	target               string
+	opaRBAC              *rego.PreparedEvalQuery
+	opaRBACExplanation   *rego.PreparedEvalQuery
+	opaImpersonation     *rego.PreparedEvalQuery
+	opaBreakGlassRequest *rego.PreparedEvalQuery
+	opaBreakGlass        *rego.PreparedEvalQuery
+	opaAdmin             *rego.PreparedEvalQuery
+	opaRows              *rego.PreparedPartialQuery
+	opaABAC              *rego.PreparedEvalQuery
+	opaReBAC             *rego.PreparedEvalQuery
+	models               map[string]*modelConfig
+	queries              map[string]*rego.PreparedEvalQuery
+	// traced are the Rego counterparts of the traced queries when they are compiled to Wasm
+	traced map[*rego.PreparedEvalQuery]*rego.PreparedEvalQuery
 }
 
-// NewPDPHandler creates a new PDPHandler
+type activePolicyKey struct{}
+
+// NewPDPHandler creates a new PDPHandler with the policies at PDP_POLICY_PATH
 func NewPDPHandler(repo interfaces.Repository) *PDPHandler {
-	// Load policy files
-	rbacPolicy, err := loadPolicy("policy/rbac.rego")
+	policies, err := LoadPolicySet(policyPathFromEnv())
 	if err != nil {
-		log.Fatalf("[ERROR] Failed to load RBAC policy: %v", err)
+		log.Fatalf("[ERROR] Refusing to start, policies at %s are invalid:\n%v", policyPathFromEnv(), err)
 	}
+	log.Printf("[INFO] Loaded %d policy modules from %s (revision %q): %v",
+		len(policies.Modules), policies.Source, policies.Revision, policies.Modules)
 
-	// Prepare OPA queries
-	opaRBAC, err := rego.New(
-		rego.Query("data.policy.rbac.result"),
-		rego.Module("rbac.rego", rbacPolicy),
-	).PrepareForEval(context.Background())
+	handler, err := newPDPHandler(repo, policies)
 	if err != nil {
-		log.Fatalf("[ERROR] Failed to prepare RBAC policy: %v", err)
+		log.Fatalf("[ERROR] Failed to prepare policies: %v", err)
 	}
 
-	return &PDPHandler{
-		repo:    repo,
-		opaRBAC: &opaRBAC,
+	target, err := evalTargetFromEnv()
+	if err != nil {
+		log.Fatalf("[ERROR] %v", err)
 	}
+	if target != targetRego {
+		if err := handler.SetEvalTarget(target); err != nil {
+			log.Fatalf("[ERROR] Failed to prepare policies for the %s target: %v", target, err)
+		}
+		log.Printf("[INFO] Evaluating policies compiled ahead of time to %s", target)
+	}
+	return handler
+}
+
+// newPDPHandler creates a PDPHandler evaluating the policy set
+func newPDPHandler(repo interfaces.Repository, policies *PolicySet) (*PDPHandler, error) {
+	h := &PDPHandler{repo: repo, tenantID: defaultTenantID, target: targetRego}
+	h.models = h.newEvaluatorRegistry()
+	if err := h.swapPolicies(policies); err != nil {
+		return nil, err
+	}
+	return h, nil
 }
 
-func loadPolicy(path string) (string, error) {
-	absPath, err := filepath.Abs(path)
+// swapPolicies prepares the queries the PDP evaluates against the policy set and
+// atomically makes it the active policy. The active policy is kept if preparing fails.
+func (h *PDPHandler) swapPolicies(policies *PolicySet) error {
+	p, err := preparePolicy(policies, h.target)
 	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path: %w", err)
+		return err
 	}
+	if err := h.models.validate(p.models); err != nil {
+		return err
+	}
+	h.active.Store(p)
+	return nil
+}
 
-	content, err := os.ReadFile(absPath)
+// preparePolicy prepares the queries the PDP evaluates against the policy set for the target.
+// Partial evaluation is not supported by Wasm, so the row filter query is always prepared for Rego.
+func preparePolicy(policies *PolicySet, target string) (*activePolicy, error) {
+	p := &activePolicy{policies: policies, loadedAt: time.Now(), target: target}
+	p.traced = make(map[*rego.PreparedEvalQuery]*rego.PreparedEvalQuery)
+
+	// prepare prepares the query for the target, and a traced query also for Rego
+	prepare := func(query string, traced bool) (*rego.PreparedEvalQuery, error) {
+		prepared, err := policies.PrepareTarget(query, target)
+		if err != nil || !traced || target == targetRego {
+			return prepared, err
+		}
+		p.traced[prepared], err = policies.Prepare(query)
+		return prepared, err
+	}
+
+	queries := []struct {
+		query    string
+		prepared **rego.PreparedEvalQuery
+		traced   bool
+	}{
+		{"data.policy.rbac.result", &p.opaRBAC, true},
+		{"data.policy.rbac.explanation", &p.opaRBACExplanation, false},
+		{"data.policy.impersonation.allow", &p.opaImpersonation, false},
+		{"data.policy.break_glass.allow_request", &p.opaBreakGlassRequest, false},
+		{"data.policy.break_glass.result", &p.opaBreakGlass, false},
+		{"data.policy.admin.allow", &p.opaAdmin, false},
+		{"data.policy.abac.allow", &p.opaABAC, false},
+		{"data.policy.rebac.allow", &p.opaReBAC, false},
+	}
+	for _, q := range queries {
+		prepared, err := prepare(q.query, q.traced)
+		if err != nil {
+			return nil, err
+		}
+		*q.prepared = prepared
+	}
+
+	rows, err := policies.PreparePartial("data.policy.rows.allow == true")
 	if err != nil {
-		return "", fmt.Errorf("failed to read policy file: %w", err)
+		return nil, err
+	}
+	p.opaRows = rows
+
+	models, err := policyModels(policies.data)
+	if err != nil {
+		return nil, err
+	}
+	p.models = models
+
+	if err := validateNetworkZones(policies.data); err != nil {
+		return nil, err
+	}
+	if err := validateBusinessHours(policies.data); err != nil {
+		return nil, err
+	}
+
+	// Prepare the Rego queries configured as policies of resource types
+	p.queries = make(map[string]*rego.PreparedEvalQuery)
+	for _, c := range models {
+		for _, name := range c.Policies {
+			if _, ok := p.queries[name]; ok || !isQueryPolicy(name) {
+				continue
+			}
+			prepared, err := prepare(name, true)
+			if err != nil {
+				return nil, err
+			}
+			p.queries[name] = prepared
+		}
 	}
 
-	return string(content), nil
+	return p, nil
+}
+
+// policy returns the policy a request is evaluated against. A request keeps
+// the policy it started with even if a reload swaps in a new one meanwhile.
+func (h *PDPHandler) policy(ctx context.Context) *activePolicy {
+	if p, ok := ctx.Value(activePolicyKey{}).(*activePolicy); ok {
+		return p
+	}
+	return h.active.Load()
+}
+
+// SetTenantID sets the tenant whose policy versions are managed and served
+func (h *PDPHandler) SetTenantID(tenantID string) {
+	h.tenantID = tenantID
+}
+
+// SetShadowEvaluator enables evaluating a candidate policy alongside the active one
+func (h *PDPHandler) SetShadowEvaluator(shadow *ShadowEvaluator) {
+	h.shadow = shadow
+}
+
+// newShadowEvaluatorFromEnv creates a ShadowEvaluator for the candidate policy directory or bundle at path.
+// Divergences are appended to PDP_SHADOW_DIFF_LOG, or written to stdout if it is unset.
+func newShadowEvaluatorFromEnv(path string) (*ShadowEvaluator, func(), error) {
+	candidate, err := LoadPolicySet(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load candidate policy: %w", err)
+	}
+	log.Printf("[INFO] Loaded %d candidate policy modules from %s (revision %q): %v",
+		len(candidate.Modules), candidate.Source, candidate.Revision, candidate.Modules)
+
+	var diffLog io.Writer = os.Stdout
+	closeDiffLog := func() {}
+	if diffLogPath := os.Getenv("PDP_SHADOW_DIFF_LOG"); diffLogPath != "" {
+		f, err := os.OpenFile(diffLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open shadow diff log: %w", err)
+		}
+		diffLog = f
+		closeDiffLog = func() { f.Close() }
+	}
+
+	shadow, err := NewShadowEvaluator(candidate, diffLog)
+	if err != nil {
+		closeDiffLog()
+		return nil, nil, err
+	}
+
+	return shadow, closeDiffLog, nil
 }
 
 // HandleEvaluation handles policy evaluation requests
@@ -124,17 +485,36 @@ func (h *PDPHandler) HandleEvaluation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Explaining a decision exposes the policy internals, so it is restricted to admins
+	var explain *explainer
+	if mode := r.URL.Query().Get("explain"); mode != "" {
+		var err error
+		if explain, err = newExplainer(mode); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		adminID, ok := h.requireAdmin(w, r)
+		if !ok {
+			return
+		}
+		log.Printf("[AUDIT] Explaining decision: admin=%s, user=%s, mode=%s", adminID, req.UserID, mode)
+		ctx = context.WithValue(ctx, explainerKey{}, explain)
+	}
+
 	log.Printf("[DEBUG] Processing evaluation request: %+v", req)
 	if req.Data != nil {
 		log.Printf("[DEBUG] Request includes data for filtering: %+v", req.Data)
 	}
 
-	response, err := h.evaluateRBAC(ctx, req)
+	response, err := h.evaluate(ctx, req)
 	if err != nil {
 		log.Printf("[ERROR] Evaluation error: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if explain != nil {
+		response.Explanation = explain.explanation
+	}
 
 	// Prepare detailed log message
 	logMsg := fmt.Sprintf("[INFO] Access Decision:\n"+
@@ -144,14 +524,22 @@ func (h *PDPHandler) HandleEvaluation(w http.ResponseWriter, r *http.Request) {
 		"- Resource ID: %s\n"+
 		"- Action: %s\n"+
 		"- Allowed Fields: %v\n"+
-		"- Filtered Data Present: %v",
+		"- Filtered Data Present: %v\n"+
+		"- Acting As: %s\n"+
+		"- Purpose: %s\n"+
+		"- Policy Revision: %s\n"+
+		"- PRP Snapshot: %d",
 		response.Allow,
 		req.UserID,
 		req.ResourceType,
 		req.ResourceID,
 		req.Action,
 		response.AllowedFields,
-		response.FilteredData != nil)
+		response.FilteredData != nil,
+		req.ActAs,
+		req.Purpose,
+		response.PolicyRevision,
+		response.SnapshotVersion)
 
 	log.Print(logMsg)
 
@@ -162,18 +550,161 @@ func (h *PDPHandler) HandleEvaluation(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// HandleMetrics exposes PDP metrics in the Prometheus text format
+func (h *PDPHandler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.shadow == nil {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		return
+	}
+	h.shadow.HandleMetrics(w, r)
+}
+
 func (h *PDPHandler) evaluateRBAC(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error) {
 	log.Printf("[DEBUG] Starting RBAC evaluation for user %s", req.UserID)
 
-	// Get user roles and permissions from repository
-	roles, permissions, err := h.repo.GetUserRoles(ctx, req.UserID)
+	input, err := h.rbacInput(ctx, req)
 	if err != nil {
 		return model.PolicyResponse{}, err
 	}
 
+	log.Printf("[DEBUG] Policy input: %+v", input)
+
+	// Evaluate policy
+	explain := explainerFrom(ctx)
+	query := h.policy(ctx).tracedQuery(h.policy(ctx).opaRBAC, explain)
+	results, err := query.Eval(ctx, explain.evalOptions(input)...)
+	if err != nil {
+		return model.PolicyResponse{}, fmt.Errorf("policy evaluation error: %w", err)
+	}
+	if err := explain.record(ctx, h.policy(ctx).opaRBACExplanation, input); err != nil {
+		return model.PolicyResponse{}, err
+	}
+
+	response, err := parsePolicyResult(results)
+	if err != nil {
+		return model.PolicyResponse{}, err
+	}
+
+	// Evaluate the candidate policy off the request path without affecting the enforced decision
+	if h.shadow != nil {
+		h.shadow.Submit(req, input, response)
+	}
+
+	// Active break-glass grants override the regular decision
+	response, err = h.applyBreakGlass(ctx, req, input, response)
+	if err != nil {
+		return model.PolicyResponse{}, err
+	}
+
+	log.Printf("[INFO] Final policy response: %+v", response)
+	return response, nil
+}
+
+// roleGrants is what the PRP grants a subject through their roles and the roles they inherit from
+type roleGrants struct {
+	permissions      []model.RBACPermission
+	fieldPermissions []model.FieldPermission
+	roleParents      []model.RoleParent
+	purposes         []model.RolePurpose
+}
+
+// grantsForUser returns the user's roles and what they grant. The roles are those the PIP
+// assigns when it is configured, or else those assigned in the PRP.
+func (h *PDPHandler) grantsForUser(ctx context.Context, userID string) ([]string, *roleGrants, error) {
+	if h.pip != nil {
+		pipRoles, err := h.pip.GetRoles(ctx, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		roles := make([]string, 0, len(pipRoles))
+		for _, role := range pipRoles {
+			roles = append(roles, role.ID)
+		}
+		grants, err := h.grantsForRoles(ctx, roles)
+		if err != nil {
+			return nil, nil, err
+		}
+		return roles, grants, nil
+	}
+
+	repo := h.repository(ctx)
+	grants := &roleGrants{}
+
+	roles, permissions, err := repo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	grants.permissions = permissions
+	if grants.fieldPermissions, err = repo.GetFieldPermissions(ctx, userID); err != nil {
+		return nil, nil, err
+	}
+	if grants.roleParents, err = repo.GetRoleParents(ctx, userID); err != nil {
+		return nil, nil, err
+	}
+	if grants.purposes, err = repo.GetRolePurposes(ctx, userID); err != nil {
+		return nil, nil, err
+	}
+	return roles, grants, nil
+}
+
+// grantsForRoles returns what the PRP grants the roles, e.g. those the PIP assigns a subject
+func (h *PDPHandler) grantsForRoles(ctx context.Context, roleIDs []string) (*roleGrants, error) {
+	repo := h.repository(ctx)
+	grants := &roleGrants{}
+
+	var err error
+	if grants.permissions, err = repo.GetPermissionsForRoles(ctx, roleIDs); err != nil {
+		return nil, err
+	}
+	if grants.fieldPermissions, err = repo.GetFieldPermissionsForRoles(ctx, roleIDs); err != nil {
+		return nil, err
+	}
+	if grants.roleParents, err = repo.GetRoleParentsForRoles(ctx, roleIDs); err != nil {
+		return nil, err
+	}
+	if grants.purposes, err = repo.GetRolePurposesForRoles(ctx, roleIDs); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// rbacInput builds the input of the RBAC policy for the request. The subject's roles, attributes
+// and relationships come from the PIP when it is configured, or else from the PRP; what the roles
+// grant always comes from the PRP.
+func (h *PDPHandler) rbacInput(ctx context.Context, req model.EvaluationRequest) (map[string]interface{}, error) {
+	// The PIP, when configured, is the source of the subject's roles, attributes and
+	// relationships. Permissions, fields, parents and purposes are then those of its roles.
+	var subject *pipSubject
+	var roles []string
+	var grants *roleGrants
+	var err error
+	if h.pip != nil {
+		subject, err = h.subjectInformation(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		roles = subject.roles
+		grants, err = h.grantsForRoles(ctx, roles)
+	} else {
+		roles, grants, err = h.grantsForUser(ctx, req.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	permissions, fieldPermissions, roleParents, purposes := grants.permissions, grants.fieldPermissions, grants.roleParents, grants.purposes
+
 	log.Printf("[DEBUG] User roles: %v", roles)
 	log.Printf("[DEBUG] User permissions: %v", permissions)
 
+	// Resolve the resource from the PRP; unregistered resources match no permission
+	resourceID, err := h.repository(ctx).GetResourceIDByType(ctx, req.ResourceType)
+	if err != nil && !errors.Is(err, interfaces.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("[WARN] Resource type '%s' is not registered", req.ResourceType)
+	}
+
 	// Convert roles and permissions to maps
 	userRoles := make([]map[string]interface{}, len(roles))
 	for i, role := range roles {
@@ -183,30 +714,37 @@ func (h *PDPHandler) evaluateRBAC(ctx context.Context, req model.EvaluationReque
 		}
 	}
 
-	rolePermissions := make([]map[string]interface{}, len(permissions))
-	for i, perm := range permissions {
-		rolePermissions[i] = map[string]interface{}{
-			"role_id":     perm.Role,
-			"resource_id": perm.ResourceID,
-			"action_id":   perm.Action,
-		}
+	// Requests from the PEP without a subject type come from end users
+	subjectType := req.SubjectType
+	if subjectType == "" {
+		subjectType = "user"
 	}
 
 	// Prepare input for OPA
 	input := map[string]interface{}{
 		"user": map[string]interface{}{
-			"id": req.UserID,
+			"id":   req.UserID,
+			"type": subjectType,
 		},
-		"user_roles":       userRoles,
-		"role_permissions": rolePermissions,
+		"user_roles":        userRoles,
+		"role_permissions":  rolePermissionsInput(permissions),
+		"field_permissions": fieldPermissionsInput(fieldPermissions),
+		"role_parents":      roleParentsInput(roleParents),
 		"resource": map[string]interface{}{
-			"id":   req.ResourceID,
+			"id":   resourceID,
 			"name": req.ResourceType,
 		},
 		"action": map[string]interface{}{
 			"id":   req.Action,
 			"name": req.Action,
 		},
+		"environment": environmentInput(req.Environment),
+	}
+
+	if subject != nil {
+		user := input["user"].(map[string]interface{})
+		user["attributes"] = subject.attributes
+		user["relationships"] = subject.relationships
 	}
 
 	// Add data if present
@@ -215,14 +753,97 @@ func (h *PDPHandler) evaluateRBAC(ctx context.Context, req model.EvaluationReque
 		log.Printf("[DEBUG] Including data in policy evaluation: %+v", req.Data)
 	}
 
-	log.Printf("[DEBUG] Policy input: %+v", input)
+	// Add the purposes the user's roles are bound to and the fields each purpose may expose.
+	// They restrict the fields of purpose-bound roles whether or not a purpose was declared.
+	rolePurposes := make([]map[string]interface{}, len(purposes))
+	for i, purpose := range purposes {
+		rolePurposes[i] = map[string]interface{}{
+			"role_id":     purpose.Role,
+			"resource_id": purpose.ResourceID,
+			"purpose":     purpose.Purpose,
+		}
+	}
+	input["role_purposes"] = rolePurposes
 
-	// Evaluate policy
-	results, err := h.opaRBAC.Eval(ctx, rego.EvalInput(input))
+	purposeFields, err := h.repository(ctx).GetPurposeFields(ctx)
 	if err != nil {
-		return model.PolicyResponse{}, fmt.Errorf("policy evaluation error: %w", err)
+		return nil, err
+	}
+
+	purposeFieldsInput := make([]map[string]interface{}, len(purposeFields))
+	for i, field := range purposeFields {
+		purposeFieldsInput[i] = map[string]interface{}{
+			"purpose":     field.Purpose,
+			"resource_id": field.ResourceID,
+			"field":       field.Field,
+		}
+	}
+	input["purpose_fields"] = purposeFieldsInput
+
+	// Add the declared purpose of use
+	if req.Purpose != "" {
+		input["purpose"] = req.Purpose
+		log.Printf("[DEBUG] Including purpose in policy evaluation: %s", req.Purpose)
+	}
+
+	return input, nil
+}
+
+// rolePermissionsInput converts role permissions to the policy input format
+func rolePermissionsInput(permissions []model.RBACPermission) []map[string]interface{} {
+	rolePermissions := make([]map[string]interface{}, len(permissions))
+	for i, perm := range permissions {
+		rolePermissions[i] = map[string]interface{}{
+			"role_id":     perm.Role,
+			"resource_id": perm.ResourceID,
+			"action_id":   perm.Action,
+		}
+	}
+	return rolePermissions
+}
+
+// fieldPermissionsInput converts field permissions to the policy input format
+func fieldPermissionsInput(permissions []model.FieldPermission) []map[string]interface{} {
+	fieldPermissions := make([]map[string]interface{}, len(permissions))
+	for i, perm := range permissions {
+		fieldPermissions[i] = map[string]interface{}{
+			"role_id":     perm.Role,
+			"resource_id": perm.ResourceID,
+			"action_id":   perm.Action,
+			"field":       perm.Field,
+		}
+	}
+	return fieldPermissions
+}
+
+// roleParentsInput converts role inheritance to the policy input format
+func roleParentsInput(parents []model.RoleParent) []map[string]interface{} {
+	roleParents := make([]map[string]interface{}, len(parents))
+	for i, parent := range parents {
+		roleParents[i] = map[string]interface{}{
+			"role_id":   parent.Role,
+			"parent_id": parent.ParentRole,
+		}
 	}
+	return roleParents
+}
 
+// evalAllow evaluates a query whose result is a boolean decision
+func evalAllow(ctx context.Context, query *rego.PreparedEvalQuery, input map[string]interface{}) (bool, error) {
+	results, err := query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, fmt.Errorf("policy evaluation error: %w", err)
+	}
+	if len(results) == 0 {
+		return false, nil
+	}
+
+	allowed, _ := results[0].Expressions[0].Value.(bool)
+	return allowed, nil
+}
+
+// parsePolicyResult converts the result set of a policy query into a PolicyResponse
+func parsePolicyResult(results rego.ResultSet) (model.PolicyResponse, error) {
 	// Check if we have any results
 	if len(results) == 0 {
 		log.Printf("[DEBUG] No policy results")
@@ -261,6 +882,20 @@ func (h *PDPHandler) evaluateRBAC(ctx context.Context, req model.EvaluationReque
 		}
 	}
 
+	// Get the roles that contributed each allowed field
+	var fieldSources map[string][]string
+	if sourcesRaw, ok := result["field_sources"].(map[string]interface{}); ok {
+		fieldSources = make(map[string][]string, len(sourcesRaw))
+		for field, rolesRaw := range sourcesRaw {
+			roles, _ := rolesRaw.([]interface{})
+			for _, role := range roles {
+				if str, ok := role.(string); ok {
+					fieldSources[field] = append(fieldSources[field], str)
+				}
+			}
+		}
+	}
+
 	// Get filtered data if present
 	var filteredData interface{}
 	if result["filtered_data"] != nil {
@@ -272,9 +907,9 @@ func (h *PDPHandler) evaluateRBAC(ctx context.Context, req model.EvaluationReque
 		Allow:         allowed,
 		Message:       fmt.Sprintf("Access %s", map[bool]string{true: "granted", false: "denied"}[allowed]),
 		AllowedFields: allowedFields,
+		FieldSources:  fieldSources,
 		FilteredData:  filteredData,
 	}
 
-	log.Printf("[INFO] Final policy response: %+v", response)
 	return response, nil
 }
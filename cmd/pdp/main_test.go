@@ -4,14 +4,74 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
 	"testing"
 
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
 	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
 	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
 )
 
+// getTestFieldPermissions returns the seeded employee field permissions of the manager and employee roles
+func getTestFieldPermissions(ctx context.Context, userID string) ([]model.FieldPermission, error) {
+	roleFields := map[string][]string{
+		"11111111-1111-1111-1111-111111111111": {"id", "name", "email", "department_id", "department_name", "employment_type_id", "employment_type", "position", "joined_at"},
+		"22222222-2222-2222-2222-222222222222": {"id", "name", "department_name", "employment_type"},
+	}
+
+	var permissions []model.FieldPermission
+	for role, fields := range roleFields {
+		for _, field := range fields {
+			permissions = append(permissions, model.FieldPermission{
+				Role:       role,
+				ResourceID: "11111111-1111-1111-1111-111111111111",
+				Action:     "view",
+				Field:      field,
+			})
+		}
+	}
+	return permissions, nil
+}
+
+// getTestPurposeFields returns the seeded fields each purpose may expose for employees
+func getTestPurposeFields(ctx context.Context) ([]model.PurposeField, error) {
+	purposeFields := map[string][]string{
+		"payroll":            {"id", "name", "email", "employment_type_id", "employment_type", "joined_at"},
+		"performance_review": {"id", "name", "department_id", "department_name", "position", "joined_at"},
+		"support":            {"id", "name", "email", "department_name"},
+	}
+
+	var fields []model.PurposeField
+	for purpose, names := range purposeFields {
+		for _, name := range names {
+			fields = append(fields, model.PurposeField{
+				Purpose:    purpose,
+				ResourceID: "11111111-1111-1111-1111-111111111111",
+				Field:      name,
+			})
+		}
+	}
+	return fields, nil
+}
+
+// getTestResourceID resolves the seeded resource types
+func getTestResourceID(ctx context.Context, resourceType string) (string, error) {
+	resourceIDs := map[string]string{
+		"employees":   "11111111-1111-1111-1111-111111111111",
+		"departments": "22222222-2222-2222-2222-222222222222",
+		"users":       "33333333-3333-3333-3333-333333333333",
+		"admin":       "44444444-4444-4444-4444-444444444444",
+	}
+	if id, ok := resourceIDs[resourceType]; ok {
+		return id, nil
+	}
+	return "", fmt.Errorf("resource type '%s': %w", resourceType, interfaces.ErrNotFound)
+}
+
 func TestPDPHandler_HandleEvaluation(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -29,6 +89,8 @@ func TestPDPHandler_HandleEvaluation(t *testing.T) {
 				Action:       "view",
 			},
 			mockRepo: &mocks.MockRepository{
+				GetFieldPermissionsFunc: getTestFieldPermissions,
+				GetResourceIDByTypeFunc: getTestResourceID,
 				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
 					return []string{"11111111-1111-1111-1111-111111111111"}, []model.RBACPermission{
 						{Role: "11111111-1111-1111-1111-111111111111", ResourceID: "11111111-1111-1111-1111-111111111111", Action: "view"},
@@ -51,6 +113,8 @@ func TestPDPHandler_HandleEvaluation(t *testing.T) {
 				Action:       "view",
 			},
 			mockRepo: &mocks.MockRepository{
+				GetFieldPermissionsFunc: getTestFieldPermissions,
+				GetResourceIDByTypeFunc: getTestResourceID,
 				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
 					return []string{"22222222-2222-2222-2222-222222222222"}, []model.RBACPermission{
 						{Role: "22222222-2222-2222-2222-222222222222", ResourceID: "11111111-1111-1111-1111-111111111111", Action: "view"},
@@ -128,6 +192,8 @@ func TestPDPHandler_evaluateRBAC(t *testing.T) {
 				Action:       "view",
 			},
 			mockRepo: &mocks.MockRepository{
+				GetFieldPermissionsFunc: getTestFieldPermissions,
+				GetResourceIDByTypeFunc: getTestResourceID,
 				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
 					return []string{"11111111-1111-1111-1111-111111111111"}, []model.RBACPermission{
 						{Role: "11111111-1111-1111-1111-111111111111", ResourceID: "11111111-1111-1111-1111-111111111111", Action: "view"},
@@ -150,6 +216,8 @@ func TestPDPHandler_evaluateRBAC(t *testing.T) {
 				Action:       "view",
 			},
 			mockRepo: &mocks.MockRepository{
+				GetFieldPermissionsFunc: getTestFieldPermissions,
+				GetResourceIDByTypeFunc: getTestResourceID,
 				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
 					return []string{"22222222-2222-2222-2222-222222222222"}, []model.RBACPermission{
 						{Role: "22222222-2222-2222-2222-222222222222", ResourceID: "11111111-1111-1111-1111-111111111111", Action: "view"},
@@ -163,6 +231,88 @@ func TestPDPHandler_evaluateRBAC(t *testing.T) {
 			},
 			wantError: false,
 		},
+		{
+			name: "Manager_views_departments",
+			request: model.EvaluationRequest{
+				UserID:       "user1",
+				ResourceType: "departments",
+				ResourceID:   "22222222-2222-2222-2222-222222222222",
+				Action:       "view",
+			},
+			mockRepo: &mocks.MockRepository{
+				GetFieldPermissionsFunc: func(ctx context.Context, userID string) ([]model.FieldPermission, error) {
+					return []model.FieldPermission{
+						{Role: "11111111-1111-1111-1111-111111111111", ResourceID: "22222222-2222-2222-2222-222222222222", Action: "view", Field: "id"},
+						{Role: "11111111-1111-1111-1111-111111111111", ResourceID: "22222222-2222-2222-2222-222222222222", Action: "view", Field: "name"},
+					}, nil
+				},
+				GetResourceIDByTypeFunc: getTestResourceID,
+				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+					return []string{"11111111-1111-1111-1111-111111111111"}, []model.RBACPermission{
+						{Role: "11111111-1111-1111-1111-111111111111", ResourceID: "22222222-2222-2222-2222-222222222222", Action: "view"},
+					}, nil
+				},
+			},
+			want: model.PolicyResponse{
+				Allow:         true,
+				Message:       "Access granted",
+				AllowedFields: []string{"id", "name"},
+			},
+			wantError: false,
+		},
+		{
+			name: "Unregistered_resource",
+			request: model.EvaluationRequest{
+				UserID:       "user1",
+				ResourceType: "invalid_resource",
+				ResourceID:   "11111111-1111-1111-1111-111111111111",
+				Action:       "view",
+			},
+			mockRepo: &mocks.MockRepository{
+				GetFieldPermissionsFunc: getTestFieldPermissions,
+				GetResourceIDByTypeFunc: getTestResourceID,
+				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+					return []string{"11111111-1111-1111-1111-111111111111"}, []model.RBACPermission{
+						{Role: "11111111-1111-1111-1111-111111111111", ResourceID: "11111111-1111-1111-1111-111111111111", Action: "view"},
+					}, nil
+				},
+			},
+			want: model.PolicyResponse{
+				Allow:   false,
+				Message: "Access denied",
+			},
+			wantError: false,
+		},
+		{
+			name: "Inherited_role",
+			request: model.EvaluationRequest{
+				UserID:       "user4",
+				ResourceType: "employees",
+				ResourceID:   "11111111-1111-1111-1111-111111111111",
+				Action:       "view",
+			},
+			mockRepo: &mocks.MockRepository{
+				GetFieldPermissionsFunc: getTestFieldPermissions,
+				GetResourceIDByTypeFunc: getTestResourceID,
+				// The repository returns the permissions of inherited roles along with the user's roles
+				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+					return []string{"55555555-5555-5555-5555-555555555555"}, []model.RBACPermission{
+						{Role: "22222222-2222-2222-2222-222222222222", ResourceID: "11111111-1111-1111-1111-111111111111", Action: "view"},
+					}, nil
+				},
+				GetRoleParentsFunc: func(ctx context.Context, userID string) ([]model.RoleParent, error) {
+					return []model.RoleParent{
+						{Role: "55555555-5555-5555-5555-555555555555", ParentRole: "22222222-2222-2222-2222-222222222222"},
+					}, nil
+				},
+			},
+			want: model.PolicyResponse{
+				Allow:         true,
+				Message:       "Access granted",
+				AllowedFields: []string{"id", "name", "department_name", "employment_type"},
+			},
+			wantError: false,
+		},
 		{
 			name: "No_access",
 			request: model.EvaluationRequest{
@@ -172,6 +322,8 @@ func TestPDPHandler_evaluateRBAC(t *testing.T) {
 				Action:       "view",
 			},
 			mockRepo: &mocks.MockRepository{
+				GetFieldPermissionsFunc: getTestFieldPermissions,
+				GetResourceIDByTypeFunc: getTestResourceID,
 				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
 					return []string{}, []model.RBACPermission{}, nil
 				},
@@ -217,3 +369,224 @@ func TestPDPHandler_evaluateRBAC(t *testing.T) {
 		})
 	}
 }
+
+func TestPDPHandler_evaluateRBAC_purpose(t *testing.T) {
+	const (
+		managerRole  = "11111111-1111-1111-1111-111111111111"
+		employeesRes = "11111111-1111-1111-1111-111111111111"
+	)
+
+	mockRepo := &mocks.MockRepository{
+		GetFieldPermissionsFunc: getTestFieldPermissions,
+		GetResourceIDByTypeFunc: getTestResourceID,
+		GetPurposeFieldsFunc:    getTestPurposeFields,
+		GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+			return []string{managerRole}, []model.RBACPermission{
+				{Role: managerRole, ResourceID: employeesRes, Action: "view"},
+			}, nil
+		},
+		GetRolePurposesFunc: func(ctx context.Context, userID string) ([]model.RolePurpose, error) {
+			return []model.RolePurpose{
+				{Role: managerRole, ResourceID: employeesRes, Purpose: "payroll"},
+				{Role: managerRole, ResourceID: employeesRes, Purpose: "performance_review"},
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		purpose    string
+		wantAllow  bool
+		wantFields []string
+	}{
+		{
+			name:       "Payroll",
+			purpose:    "payroll",
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "email", "employment_type_id", "employment_type", "joined_at"},
+		},
+		{
+			name:       "Performance_review",
+			purpose:    "performance_review",
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "department_id", "department_name", "position", "joined_at"},
+		},
+		{
+			name:      "Purpose_not_registered_for_role",
+			purpose:   "support",
+			wantAllow: false,
+		},
+		{
+			name:       "No_purpose_declared",
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "joined_at"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(mockRepo)
+			got, err := handler.evaluateRBAC(context.Background(), model.EvaluationRequest{
+				UserID:       "user1",
+				ResourceType: "employees",
+				ResourceID:   employeesRes,
+				Action:       "view",
+				Purpose:      tt.purpose,
+			})
+			if err != nil {
+				t.Fatalf("evaluateRBAC() error = %v", err)
+			}
+
+			if got.Allow != tt.wantAllow {
+				t.Errorf("evaluateRBAC() allow = %v, want %v", got.Allow, tt.wantAllow)
+			}
+			if len(got.AllowedFields) != len(tt.wantFields) {
+				t.Fatalf("evaluateRBAC() allowed fields = %v, want %v", got.AllowedFields, tt.wantFields)
+			}
+			for i, field := range tt.wantFields {
+				if got.AllowedFields[i] != field {
+					t.Errorf("evaluateRBAC() allowed field = %v, want %v", got.AllowedFields[i], field)
+				}
+			}
+		})
+	}
+}
+
+// TestPDPHandler_evaluateRBAC_seededPurposes evaluates the README examples against the roles,
+// role parents and purpose bindings of postgres/prp/2_data.sql
+func TestPDPHandler_evaluateRBAC_seededPurposes(t *testing.T) {
+	mockRepo := &mocks.MockRepository{
+		GetFieldPermissionsFunc: getTestFieldPermissions,
+		GetResourceIDByTypeFunc: getTestResourceID,
+		GetPurposeFieldsFunc:    getTestPurposeFields,
+		// Managers inherit the employee role
+		GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+			if userID == testManagerUser {
+				return []string{testManagerRole}, []model.RBACPermission{
+					{Role: testManagerRole, ResourceID: testEmployeesRes, Action: "view"},
+					{Role: testEmployeeRole, ResourceID: testEmployeesRes, Action: "view"},
+				}, nil
+			}
+			return []string{testEmployeeRole}, []model.RBACPermission{
+				{Role: testEmployeeRole, ResourceID: testEmployeesRes, Action: "view"},
+			}, nil
+		},
+		GetRoleParentsFunc: func(ctx context.Context, userID string) ([]model.RoleParent, error) {
+			return []model.RoleParent{{Role: testManagerRole, ParentRole: testEmployeeRole}}, nil
+		},
+		GetRolePurposesFunc: func(ctx context.Context, userID string) ([]model.RolePurpose, error) {
+			return []model.RolePurpose{
+				{Role: testManagerRole, ResourceID: testEmployeesRes, Purpose: "payroll"},
+				{Role: testManagerRole, ResourceID: testEmployeesRes, Purpose: "performance_review"},
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		userID     string
+		purpose    string
+		wantAllow  bool
+		wantFields []string
+	}{
+		{
+			name:       "Manager_without_purpose",
+			userID:     testManagerUser,
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "joined_at"},
+		},
+		{
+			name:       "Manager_for_payroll",
+			userID:     testManagerUser,
+			purpose:    "payroll",
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "email", "employment_type_id", "employment_type", "joined_at"},
+		},
+		{
+			name:       "Employee_without_purpose",
+			userID:     testEmployeeUser,
+			wantAllow:  true,
+			wantFields: []string{"id", "name", "department_name", "employment_type"},
+		},
+		{
+			name:      "Employee_for_payroll",
+			userID:    testEmployeeUser,
+			purpose:   "payroll",
+			wantAllow: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewPDPHandler(mockRepo)
+			got, err := handler.evaluateRBAC(context.Background(), model.EvaluationRequest{
+				UserID:       tt.userID,
+				ResourceType: "employees",
+				ResourceID:   testEmployeesRes,
+				Action:       "view",
+				Purpose:      tt.purpose,
+			})
+			if err != nil {
+				t.Fatalf("evaluateRBAC() error = %v", err)
+			}
+
+			if got.Allow != tt.wantAllow {
+				t.Errorf("evaluateRBAC() allow = %v, want %v", got.Allow, tt.wantAllow)
+			}
+			if !slices.Equal(got.AllowedFields, tt.wantFields) {
+				t.Errorf("evaluateRBAC() allowed fields = %v, want %v", got.AllowedFields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_evaluateRBAC_roleUnion(t *testing.T) {
+	const (
+		employeeRole      = "22222222-2222-2222-2222-222222222222"
+		payrollViewerRole = "55555555-5555-5555-5555-555555555555"
+		employeesRes      = "11111111-1111-1111-1111-111111111111"
+	)
+
+	handler := NewPDPHandler(&mocks.MockRepository{
+		GetResourceIDByTypeFunc: getTestResourceID,
+		GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+			return []string{employeeRole, payrollViewerRole}, []model.RBACPermission{
+				{Role: employeeRole, ResourceID: employeesRes, Action: "view"},
+				{Role: payrollViewerRole, ResourceID: employeesRes, Action: "view"},
+			}, nil
+		},
+		GetFieldPermissionsFunc: func(ctx context.Context, userID string) ([]model.FieldPermission, error) {
+			permissions, _ := getTestFieldPermissions(ctx, userID)
+			return append(permissions,
+				model.FieldPermission{Role: payrollViewerRole, ResourceID: employeesRes, Action: "view", Field: "id"},
+				model.FieldPermission{Role: payrollViewerRole, ResourceID: employeesRes, Action: "view", Field: "employment_type_id"},
+			), nil
+		},
+	})
+
+	got, err := handler.evaluateRBAC(context.Background(), model.EvaluationRequest{
+		UserID:       "user1",
+		ResourceType: "employees",
+		ResourceID:   employeesRes,
+		Action:       "view",
+	})
+	if err != nil {
+		t.Fatalf("evaluateRBAC() error = %v", err)
+	}
+
+	// The narrow role adds to the fields of the employee role instead of replacing them
+	wantFields := []string{"id", "name", "department_name", "employment_type", "employment_type_id"}
+	if !reflect.DeepEqual(got.AllowedFields, wantFields) {
+		t.Errorf("evaluateRBAC() allowed fields = %v, want %v", got.AllowedFields, wantFields)
+	}
+	wantSources := map[string][]string{
+		"id":                 {employeeRole, payrollViewerRole},
+		"name":               {employeeRole},
+		"department_name":    {employeeRole},
+		"employment_type":    {employeeRole},
+		"employment_type_id": {payrollViewerRole},
+	}
+	if !reflect.DeepEqual(got.FieldSources, wantSources) {
+		t.Errorf("evaluateRBAC() field sources = %v, want %v", got.FieldSources, wantSources)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// Policy models registered by default
+const (
+	modelRBAC  = "rbac"
+	modelABAC  = "abac"
+	modelReBAC = "rebac"
+)
+
+// PolicyModel evaluates requests under one access control model
+type PolicyModel interface {
+	interfaces.PolicyEvaluator
+	// Decide evaluates the request and returns the decision with the fields it exposes
+	Decide(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error)
+}
+
+// EvaluatorRegistry holds the policy models resource types can be configured with
+type EvaluatorRegistry struct {
+	models map[string]PolicyModel
+}
+
+// NewEvaluatorRegistry creates an empty EvaluatorRegistry
+func NewEvaluatorRegistry() *EvaluatorRegistry {
+	return &EvaluatorRegistry{models: make(map[string]PolicyModel)}
+}
+
+// Register makes the model available under the name
+func (r *EvaluatorRegistry) Register(name string, m PolicyModel) {
+	r.models[name] = m
+}
+
+// Lookup returns the model registered under the name
+func (r *EvaluatorRegistry) Lookup(name string) (PolicyModel, bool) {
+	m, ok := r.models[name]
+	return m, ok
+}
+
+// Names returns the names of the registered models in order
+func (r *EvaluatorRegistry) Names() []string {
+	names := make([]string, 0, len(r.models))
+	for name := range r.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate checks that every configured model is registered. Rego queries are prepared with the policy set.
+func (r *EvaluatorRegistry) validate(config map[string]*modelConfig) error {
+	for resourceType, c := range config {
+		for _, name := range c.Policies {
+			if isQueryPolicy(name) {
+				continue
+			}
+			if _, ok := r.models[name]; !ok {
+				return fmt.Errorf("config.models.%s: unknown policy model %q, registered models are %v", resourceType, name, r.Names())
+			}
+		}
+	}
+	return nil
+}
+
+// newEvaluatorRegistry creates the registry of the models the PDP evaluates with by default
+func (h *PDPHandler) newEvaluatorRegistry() *EvaluatorRegistry {
+	registry := NewEvaluatorRegistry()
+	registry.Register(modelRBAC, &rbacModel{h: h})
+	registry.Register(modelABAC, &abacModel{h: h})
+	registry.Register(modelReBAC, &rebacModel{h: h})
+	return registry
+}
+
+// RegisterPolicyModel makes an additional model available to the resource type configuration
+func (h *PDPHandler) RegisterPolicyModel(name string, m PolicyModel) {
+	h.models.Register(name, m)
+}
+
+// modelConfig is how a resource type is evaluated: the policies deciding it, each a registered
+// policy model or a Rego query, and how their decisions and fields are combined
+type modelConfig struct {
+	Policies  []string
+	Algorithm string
+	Fields    string
+}
+
+// defaultModelConfig is the configuration of resource types without one
+var defaultModelConfig = &modelConfig{Policies: []string{modelRBAC}, Algorithm: combineDenyOverrides, Fields: fieldsIntersection}
+
+// rbacOnly reports whether the resource type is decided by the RBAC model alone
+func (c *modelConfig) rbacOnly() bool {
+	return len(c.Policies) == 1 && c.Policies[0] == modelRBAC
+}
+
+// isQueryPolicy reports whether the configured policy is a Rego query rather than a registered model
+func isQueryPolicy(name string) bool {
+	return strings.HasPrefix(name, "data.")
+}
+
+// policyModels reads the models configured per resource type from config.models of the policy data.
+// A resource type maps to a list of policies, combined with deny-overrides, or to an object
+// {"policies": [...], "algorithm": "...", "fields": "..."}.
+func policyModels(data map[string]interface{}) (map[string]*modelConfig, error) {
+	config, _ := data["config"].(map[string]interface{})
+	raw, ok := config["models"]
+	if !ok {
+		return map[string]*modelConfig{}, nil
+	}
+	byType, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("config.models must map resource types to lists of policy models")
+	}
+
+	models := make(map[string]*modelConfig, len(byType))
+	for resourceType, value := range byType {
+		c := &modelConfig{Algorithm: combineDenyOverrides}
+		policies := value
+		if object, ok := value.(map[string]interface{}); ok {
+			policies = object["policies"]
+			if algorithm, ok := object["algorithm"]; ok {
+				if c.Algorithm, ok = algorithm.(string); !ok {
+					return nil, fmt.Errorf("config.models.%s.algorithm must be a string", resourceType)
+				}
+			}
+			if fields, ok := object["fields"]; ok {
+				if c.Fields, ok = fields.(string); !ok {
+					return nil, fmt.Errorf("config.models.%s.fields must be a string", resourceType)
+				}
+			}
+		}
+
+		list, ok := policies.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("config.models.%s must be a non-empty list of policy models", resourceType)
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("config.models.%s must be a non-empty list of policy models", resourceType)
+			}
+			c.Policies = append(c.Policies, name)
+		}
+
+		if err := c.validateCombining(); err != nil {
+			return nil, fmt.Errorf("config.models.%s: %w", resourceType, err)
+		}
+		models[resourceType] = c
+	}
+	return models, nil
+}
+
+// modelsFor returns how a resource type is evaluated
+func (h *PDPHandler) modelsFor(ctx context.Context, resourceType string) *modelConfig {
+	if c, ok := h.policy(ctx).models[resourceType]; ok {
+		return c
+	}
+	return defaultModelConfig
+}
+
+// rbacModel decides with the role-based policy, data.policy.rbac
+type rbacModel struct {
+	h *PDPHandler
+}
+
+func (m *rbacModel) Evaluate(ctx context.Context, req model.EvaluationRequest) (bool, error) {
+	response, err := m.Decide(ctx, req)
+	return response.Allow, err
+}
+
+func (m *rbacModel) Decide(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error) {
+	return m.h.evaluateRBAC(ctx, req)
+}
+
+// abacModel decides with the attribute-based policy, data.policy.abac, from the attributes
+// of the user and of the requested record
+type abacModel struct {
+	h *PDPHandler
+}
+
+func (m *abacModel) Evaluate(ctx context.Context, req model.EvaluationRequest) (bool, error) {
+	h := m.h
+	userAttributes, err := h.userAttributes(ctx, req.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	resourceAttributes, err := h.resourceAttributes(ctx, req.ResourceID)
+	if err != nil {
+		return false, err
+	}
+
+	input := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":         req.UserID,
+			"attributes": userAttributes,
+		},
+		"resource": map[string]interface{}{
+			"type":       req.ResourceType,
+			"id":         req.ResourceID,
+			"attributes": resourceAttributes,
+		},
+		"action": map[string]interface{}{
+			"name": req.Action,
+		},
+		"environment": environmentInput(req.Environment),
+	}
+	return evalAllow(ctx, h.policy(ctx).opaABAC, input)
+}
+
+func (m *abacModel) Decide(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error) {
+	return modelDecision(ctx, m, req, "Access denied - attributes do not match")
+}
+
+// userAttributes returns the attributes of the user from the PIP if configured, otherwise from the PRP
+func (h *PDPHandler) userAttributes(ctx context.Context, userID string) (map[string]interface{}, error) {
+	if h.pip != nil {
+		subject, err := h.subjectInformation(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return subject.attributes, nil
+	}
+
+	attributes, err := h.repository(ctx).GetUserAttributes(ctx, userID)
+	if err != nil && !errors.Is(err, interfaces.ErrNotFound) {
+		return nil, err
+	}
+	if attributes == nil {
+		return map[string]interface{}{}, nil
+	}
+	return map[string]interface{}{
+		"department_id":      attributes.DepartmentID,
+		"department_name":    attributes.DepartmentName,
+		"employment_type_id": attributes.EmploymentTypeID,
+	}, nil
+}
+
+// resourceAttributes returns the attributes of the requested record from the PRP
+func (h *PDPHandler) resourceAttributes(ctx context.Context, resourceID string) (map[string]interface{}, error) {
+	resourceAttributes := map[string]interface{}{}
+	if resourceID == "" {
+		return resourceAttributes, nil
+	}
+	attributes, err := h.repository(ctx).GetResourceAttributes(ctx, resourceID)
+	if err != nil && !errors.Is(err, interfaces.ErrNotFound) {
+		return nil, err
+	}
+	if attributes != nil {
+		resourceAttributes["department_id"] = attributes.DepartmentID
+	}
+	return resourceAttributes, nil
+}
+
+// rebacModel decides with the relationship-based policy, data.policy.rebac, from the
+// relationships of the user to the requested record
+type rebacModel struct {
+	h *PDPHandler
+}
+
+func (m *rebacModel) Evaluate(ctx context.Context, req model.EvaluationRequest) (bool, error) {
+	h := m.h
+	relationships, err := h.userRelationships(ctx, req.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	input := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id": req.UserID,
+		},
+		"resource": map[string]interface{}{
+			"type": req.ResourceType,
+			"id":   req.ResourceID,
+		},
+		"action": map[string]interface{}{
+			"name": req.Action,
+		},
+		"environment":   environmentInput(req.Environment),
+		"relationships": relationships,
+	}
+	return evalAllow(ctx, h.policy(ctx).opaReBAC, input)
+}
+
+func (m *rebacModel) Decide(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error) {
+	return modelDecision(ctx, m, req, "Access denied - no relationship grants access")
+}
+
+// userRelationships returns the relationships of the user from the PIP if configured, otherwise from the PRP
+func (h *PDPHandler) userRelationships(ctx context.Context, userID string) ([]map[string]interface{}, error) {
+	if h.pip != nil {
+		subject, err := h.subjectInformation(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return subject.relationships, nil
+	}
+
+	rels, err := h.repository(ctx).GetUserRelationships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	relationships := make([]map[string]interface{}, 0, len(rels))
+	for _, rel := range rels {
+		relationships = append(relationships, map[string]interface{}{
+			"subject_id": rel.SubjectID,
+			"object_id":  rel.ObjectID,
+			"type":       rel.Type,
+		})
+	}
+	return relationships, nil
+}
+
+// modelDecision turns the allow decision of a model without field rules into a response. Its
+// AllowedFields stay nil, which combinePermits treats as no opinion on fields.
+func modelDecision(ctx context.Context, m interfaces.PolicyEvaluator, req model.EvaluationRequest, deniedMessage string) (model.PolicyResponse, error) {
+	allowed, err := m.Evaluate(ctx, req)
+	if err != nil {
+		return model.PolicyResponse{}, err
+	}
+	if !allowed {
+		return model.PolicyResponse{Allow: false, Message: deniedMessage}, nil
+	}
+	return model.PolicyResponse{Allow: true, FilteredData: req.Data}, nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+const (
+	testEngineeringDept = "11111111-1111-1111-1111-111111111111"
+	testHRDept          = "22222222-2222-2222-2222-222222222222"
+	testHRUser          = "77777777-7777-7777-7777-777777777777"
+)
+
+// newModelsMockRepo extends the break-glass mock with the manager and the employee in
+// Engineering, an HR record and the manager managing the employee
+func newModelsMockRepo() *mocks.MockRepository {
+	repo := newBreakGlassMockRepo()
+	departments := map[string]string{
+		testManagerUser:  testEngineeringDept,
+		testEmployeeUser: testEngineeringDept,
+		testHRUser:       testHRDept,
+	}
+	repo.GetUserAttributesFunc = func(ctx context.Context, userID string) (*model.UserAttributes, error) {
+		department, ok := departments[userID]
+		if !ok {
+			return nil, interfaces.ErrNotFound
+		}
+		return &model.UserAttributes{DepartmentID: department}, nil
+	}
+	repo.GetResourceAttributesFunc = func(ctx context.Context, resourceID string) (*model.ResourceAttributes, error) {
+		return &model.ResourceAttributes{DepartmentID: departments[resourceID]}, nil
+	}
+	repo.GetUserRelationshipsFunc = func(ctx context.Context, userID string) ([]model.Relationship, error) {
+		if userID != testManagerUser && userID != testEmployeeUser {
+			return nil, nil
+		}
+		return []model.Relationship{{SubjectID: testManagerUser, ObjectID: testEmployeeUser, Type: "manages"}}, nil
+	}
+	return repo
+}
+
+// newModelsHandler creates a handler evaluating the employees resource with the models
+func newModelsHandler(t *testing.T, repo interfaces.Repository, models string) *PDPHandler {
+	t.Helper()
+	policies := loadModelsPolicySet(t, models)
+	handler, err := newPDPHandler(repo, policies)
+	if err != nil {
+		t.Fatalf("newPDPHandler() error = %v", err)
+	}
+	return handler
+}
+
+// loadModelsPolicySet loads the policies with config.models set to the models of the employees resource
+func loadModelsPolicySet(t testing.TB, models string) *PolicySet {
+	t.Helper()
+	dir := copyPolicies(t)
+	data := `{"config": {"models": {"employees": ` + models + `}}}`
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write policy data: %v", err)
+	}
+	policies, err := LoadPolicySet(dir)
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+	return policies
+}
+
+func TestPDPHandler_evaluate_models(t *testing.T) {
+	record := map[string]interface{}{"id": testEmployeeUser, "name": "Bob Engineer", "email": "bob@example.com"}
+
+	tests := []struct {
+		name            string
+		models          string
+		userID          string
+		resourceID      string
+		action          string
+		wantAllow       bool
+		wantModels      map[string]bool
+		wantFields      int
+		wantUnfiltered  bool
+		wantMessagePart string
+	}{
+		{
+			name:       "RBAC_only",
+			models:     `["rbac"]`,
+			userID:     testEmployeeUser,
+			resourceID: testHRUser,
+			action:     "view",
+			wantAllow:  true,
+			wantFields: 4,
+		},
+		{
+			name:       "RBAC_and_ABAC_same_department",
+			models:     `["rbac", "abac"]`,
+			userID:     testEmployeeUser,
+			resourceID: testManagerUser,
+			action:     "view",
+			wantAllow:  true,
+			wantModels: map[string]bool{"rbac": true, "abac": true},
+			wantFields: 4,
+		},
+		{
+			name:            "RBAC_and_ABAC_other_department",
+			models:          `["rbac", "abac"]`,
+			userID:          testEmployeeUser,
+			resourceID:      testHRUser,
+			action:          "view",
+			wantAllow:       false,
+			wantModels:      map[string]bool{"rbac": true, "abac": false},
+			wantMessagePart: "attributes",
+		},
+		{
+			name:           "ReBAC_managed_record",
+			models:         `["rebac"]`,
+			userID:         testManagerUser,
+			resourceID:     testEmployeeUser,
+			action:         "edit",
+			wantAllow:      true,
+			wantModels:     map[string]bool{"rebac": true},
+			wantUnfiltered: true,
+		},
+		{
+			name:            "ReBAC_unrelated_record",
+			models:          `["rebac"]`,
+			userID:          testManagerUser,
+			resourceID:      testHRUser,
+			action:          "view",
+			wantAllow:       false,
+			wantModels:      map[string]bool{"rebac": false},
+			wantMessagePart: "relationship",
+		},
+		{
+			// The relationship permits editing, but no role does
+			name:       "RBAC_and_ReBAC_denied_by_RBAC",
+			models:     `["rbac", "rebac"]`,
+			userID:     testManagerUser,
+			resourceID: testEmployeeUser,
+			action:     "edit",
+			wantAllow:  false,
+			wantModels: map[string]bool{"rbac": false, "rebac": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newModelsHandler(t, newModelsMockRepo(), tt.models)
+
+			response, err := handler.evaluate(context.Background(), model.EvaluationRequest{
+				UserID:       tt.userID,
+				ResourceType: "employees",
+				ResourceID:   tt.resourceID,
+				Action:       tt.action,
+				Data:         record,
+			})
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+			if response.Allow != tt.wantAllow {
+				t.Errorf("evaluate() allow = %v, want %v", response.Allow, tt.wantAllow)
+			}
+			if !reflect.DeepEqual(response.Models, tt.wantModels) {
+				t.Errorf("evaluate() models = %v, want %v", response.Models, tt.wantModels)
+			}
+			if len(response.AllowedFields) != tt.wantFields {
+				t.Errorf("evaluate() allowed fields = %v, want %d fields", response.AllowedFields, tt.wantFields)
+			}
+			if tt.wantUnfiltered && !reflect.DeepEqual(response.FilteredData, record) {
+				t.Errorf("evaluate() filtered data = %v, want the unfiltered record", response.FilteredData)
+			}
+			if !tt.wantAllow && response.FilteredData != nil {
+				t.Errorf("evaluate() filtered data = %v, want none when denied", response.FilteredData)
+			}
+			if !strings.Contains(response.Message, tt.wantMessagePart) {
+				t.Errorf("evaluate() message = %q, want it to contain %q", response.Message, tt.wantMessagePart)
+			}
+		})
+	}
+}
+
+func TestPolicyModels(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		want    map[string]*modelConfig
+		wantErr bool
+	}{
+		{
+			name: "Not_configured",
+			data: map[string]interface{}{},
+			want: map[string]*modelConfig{},
+		},
+		{
+			name: "Configured",
+			data: map[string]interface{}{"config": map[string]interface{}{"models": map[string]interface{}{
+				"employees": []interface{}{"rbac", "abac"},
+			}}},
+			want: map[string]*modelConfig{"employees": {
+				Policies:  []string{"rbac", "abac"},
+				Algorithm: combineDenyOverrides,
+				Fields:    fieldsIntersection,
+			}},
+		},
+		{
+			name: "Not_a_list",
+			data: map[string]interface{}{"config": map[string]interface{}{"models": map[string]interface{}{
+				"employees": "rbac",
+			}}},
+			wantErr: true,
+		},
+		{
+			name: "Empty_list",
+			data: map[string]interface{}{"config": map[string]interface{}{"models": map[string]interface{}{
+				"employees": []interface{}{},
+			}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policyModels(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("policyModels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("policyModels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// denyAllModel is a custom policy model denying every request
+type denyAllModel struct{}
+
+func (denyAllModel) Evaluate(ctx context.Context, req model.EvaluationRequest) (bool, error) {
+	return false, nil
+}
+
+func (m denyAllModel) Decide(ctx context.Context, req model.EvaluationRequest) (model.PolicyResponse, error) {
+	return modelDecision(ctx, m, req, "Access denied - denied by policy")
+}
+
+func TestPDPHandler_RegisterPolicyModel(t *testing.T) {
+	handler := newModelsHandler(t, newModelsMockRepo(), `["rbac"]`)
+
+	// Configuring a model that is not registered keeps the active policy
+	if err := handler.swapPolicies(loadModelsPolicySet(t, `["rbac", "deny_all"]`)); err == nil {
+		t.Fatal("swapPolicies() error = nil, want the unknown model rejected")
+	}
+
+	handler.RegisterPolicyModel("deny_all", denyAllModel{})
+	if err := handler.swapPolicies(loadModelsPolicySet(t, `["rbac", "deny_all"]`)); err != nil {
+		t.Fatalf("swapPolicies() error = %v", err)
+	}
+
+	response, err := handler.evaluate(context.Background(), model.EvaluationRequest{
+		UserID:       testEmployeeUser,
+		ResourceType: "employees",
+		Action:       "view",
+	})
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if response.Allow {
+		t.Error("evaluate() allow = true, want the custom model to deny")
+	}
+	if want := map[string]bool{"rbac": true, "deny_all": false}; !reflect.DeepEqual(response.Models, want) {
+		t.Errorf("evaluate() models = %v, want %v", response.Models, want)
+	}
+}
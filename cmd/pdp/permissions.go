@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// breakGlassListedAction is the action the resources of active break-glass grants are listed with
+const breakGlassListedAction = "view"
+
+// HandleUserPermissions returns what a user may do: every resource and action the user is
+// allowed and the fields each exposes. Users may ask for themselves, administrators for anyone.
+func (h *PDPHandler) HandleUserPermissions(w http.ResponseWriter, r *http.Request, userID string) {
+	callerID, ok := h.authenticateCaller(w, r)
+	if !ok {
+		return
+	}
+	if callerID != userID {
+		if _, ok := h.authorizeAdmin(w, r, callerID); !ok {
+			return
+		}
+	}
+
+	permissions, err := h.userPermissions(h.batchContext(r.Context()), userID, r.URL.Query().Get("resource_type"))
+	if err != nil {
+		log.Printf("[ERROR] Failed to enumerate permissions of user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Enumerated permissions: user=%s, caller=%s, resources=%d", userID, callerID, len(permissions.Resources))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions)
+}
+
+// userPermissions evaluates every resource and action the user's roles hold a permission for,
+// and the resources of the user's active break-glass grants, optionally of one resource type,
+// with the policy used for enforcement
+func (h *PDPHandler) userPermissions(ctx context.Context, userID, resourceType string) (*model.UserPermissions, error) {
+	// The roles come from the same source as those of enforced decisions
+	_, grants, err := h.grantsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := grants.permissions
+
+	// Emergency access is listed under the view action it is requested for
+	breakGlassGrants, err := h.repository(ctx).GetActiveBreakGlassGrants(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range breakGlassGrants {
+		permissions = append(permissions, model.RBACPermission{ResourceID: grant.ResourceID, Action: breakGlassListedAction})
+	}
+
+	resources, err := h.repository(ctx).GetResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resourceTypes := make(map[string]string, len(resources))
+	for _, resource := range resources {
+		resourceTypes[resource.ID] = resource.Name
+	}
+
+	// Candidates are the distinct resource and action pairs of the user's permissions and grants
+	type candidate struct{ resourceID, action string }
+	seen := make(map[candidate]bool)
+	var candidates []candidate
+	var reqs []model.EvaluationRequest
+	for _, perm := range permissions {
+		c := candidate{perm.ResourceID, perm.Action}
+		name, ok := resourceTypes[perm.ResourceID]
+		if !ok || seen[c] || (resourceType != "" && name != resourceType) {
+			continue
+		}
+		seen[c] = true
+		candidates = append(candidates, c)
+		reqs = append(reqs, model.EvaluationRequest{UserID: userID, ResourceType: name, Action: perm.Action})
+	}
+
+	byResource := make(map[string]*model.ResourcePermissions)
+	for i, result := range h.evaluateBatch(ctx, reqs, model.EvaluationRequest{}) {
+		if result.Decision == nil {
+			return nil, fmt.Errorf("evaluating %s on %s: %s", reqs[i].Action, reqs[i].ResourceType, result.Error)
+		}
+		if !result.Decision.Allow {
+			continue
+		}
+
+		resource, ok := byResource[reqs[i].ResourceType]
+		if !ok {
+			resource = &model.ResourcePermissions{
+				ResourceType:  reqs[i].ResourceType,
+				ResourceID:    candidates[i].resourceID,
+				AllowedFields: make(map[string][]string),
+			}
+			byResource[reqs[i].ResourceType] = resource
+		}
+		resource.Actions = append(resource.Actions, reqs[i].Action)
+		resource.AllowedFields[reqs[i].Action] = nonNil(result.Decision.AllowedFields)
+	}
+
+	userPermissions := &model.UserPermissions{
+		UserID:         userID,
+		Resources:      make([]model.ResourcePermissions, 0, len(byResource)),
+		PolicyRevision: h.policy(ctx).policies.Revision,
+	}
+	for _, resource := range byResource {
+		sort.Strings(resource.Actions)
+		userPermissions.Resources = append(userPermissions.Resources, *resource)
+	}
+	sort.Slice(userPermissions.Resources, func(i, j int) bool {
+		return userPermissions.Resources[i].ResourceType < userPermissions.Resources[j].ResourceType
+	})
+	return userPermissions, nil
+}
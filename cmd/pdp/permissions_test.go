@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+// getTestResources returns the seeded resource types
+func getTestResources(ctx context.Context) ([]model.Resource, error) {
+	return []model.Resource{
+		{ID: "44444444-4444-4444-4444-444444444444", Name: "admin"},
+		{ID: "22222222-2222-2222-2222-222222222222", Name: "departments"},
+		{ID: "11111111-1111-1111-1111-111111111111", Name: "employees"},
+		{ID: "33333333-3333-3333-3333-333333333333", Name: "users"},
+	}, nil
+}
+
+func TestPDPHandler_HandleUserPermissions(t *testing.T) {
+	tests := []struct {
+		name          string
+		userID        string
+		caller        string
+		resourceType  string
+		wantStatus    int
+		wantResources []string
+		wantActions   []string
+		wantFields    int
+	}{
+		{
+			name:          "Manager_own_permissions",
+			userID:        testManagerUser,
+			caller:        testManagerUser,
+			wantStatus:    http.StatusOK,
+			wantResources: []string{"employees"},
+			wantActions:   []string{"break_glass", "view"},
+			wantFields:    9,
+		},
+		{
+			name:          "Employee_own_permissions",
+			userID:        testEmployeeUser,
+			caller:        testEmployeeUser,
+			wantStatus:    http.StatusOK,
+			wantResources: []string{"employees"},
+			wantActions:   []string{"view"},
+			wantFields:    4,
+		},
+		{
+			name:          "Resource_type_filter",
+			userID:        testManagerUser,
+			caller:        testManagerUser,
+			resourceType:  "departments",
+			wantStatus:    http.StatusOK,
+			wantResources: []string{},
+		},
+		{
+			name:          "Admin_asks_for_employee",
+			userID:        testEmployeeUser,
+			caller:        testAdminUser,
+			wantStatus:    http.StatusOK,
+			wantResources: []string{"employees"},
+			wantActions:   []string{"view"},
+			wantFields:    4,
+		},
+		{
+			name:       "Employee_asks_for_manager",
+			userID:     testManagerUser,
+			caller:     testEmployeeUser,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := newBreakGlassMockRepo()
+			mockRepo.GetResourcesFunc = getTestResources
+			handler := NewPDPHandler(mockRepo)
+			handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+
+			target := "/users/" + tt.userID + "/permissions"
+			if tt.resourceType != "" {
+				target += "?resource_type=" + tt.resourceType
+			}
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			setCallerToken(req, tt.caller)
+			rec := httptest.NewRecorder()
+			handler.HandleUserPermissions(rec, req, tt.userID)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("HandleUserPermissions() status = %v, want %v, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var permissions model.UserPermissions
+			if err := json.NewDecoder(rec.Body).Decode(&permissions); err != nil {
+				t.Fatalf("Failed to decode permissions: %v", err)
+			}
+			if permissions.UserID != tt.userID {
+				t.Errorf("user = %q, want %q", permissions.UserID, tt.userID)
+			}
+
+			resources := []string{}
+			for _, resource := range permissions.Resources {
+				resources = append(resources, resource.ResourceType)
+			}
+			if !reflect.DeepEqual(resources, tt.wantResources) {
+				t.Fatalf("resources = %v, want %v", resources, tt.wantResources)
+			}
+			if len(permissions.Resources) == 0 {
+				return
+			}
+
+			employees := permissions.Resources[0]
+			if employees.ResourceID != testEmployeesRes {
+				t.Errorf("resource ID = %q, want %q", employees.ResourceID, testEmployeesRes)
+			}
+			if !reflect.DeepEqual(employees.Actions, tt.wantActions) {
+				t.Errorf("actions = %v, want %v", employees.Actions, tt.wantActions)
+			}
+			if got := len(employees.AllowedFields["view"]); got != tt.wantFields {
+				t.Errorf("view fields = %v, want %d fields", employees.AllowedFields["view"], tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_userPermissions_roleSources(t *testing.T) {
+	tests := []struct {
+		name        string
+		repo        func() *mocks.MockRepository
+		pipRoles    map[string][]string
+		userID      string
+		wantActions []string
+	}{
+		{
+			// The manager may no longer view employees, but an active grant still gives access
+			name: "Active_break_glass_grant",
+			repo: func() *mocks.MockRepository {
+				repo := newBreakGlassMockRepo()
+				repo.GetUserRolesFunc = func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+					return []string{testManagerRole}, []model.RBACPermission{
+						{Role: testManagerRole, ResourceID: testEmployeesRes, Action: "break_glass"},
+					}, nil
+				}
+				repo.GetActiveBreakGlassGrantsFunc = func(ctx context.Context, userID string) ([]model.BreakGlassGrant, error) {
+					return []model.BreakGlassGrant{{
+						ID:           "grant-1",
+						UserID:       userID,
+						ResourceID:   testEmployeesRes,
+						ResourceType: "employees",
+						ExpiresAt:    time.Now().Add(time.Hour),
+					}}, nil
+				}
+				return repo
+			},
+			userID:      testManagerUser,
+			wantActions: []string{"break_glass", "view"},
+		},
+		{
+			// The PRP assigns the employee role, the PIP the manager role
+			name:        "Roles_from_PIP",
+			repo:        newBreakGlassMockRepo,
+			pipRoles:    map[string][]string{testEmployeeUser: {testManagerRole}},
+			userID:      testEmployeeUser,
+			wantActions: []string{"break_glass", "view"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := tt.repo()
+			repo.GetResourcesFunc = getTestResources
+			handler := NewPDPHandler(repo)
+			if tt.pipRoles != nil {
+				handler.SetPolicyInformationProvider(pkg.NewPIPClient(newRolesPIP(t, tt.pipRoles).URL, time.Second))
+			}
+
+			permissions, err := handler.userPermissions(handler.batchContext(context.Background()), tt.userID, "")
+			if err != nil {
+				t.Fatalf("userPermissions() error = %v", err)
+			}
+			if len(permissions.Resources) != 1 || permissions.Resources[0].ResourceType != "employees" {
+				t.Fatalf("userPermissions() resources = %+v, want employees", permissions.Resources)
+			}
+			if got := permissions.Resources[0].Actions; !reflect.DeepEqual(got, tt.wantActions) {
+				t.Errorf("userPermissions() actions = %v, want %v", got, tt.wantActions)
+			}
+		})
+	}
+}
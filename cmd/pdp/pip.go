@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+// defaultPIPTimeout is how long a request to the PIP may take
+const defaultPIPTimeout = 2 * time.Second
+
+// defaultPIPCacheTTL is how long subject information from the PIP is reused. Changes to a
+// subject's roles reach decisions that late, so it is kept short.
+const defaultPIPCacheTTL = 5 * time.Second
+
+// maxPIPCacheEntries is the number of cached lookups above which expired ones are evicted
+const maxPIPCacheEntries = 10000
+
+// SetPolicyInformationProvider makes the PIP the source of the subject's roles, attributes and relationships
+func (h *PDPHandler) SetPolicyInformationProvider(pip interfaces.PolicyInformationProvider) {
+	h.pip = pip
+}
+
+// pipFromEnv returns a client for the PIP at PDP_PIP_HOST with the timeout PDP_PIP_TIMEOUT,
+// caching lookups for PDP_PIP_CACHE_TTL, or nil if PDP_PIP_HOST is not set
+func pipFromEnv() (interfaces.PolicyInformationProvider, error) {
+	host := os.Getenv("PDP_PIP_HOST")
+	if host == "" {
+		return nil, nil
+	}
+
+	timeout, err := durationFromEnv("PDP_PIP_TIMEOUT", defaultPIPTimeout)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := durationFromEnv("PDP_PIP_CACHE_TTL", defaultPIPCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	var pip interfaces.PolicyInformationProvider = pkg.NewPIPClient(host, timeout)
+	if ttl > 0 {
+		pip = newCachedPIP(pip, ttl)
+	}
+	log.Printf("[INFO] Sourcing subject information from the PIP at %s (timeout %s, cache TTL %s)", host, timeout, ttl)
+	return pip, nil
+}
+
+// durationFromEnv parses the duration in the environment variable, or returns the default if it is not set
+func durationFromEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("invalid %s: must not be negative", name)
+	}
+	return duration, nil
+}
+
+// pipSubject is the information about a subject the PIP provides
+type pipSubject struct {
+	roles         []string
+	attributes    map[string]interface{}
+	relationships []map[string]interface{}
+}
+
+// subjectInformation looks the subject's roles, attributes and relationships up in the PIP
+func (h *PDPHandler) subjectInformation(ctx context.Context, userID string) (*pipSubject, error) {
+	roles, err := h.pip.GetRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := h.pip.GetAttributes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	relationships, err := h.pip.GetRelationships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := &pipSubject{
+		roles:         make([]string, 0, len(roles)),
+		attributes:    attributes,
+		relationships: make([]map[string]interface{}, 0, len(relationships)),
+	}
+	if subject.attributes == nil {
+		subject.attributes = map[string]interface{}{}
+	}
+	for _, role := range roles {
+		subject.roles = append(subject.roles, role.ID)
+	}
+	for _, rel := range relationships {
+		subject.relationships = append(subject.relationships, map[string]interface{}{
+			"subject_id": rel.SubjectID,
+			"object_id":  rel.ObjectID,
+			"type":       rel.Type,
+		})
+	}
+	return subject, nil
+}
+
+// cachedPIP reuses the PIP's answers for a user until they are older than the TTL.
+// Failed lookups are not cached.
+type cachedPIP struct {
+	pip     interfaces.PolicyInformationProvider
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[pipCacheKey]pipCacheEntry
+}
+
+type pipCacheKey struct {
+	lookup string
+	userID string
+}
+
+type pipCacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// newCachedPIP creates a cachedPIP in front of pip
+func newCachedPIP(pip interfaces.PolicyInformationProvider, ttl time.Duration) *cachedPIP {
+	return &cachedPIP{pip: pip, ttl: ttl, entries: make(map[pipCacheKey]pipCacheEntry)}
+}
+
+// cachedLookup returns the cached answer of the lookup for the user or fetches it
+func cachedLookup[T any](c *cachedPIP, lookup, userID string, fetch func() (T, error)) (T, error) {
+	key := pipCacheKey{lookup, userID}
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.value.(T), nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return value, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxPIPCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = pipCacheEntry{value: value, expiresAt: now.Add(c.ttl)}
+	return value, nil
+}
+
+func (c *cachedPIP) GetRoles(ctx context.Context, userID string) ([]model.Role, error) {
+	return cachedLookup(c, "roles", userID, func() ([]model.Role, error) {
+		return c.pip.GetRoles(ctx, userID)
+	})
+}
+
+func (c *cachedPIP) GetAttributes(ctx context.Context, userID string) (map[string]interface{}, error) {
+	return cachedLookup(c, "attributes", userID, func() (map[string]interface{}, error) {
+		return c.pip.GetAttributes(ctx, userID)
+	})
+}
+
+func (c *cachedPIP) GetRelationships(ctx context.Context, userID string) ([]model.Relationship, error) {
+	return cachedLookup(c, "relationships", userID, func() ([]model.Relationship, error) {
+		return c.pip.GetRelationships(ctx, userID)
+	})
+}
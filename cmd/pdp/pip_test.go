@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+// newTestPIP returns a PIP server assigning the employee role to the employee user, counting its requests
+func newTestPIP(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[0] != "users" {
+			http.NotFound(w, r)
+			return
+		}
+		userID := parts[1]
+
+		var body interface{}
+		switch parts[2] {
+		case "roles":
+			roles := []model.Role{}
+			if userID == testEmployeeUser {
+				roles = append(roles, model.Role{ID: testEmployeeRole, Name: "employee"})
+			}
+			body = roles
+		case "attributes":
+			body = map[string]interface{}{"location": "tokyo"}
+		case "relationships":
+			body = []model.Relationship{{SubjectID: testManagerUser, ObjectID: userID, Type: "manages"}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newRolesPIP returns a PIP server assigning the users the roles, without attributes or relationships
+func newRolesPIP(t *testing.T, userRoles map[string][]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[0] != "users" {
+			http.NotFound(w, r)
+			return
+		}
+		switch parts[2] {
+		case "roles":
+			roles := []model.Role{}
+			for _, id := range userRoles[parts[1]] {
+				roles = append(roles, model.Role{ID: id})
+			}
+			json.NewEncoder(w).Encode(roles)
+		case "attributes":
+			w.Write([]byte("{}"))
+		case "relationships":
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPDPHandler_rbacInput_pip(t *testing.T) {
+	var requests atomic.Int32
+	pip := newTestPIP(t, &requests)
+
+	handler := NewPDPHandler(newBreakGlassMockRepo())
+	handler.SetPolicyInformationProvider(pkg.NewPIPClient(pip.URL, time.Second))
+
+	input, err := handler.rbacInput(context.Background(), model.EvaluationRequest{UserID: testEmployeeUser, ResourceType: "employees", Action: "view"})
+	if err != nil {
+		t.Fatalf("rbacInput() error = %v", err)
+	}
+
+	user := input["user"].(map[string]interface{})
+	if !reflect.DeepEqual(user["attributes"], map[string]interface{}{"location": "tokyo"}) {
+		t.Errorf("user attributes = %v, want the PIP's attributes", user["attributes"])
+	}
+	wantRelationships := []map[string]interface{}{{"subject_id": testManagerUser, "object_id": testEmployeeUser, "type": "manages"}}
+	if !reflect.DeepEqual(user["relationships"], wantRelationships) {
+		t.Errorf("user relationships = %v, want %v", user["relationships"], wantRelationships)
+	}
+	wantRoles := []map[string]interface{}{{"user_id": testEmployeeUser, "role_id": testEmployeeRole}}
+	if !reflect.DeepEqual(input["user_roles"], wantRoles) {
+		t.Errorf("user roles = %v, want %v", input["user_roles"], wantRoles)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("PIP requests = %d, want 3", got)
+	}
+}
+
+func TestPDPHandler_evaluate_pip(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    string
+		wantAllow bool
+	}{
+		{
+			name:      "Role_from_PIP",
+			userID:    testEmployeeUser,
+			wantAllow: true,
+		},
+		{
+			// The PRP still grants the manager's permissions, but the PIP assigns no role
+			name:      "No_role_in_PIP",
+			userID:    testManagerUser,
+			wantAllow: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			pip := newTestPIP(t, &requests)
+
+			handler := NewPDPHandler(newBreakGlassMockRepo())
+			handler.SetPolicyInformationProvider(newCachedPIP(pkg.NewPIPClient(pip.URL, time.Second), time.Minute))
+
+			req := model.EvaluationRequest{UserID: tt.userID, ResourceType: "employees", Action: "view"}
+			for i := 0; i < 2; i++ {
+				response, err := handler.evaluate(context.Background(), req)
+				if err != nil {
+					t.Fatalf("evaluate() error = %v", err)
+				}
+				if response.Allow != tt.wantAllow {
+					t.Errorf("evaluate() allow = %v, want %v", response.Allow, tt.wantAllow)
+				}
+			}
+
+			// The second evaluation reads the cache
+			if got := requests.Load(); got != 3 {
+				t.Errorf("PIP requests = %d, want 3", got)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_evaluate_pipRoleGrants(t *testing.T) {
+	// The PIP assigns the manager the employee role, whatever the PRP's user roles say
+	pip := newRolesPIP(t, map[string][]string{testManagerUser: {testEmployeeRole}})
+
+	handler := NewPDPHandler(newBreakGlassMockRepo())
+	handler.SetPolicyInformationProvider(pkg.NewPIPClient(pip.URL, time.Second))
+
+	req := model.EvaluationRequest{UserID: testManagerUser, ResourceType: "employees", Action: "view"}
+	response, err := handler.evaluate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if want := []string{"id", "name", "department_name", "employment_type"}; !response.Allow || !reflect.DeepEqual(response.AllowedFields, want) {
+		t.Errorf("evaluate() = %v, %v, want the employee role's fields %v", response.Allow, response.AllowedFields, want)
+	}
+
+	// The manager's break_glass permission in the PRP is not granted through the PIP's roles
+	input, err := handler.rbacInput(context.Background(), req)
+	if err != nil {
+		t.Fatalf("rbacInput() error = %v", err)
+	}
+	for _, perm := range input["role_permissions"].([]map[string]interface{}) {
+		if perm["role_id"] != testEmployeeRole {
+			t.Errorf("role permission %v, want only those of the PIP's roles", perm)
+		}
+	}
+}
+
+func TestPDPHandler_evaluate_pipFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "Server_error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "database error", http.StatusInternalServerError)
+			},
+		},
+		{
+			name: "Timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+				w.Write([]byte("[]"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pip := httptest.NewServer(tt.handler)
+			defer pip.Close()
+
+			cache := newCachedPIP(pkg.NewPIPClient(pip.URL, 50*time.Millisecond), time.Minute)
+			handler := NewPDPHandler(newBreakGlassMockRepo())
+			handler.SetPolicyInformationProvider(cache)
+
+			req := model.EvaluationRequest{UserID: testEmployeeUser, ResourceType: "employees", Action: "view"}
+			if _, err := handler.evaluate(context.Background(), req); err == nil {
+				t.Errorf("evaluate() error = nil, want the PIP's error")
+			}
+			if len(cache.entries) != 0 {
+				t.Errorf("cache entries = %v, want failed lookups not cached", cache.entries)
+			}
+		})
+	}
+}
+
+func TestCachedPIP_expiry(t *testing.T) {
+	var requests atomic.Int32
+	pip := newTestPIP(t, &requests)
+	cache := newCachedPIP(pkg.NewPIPClient(pip.URL, time.Second), 20*time.Millisecond)
+
+	ctx := context.Background()
+	cache.GetRoles(ctx, testEmployeeUser)
+	cache.GetRoles(ctx, testEmployeeUser)
+	cache.GetRoles(ctx, testManagerUser)
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("PIP requests = %d, want 2 for two users", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	roles, err := cache.GetRoles(ctx, testEmployeeUser)
+	if err != nil || len(roles) != 1 {
+		t.Fatalf("GetRoles() = %v, %v, want the employee role", roles, err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("PIP requests = %d, want the expired lookup requested again", got)
+	}
+}
+
+func TestDurationFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "Default", want: defaultPIPTimeout},
+		{name: "Set", value: "500ms", want: 500 * time.Millisecond},
+		{name: "Zero", value: "0", want: 0},
+		{name: "Negative", value: "-1s", wantErr: true},
+		{name: "Invalid", value: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PDP_PIP_TIMEOUT", tt.value)
+			got, err := durationFromEnv("PDP_PIP_TIMEOUT", defaultPIPTimeout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("durationFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("durationFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
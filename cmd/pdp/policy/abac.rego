@@ -0,0 +1,19 @@
+package policy.abac
+
+import future.keywords.if
+import future.keywords.in
+
+# Attribute-based rules. Users may view the records of their own department.
+
+default allow := false
+
+allow if {
+    input.action.name == "view"
+    same_department
+}
+
+same_department if {
+    department_id := input.user.attributes.department_id
+    department_id != ""
+    department_id == input.resource.attributes.department_id
+}
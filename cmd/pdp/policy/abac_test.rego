@@ -0,0 +1,34 @@
+package policy
+
+import data.policy.abac
+import future.keywords.if
+
+abac_input(user_department, record_department, action) := {
+    "user": {
+        "id": "44444444-4444-4444-4444-444444444444", # Bob Engineer
+        "attributes": {"department_id": user_department}
+    },
+    "resource": {
+        "type": "employees",
+        "id": "11111111-1111-1111-1111-111111111111", # John Manager
+        "attributes": {"department_id": record_department}
+    },
+    "action": {"name": action}
+}
+
+# ABAC Test Cases
+test_abac_same_department_allows_view if {
+    abac.allow with input as abac_input("11111111-1111-1111-1111-111111111111", "11111111-1111-1111-1111-111111111111", "view")
+}
+
+test_abac_other_department_denies_view if {
+    not abac.allow with input as abac_input("11111111-1111-1111-1111-111111111111", "22222222-2222-2222-2222-222222222222", "view")
+}
+
+test_abac_same_department_denies_edit if {
+    not abac.allow with input as abac_input("11111111-1111-1111-1111-111111111111", "11111111-1111-1111-1111-111111111111", "edit")
+}
+
+test_abac_missing_attributes_deny if {
+    not abac.allow with input as abac_input("", "", "view")
+}
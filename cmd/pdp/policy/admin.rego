@@ -0,0 +1,17 @@
+package policy.admin
+
+import future.keywords.if
+import future.keywords.in
+
+# Administrative endpoints are closed unless explicitly granted
+default allow := false
+
+# A user may use administrative endpoints when one of their roles is
+# granted the manage action on the admin resource
+allow if {
+    some perm in input.role_permissions
+    perm.action_id == "manage"
+    perm.resource_id == input.resource.id
+
+    trace(sprintf("User %s is an administrator via role %s", [input.user.id, perm.role_id]))
+}
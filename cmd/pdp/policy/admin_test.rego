@@ -0,0 +1,35 @@
+package policy
+
+import data.policy.admin
+import future.keywords.if
+
+# Admin Test Cases
+test_admin_allow_manage_permission if {
+    admin.allow with input as {
+        "user": {"id": "99999999-9999-9999-9999-999999999999"}, # Ada Admin
+        "resource": {
+            "id": "44444444-4444-4444-4444-444444444444", # admin resource
+            "name": "admin"
+        },
+        "role_permissions": [{
+            "role_id": "44444444-4444-4444-4444-444444444444", # admin role
+            "resource_id": "44444444-4444-4444-4444-444444444444", # admin resource
+            "action_id": "manage"
+        }]
+    }
+}
+
+test_admin_deny_manager if {
+    not admin.allow with input as {
+        "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "resource": {
+            "id": "44444444-4444-4444-4444-444444444444", # admin resource
+            "name": "admin"
+        },
+        "role_permissions": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "edit"
+        }]
+    }
+}
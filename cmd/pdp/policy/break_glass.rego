@@ -0,0 +1,68 @@
+package policy.break_glass
+
+import data.policy.rbac
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+# Minimum number of characters a justification must have
+min_justification_length := 20
+
+# Fields granted while emergency access is active: the field permissions of the user's roles
+# for the break_glass action on the resource, administered in the PRP like any other field
+emergency_fields := [field |
+    some i, field in granted
+    not field in array.slice(granted, 0, i)
+] if {
+    granted := [perm.field |
+        some perm in input.field_permissions
+        perm.action_id == "break_glass"
+        perm.resource_id == input.resource.id
+        perm.role_id in held_roles
+    ]
+}
+
+# The user's roles and every role they inherit from
+held_roles contains role_id if {
+    some user_role in input.user_roles
+    some role_id in rbac.inherited_roles(user_role.role_id)
+}
+
+default allow_request := false
+
+# A user may request emergency access when one of their roles is granted
+# the break_glass action on the resource and a justification is given
+allow_request if {
+    count(trim_space(input.justification)) >= min_justification_length
+
+    some perm in input.role_permissions
+    perm.action_id == "break_glass"
+    perm.resource_id == input.resource.id
+
+    trace(sprintf("Break-glass request for %s allowed via role %s", [input.resource.name, perm.role_id]))
+}
+
+# Default evaluation result
+default result := {"allow": false, "allowed_fields": [], "filtered_data": null}
+
+# Full access to the resource while an unexpired grant exists
+result := response if {
+    grant_ids := {grant.id |
+        some grant in input.break_glass_grants
+        grant.resource_type == input.resource.name
+        time.parse_rfc3339_ns(grant.expires_at) > time.now_ns()
+    }
+    trace(sprintf("Active break-glass grants: %v", [grant_ids]))
+    count(grant_ids) > 0
+
+    fields := emergency_fields
+    trace(sprintf("Emergency fields: %v", [fields]))
+    count(fields) > 0
+
+    response := {
+        "allow": true,
+        "allowed_fields": fields,
+        "filtered_data": rbac.filter_data(fields),
+        "grant_id": min(grant_ids)
+    }
+}
@@ -0,0 +1,129 @@
+package policy
+
+import data.policy.break_glass
+import future.keywords.if
+import future.keywords.in
+
+# Break-glass Test Cases
+test_break_glass_manager_can_request_with_justification if {
+    break_glass.allow_request with input as {
+        "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "role_permissions": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "break_glass"
+        }],
+        "justification": "INC-1234 payroll outage, need to verify records"
+    }
+}
+
+test_break_glass_deny_short_justification if {
+    not break_glass.allow_request with input as {
+        "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "role_permissions": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "break_glass"
+        }],
+        "justification": "   urgent   "
+    }
+}
+
+test_break_glass_deny_request_without_permission if {
+    not break_glass.allow_request with input as {
+        "user": {"id": "44444444-4444-4444-4444-444444444444"}, # Bob Engineer
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "role_permissions": [{
+            "role_id": "22222222-2222-2222-2222-222222222222", # employee role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "view"
+        }],
+        "justification": "INC-1234 payroll outage, need to verify records"
+    }
+}
+
+# Emergency fields of the manager role on employees, as administered in the PRP
+break_glass_field_permissions := [perm |
+    some field in ["id", "name", "email", "department_name"]
+    perm := {
+        "role_id": "11111111-1111-1111-1111-111111111111",
+        "resource_id": "11111111-1111-1111-1111-111111111111",
+        "action_id": "break_glass",
+        "field": field
+    }
+]
+
+test_break_glass_active_grant_gives_full_access if {
+    result := break_glass.result with input as {
+        "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "user_roles": [{"user_id": "11111111-1111-1111-1111-111111111111", "role_id": "11111111-1111-1111-1111-111111111111"}],
+        "field_permissions": break_glass_field_permissions,
+        "break_glass_grants": [{
+            "id": "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+            "resource_type": "employees",
+            "expires_at": "2200-01-01T00:00:00Z"
+        }],
+        "data": data_employees
+    }
+
+    result.allow
+    result.grant_id == "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+    result.allowed_fields == ["id", "name", "email", "department_name"]
+    result.filtered_data.employees[0].email == data_employees.employees[0].email
+}
+
+test_break_glass_grant_without_emergency_fields_is_ignored if {
+    result := break_glass.result with input as {
+        "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "user_roles": [{"user_id": "11111111-1111-1111-1111-111111111111", "role_id": "11111111-1111-1111-1111-111111111111"}],
+        "field_permissions": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "view",
+            "field": "email"
+        }],
+        "break_glass_grants": [{
+            "id": "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+            "resource_type": "employees",
+            "expires_at": "2200-01-01T00:00:00Z"
+        }]
+    }
+
+    not result.allow
+}
+
+test_break_glass_expired_grant_is_ignored if {
+    result := break_glass.result with input as {
+        "user": {"id": "44444444-4444-4444-4444-444444444444"}, # Bob Engineer
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "break_glass_grants": [{
+            "id": "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+            "resource_type": "employees",
+            "expires_at": "2000-01-01T00:00:00Z"
+        }]
+    }
+
+    not result.allow
+}
@@ -0,0 +1,72 @@
+package policy.environment
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+# Helpers for rules on the context of a request, e.g. salary fields only from the
+# corporate network or contractors only during business hours:
+#
+#   allow if {
+#       environment.in_zone("corporate")
+#       environment.business_hours
+#   }
+
+# Network zones, mapping zone names to the CIDRs they consist of
+default network_zones := {}
+
+network_zones := data.config.network_zones
+
+# Zones the client IP of the request is in
+zones contains zone if {
+    ip := input.environment.client_ip
+    ip != ""
+    some zone, cidrs in network_zones
+    some cidr in cidrs
+    net.cidr_contains(cidr, ip)
+}
+
+# The request comes from the network zone
+in_zone(zone) if {
+    zone in zones
+}
+
+# Working days and hours, Monday to Friday from 9 to 18 unless config.business_hours of the
+# policy data sets "days", "start" or "end"; each key it omits keeps its default. They are
+# evaluated in the timezone configured in "timezone", or else in the timezone the PEP is
+# configured with; the timezone the client declares is ignored.
+default business_hours_config := {}
+
+business_hours_config := data.config.business_hours
+
+business_days := object.get(business_hours_config, "days", ["Monday", "Tuesday", "Wednesday", "Thursday", "Friday"])
+
+business_hours_start := object.get(business_hours_config, "start", 9)
+
+business_hours_end := object.get(business_hours_config, "end", 18)
+
+# Timezone business hours are evaluated in
+business_hours_timezone := object.get(business_hours_config, "timezone", input.environment.timezone)
+
+# Hour, minute and second of the request in the business hours timezone
+clock := time.clock([input.environment.time_ns, business_hours_timezone])
+
+# Day of the week of the request in the business hours timezone
+weekday := time.weekday([input.environment.time_ns, business_hours_timezone])
+
+# The request is made during the working hours
+business_hours if {
+    weekday in business_days
+    clock[0] >= business_hours_start
+    clock[0] < business_hours_end
+}
+
+# The request is made over TLS
+secure_transport if {
+    input.environment.tls.version != ""
+}
+
+# The client authenticated with a certificate
+client_certificate if {
+    input.environment.tls.client_certificate == true
+}
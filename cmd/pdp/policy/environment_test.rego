@@ -0,0 +1,105 @@
+package policy
+
+import data.policy.environment
+import future.keywords.if
+
+office_zones := {
+    "corporate": ["10.0.0.0/8", "192.168.1.0/24"],
+    "vpn": ["10.8.0.0/16"]
+}
+
+environment_input(client_ip, time_ns, timezone) := {"environment": {
+    "client_ip": client_ip,
+    "time_ns": time_ns,
+    "timezone": timezone
+}}
+
+# Monday 10:00 in Tokyo, 01:00 UTC
+monday_morning_tokyo := 1792371600000000000
+
+# Saturday 10:00 in Tokyo
+saturday_morning_tokyo := 1792198800000000000
+
+# Network Zone Test Cases
+test_environment_zones_match_every_cidr if {
+    zones := environment.zones with input as environment_input("10.8.1.2", monday_morning_tokyo, "UTC")
+        with data.config.network_zones as office_zones
+    zones == {"corporate", "vpn"}
+}
+
+test_environment_in_zone if {
+    environment.in_zone("corporate") with input as environment_input("192.168.1.20", monday_morning_tokyo, "UTC")
+        with data.config.network_zones as office_zones
+}
+
+test_environment_outside_zones if {
+    not environment.in_zone("corporate") with input as environment_input("203.0.113.5", monday_morning_tokyo, "UTC")
+        with data.config.network_zones as office_zones
+}
+
+test_environment_without_client_ip if {
+    count(environment.zones) == 0 with input as environment_input("", monday_morning_tokyo, "UTC")
+        with data.config.network_zones as office_zones
+}
+
+test_environment_ipv6_client if {
+    environment.in_zone("office6") with input as environment_input("2001:db8::1", monday_morning_tokyo, "UTC")
+        with data.config.network_zones as {"office6": ["2001:db8::/32"]}
+}
+
+# Business Hours Test Cases
+test_environment_business_hours_in_environment_timezone if {
+    environment.business_hours with input as environment_input("", monday_morning_tokyo, "Asia/Tokyo")
+}
+
+test_environment_outside_business_hours_in_utc if {
+    not environment.business_hours with input as environment_input("", monday_morning_tokyo, "UTC")
+}
+
+test_environment_weekend if {
+    environment.weekday == "Saturday" with input as environment_input("", saturday_morning_tokyo, "Asia/Tokyo")
+    not environment.business_hours with input as environment_input("", saturday_morning_tokyo, "Asia/Tokyo")
+}
+
+test_environment_configured_business_hours if {
+    environment.business_hours with input as environment_input("", monday_morning_tokyo, "UTC")
+        with data.config.business_hours as {"days": ["Monday"], "start": 0, "end": 6}
+}
+
+test_environment_configured_business_hours_timezone if {
+    environment.business_hours with input as environment_input("", monday_morning_tokyo, "UTC")
+        with data.config.business_hours as {"days": ["Monday"], "start": 9, "end": 18, "timezone": "Asia/Tokyo"}
+}
+
+# Keys the configuration omits keep their defaults
+test_environment_partial_business_hours_timezone if {
+    environment.business_hours with input as environment_input("", monday_morning_tokyo, "UTC")
+        with data.config.business_hours as {"timezone": "Asia/Tokyo"}
+}
+
+test_environment_partial_business_hours_days if {
+    not environment.business_hours with input as environment_input("", saturday_morning_tokyo, "Asia/Tokyo")
+        with data.config.business_hours as {"start": 8}
+    environment.business_hours with input as environment_input("", saturday_morning_tokyo, "Asia/Tokyo")
+        with data.config.business_hours as {"days": ["Saturday"]}
+}
+
+test_environment_client_timezone_ignored if {
+    not environment.business_hours with input as {"environment": {
+        "client_ip": "",
+        "time_ns": monday_morning_tokyo,
+        "timezone": "UTC",
+        "client_timezone": "Asia/Tokyo"
+    }}
+}
+
+# Transport Test Cases
+test_environment_secure_transport if {
+    environment.secure_transport with input as {"environment": {"tls": {"version": "TLS 1.3", "client_certificate": true}}}
+    environment.client_certificate with input as {"environment": {"tls": {"version": "TLS 1.3", "client_certificate": true}}}
+}
+
+test_environment_plain_transport if {
+    not environment.secure_transport with input as {"environment": {}}
+    not environment.client_certificate with input as {"environment": {}}
+}
@@ -0,0 +1,37 @@
+package policy.impersonation
+
+import future.keywords.if
+import future.keywords.in
+
+# Operators may not impersonate anyone unless explicitly granted
+default allow := false
+
+# Actions that make a user privileged. Acting as a privileged user would give the operator
+# the target's privileges, so privileged users cannot be impersonated.
+default privileged_actions := ["manage", "impersonate", "break_glass"]
+
+privileged_actions := data.config.impersonation.privileged_actions
+
+# An operator may act as another user when one of their roles is granted
+# the impersonate action on the users resource and the target is not privileged
+allow if {
+    input.operator.id != input.target.id
+    input.target.id != ""
+    not privileged_target
+
+    some perm in input.role_permissions
+    perm.action_id == "impersonate"
+    perm.resource_id == input.resource.id
+
+    trace(sprintf("Operator %s may impersonate %s via role %s",
+        [input.operator.id, input.target.id, perm.role_id]))
+}
+
+# The target holds a privileged action through one of their roles
+privileged_target if {
+    some perm in input.target.role_permissions
+    perm.action_id in privileged_actions
+
+    trace(sprintf("Target %s is privileged, holding %s via role %s",
+        [input.target.id, perm.action_id, perm.role_id]))
+}
@@ -0,0 +1,137 @@
+package policy
+
+import data.policy.impersonation
+import future.keywords.if
+
+# Impersonation Test Cases
+test_impersonation_support_can_act_as_employee if {
+    impersonation.allow with input as {
+        "operator": {"id": "88888888-8888-8888-8888-888888888888"}, # Sam Support
+        "target": {
+            "id": "44444444-4444-4444-4444-444444444444", # Bob Engineer
+            "role_permissions": [{
+                "role_id": "22222222-2222-2222-2222-222222222222", # employee role
+                "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+                "action_id": "view"
+            }]
+        },
+        "resource": {
+            "id": "33333333-3333-3333-3333-333333333333", # users resource
+            "name": "users"
+        },
+        "role_permissions": [{
+            "role_id": "33333333-3333-3333-3333-333333333333", # support role
+            "resource_id": "33333333-3333-3333-3333-333333333333", # users resource
+            "action_id": "impersonate"
+        }]
+    }
+}
+
+test_impersonation_deny_without_permission if {
+    not impersonation.allow with input as {
+        "operator": {"id": "44444444-4444-4444-4444-444444444444"}, # Bob Engineer
+        "target": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "resource": {
+            "id": "33333333-3333-3333-3333-333333333333", # users resource
+            "name": "users"
+        },
+        "role_permissions": [{
+            "role_id": "22222222-2222-2222-2222-222222222222", # employee role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "view"
+        }]
+    }
+}
+
+test_impersonation_deny_self if {
+    not impersonation.allow with input as {
+        "operator": {"id": "88888888-8888-8888-8888-888888888888"}, # Sam Support
+        "target": {"id": "88888888-8888-8888-8888-888888888888"}, # Sam Support
+        "resource": {
+            "id": "33333333-3333-3333-3333-333333333333", # users resource
+            "name": "users"
+        },
+        "role_permissions": [{
+            "role_id": "33333333-3333-3333-3333-333333333333", # support role
+            "resource_id": "33333333-3333-3333-3333-333333333333", # users resource
+            "action_id": "impersonate"
+        }]
+    }
+}
+
+test_impersonation_deny_admin_target if {
+    not impersonation.allow with input as {
+        "operator": {"id": "88888888-8888-8888-8888-888888888888"}, # Sam Support
+        "target": {
+            "id": "99999999-9999-9999-9999-999999999999", # Ada Admin
+            "role_permissions": [{
+                "role_id": "44444444-4444-4444-4444-444444444444", # admin role
+                "resource_id": "44444444-4444-4444-4444-444444444444", # admin resource
+                "action_id": "manage"
+            }]
+        },
+        "resource": {
+            "id": "33333333-3333-3333-3333-333333333333", # users resource
+            "name": "users"
+        },
+        "role_permissions": [{
+            "role_id": "33333333-3333-3333-3333-333333333333", # support role
+            "resource_id": "33333333-3333-3333-3333-333333333333", # users resource
+            "action_id": "impersonate"
+        }]
+    }
+}
+
+test_impersonation_deny_break_glass_target if {
+    not impersonation.allow with input as {
+        "operator": {"id": "88888888-8888-8888-8888-888888888888"}, # Sam Support
+        "target": {
+            "id": "11111111-1111-1111-1111-111111111111", # John Manager
+            "role_permissions": [
+                {
+                    "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+                    "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+                    "action_id": "view"
+                },
+                {
+                    "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+                    "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+                    "action_id": "break_glass"
+                }
+            ]
+        },
+        "resource": {
+            "id": "33333333-3333-3333-3333-333333333333", # users resource
+            "name": "users"
+        },
+        "role_permissions": [{
+            "role_id": "33333333-3333-3333-3333-333333333333", # support role
+            "resource_id": "33333333-3333-3333-3333-333333333333", # users resource
+            "action_id": "impersonate"
+        }]
+    }
+}
+
+test_impersonation_privileged_actions_from_data if {
+    impersonation.allow with input as {
+        "operator": {"id": "88888888-8888-8888-8888-888888888888"}, # Sam Support
+        "target": {
+            "id": "99999999-9999-9999-9999-999999999999", # Ada Admin
+            "role_permissions": [{
+                "role_id": "44444444-4444-4444-4444-444444444444", # admin role
+                "resource_id": "44444444-4444-4444-4444-444444444444", # admin resource
+                "action_id": "manage"
+            }]
+        },
+        "resource": {
+            "id": "33333333-3333-3333-3333-333333333333", # users resource
+            "name": "users"
+        },
+        "role_permissions": [{
+            "role_id": "33333333-3333-3333-3333-333333333333", # support role
+            "resource_id": "33333333-3333-3333-3333-333333333333", # users resource
+            "action_id": "impersonate"
+        }]
+    }
+        with data.config.impersonation.privileged_actions as ["impersonate"]
+}
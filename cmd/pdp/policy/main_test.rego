@@ -2,6 +2,7 @@ package policy
 
 import data.policy.rbac
 import future.keywords.if
+import future.keywords.in
 
 # Test data for RBAC test cases
 data_employees := {
@@ -18,6 +19,40 @@ data_employees := {
     }]
 }
 
+# Field permissions as administered in the PRP
+employee_fields := {
+    "11111111-1111-1111-1111-111111111111": ["id", "name", "email", "department_id", "department_name", "employment_type_id", "employment_type", "position", "joined_at"], # manager role
+    "22222222-2222-2222-2222-222222222222": ["id", "name", "department_name", "employment_type"] # employee role
+}
+
+field_permissions := [perm |
+    some role_id, fields in employee_fields
+    some field in fields
+    perm := {
+        "role_id": role_id,
+        "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+        "action_id": "11111111-1111-1111-1111-111111111111", # view action
+        "field": field
+    }
+]
+
+# Fields each purpose of use may expose as administered in the PRP
+employee_purpose_fields := {
+    "payroll": ["id", "name", "email", "employment_type_id", "employment_type", "joined_at"],
+    "performance_review": ["id", "name", "department_id", "department_name", "position", "joined_at"],
+    "support": ["id", "name", "email", "department_name"]
+}
+
+purpose_fields := [purpose_field |
+    some purpose, fields in employee_purpose_fields
+    some field in fields
+    purpose_field := {
+        "purpose": purpose,
+        "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+        "field": field
+    }
+]
+
 # RBAC Test Cases
 test_rbac_manager_can_view_all_employee_fields if {
     result := rbac.result with input as {
@@ -27,6 +62,7 @@ test_rbac_manager_can_view_all_employee_fields if {
         "user_roles": [{
             "role_id": "11111111-1111-1111-1111-111111111111"  # manager role
         }],
+        "field_permissions": field_permissions,
         "role_permissions": [{
             "role_id": "11111111-1111-1111-1111-111111111111",  # manager role
             "resource_id": "11111111-1111-1111-1111-111111111111",  # employees resource
@@ -58,6 +94,7 @@ test_rbac_employee_can_view_limited_employee_fields if {
         "user_roles": [{
             "role_id": "22222222-2222-2222-2222-222222222222"  # employee role
         }],
+        "field_permissions": field_permissions,
         "role_permissions": [{
             "role_id": "22222222-2222-2222-2222-222222222222",  # employee role
             "resource_id": "11111111-1111-1111-1111-111111111111",  # employees resource
@@ -97,6 +134,7 @@ test_rbac_deny_departments_access if {
             "id": "11111111-1111-1111-1111-111111111111", # view action
             "name": "view"
         },
+        "field_permissions": field_permissions,
         "role_permissions": []
     }
 
@@ -104,21 +142,388 @@ test_rbac_deny_departments_access if {
     result.filtered_data == null
 }
 
+test_rbac_manager_can_view_departments if {
+    result := rbac.result with input as {
+        "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
+        "resource": {
+            "id": "22222222-2222-2222-2222-222222222222", # departments resource
+            "name": "departments"
+        },
+        "action": {
+            "id": "11111111-1111-1111-1111-111111111111", # view action
+            "name": "view"
+        },
+        "field_permissions": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "22222222-2222-2222-2222-222222222222", # departments resource
+            "action_id": "11111111-1111-1111-1111-111111111111", # view action
+            "field": "name"
+        }],
+        "role_permissions": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "22222222-2222-2222-2222-222222222222", # departments resource
+            "action_id": "11111111-1111-1111-1111-111111111111" # view action
+        }],
+        "data": {"departments": [{"id": "dep1", "name": "Engineering"}]}
+    }
+
+    result.allow
+    result.allowed_fields == ["name"]
+    result.filtered_data == {"departments": [{"name": "Engineering"}]}
+}
+
 test_rbac_deny_invalid_resource if {
     result := rbac.result with input as {
         "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
         "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
         "resource": {
-            "id": "33333333-3333-3333-3333-333333333333", # invalid resource
+            "id": "", # not registered in the PRP
             "name": "invalid_resource"
         },
         "action": {
             "id": "11111111-1111-1111-1111-111111111111", # view action
             "name": "view"
         },
+        "field_permissions": field_permissions,
         "role_permissions": []
     }
 
     not result.allow
     result.filtered_data == null
 }
+
+# Role Inheritance Test Cases
+view_employees_permission(role_id) := {
+    "role_id": role_id,
+    "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+    "action_id": "11111111-1111-1111-1111-111111111111" # view action
+}
+
+employees_view_input := {
+    "user": {"id": "11111111-1111-1111-1111-111111111111"},
+    "resource": {
+        "id": "11111111-1111-1111-1111-111111111111", # employees resource
+        "name": "employees"
+    },
+    "action": {
+        "id": "11111111-1111-1111-1111-111111111111", # view action
+        "name": "view"
+    }
+}
+
+payroll_viewer_input := object.union(employees_view_input, {
+    "user_roles": [
+        {"role_id": "22222222-2222-2222-2222-222222222222"}, # employee role
+        {"role_id": "55555555-5555-5555-5555-555555555555"} # payroll viewer role
+    ],
+    "field_permissions": array.concat(field_permissions, [{
+        "role_id": "55555555-5555-5555-5555-555555555555",
+        "resource_id": "11111111-1111-1111-1111-111111111111",
+        "action_id": "11111111-1111-1111-1111-111111111111",
+        "field": "employment_type_id"
+    }, {
+        "role_id": "55555555-5555-5555-5555-555555555555",
+        "resource_id": "11111111-1111-1111-1111-111111111111",
+        "action_id": "11111111-1111-1111-1111-111111111111",
+        "field": "id"
+    }]),
+    "role_permissions": [
+        view_employees_permission("22222222-2222-2222-2222-222222222222"),
+        view_employees_permission("55555555-5555-5555-5555-555555555555")
+    ]
+})
+
+test_rbac_union_of_role_fields if {
+    result := rbac.result with input as payroll_viewer_input
+
+    result.allow
+    result.allowed_fields == ["id", "name", "department_name", "employment_type", "employment_type_id"]
+    result.field_sources == {
+        "id": ["22222222-2222-2222-2222-222222222222", "55555555-5555-5555-5555-555555555555"],
+        "name": ["22222222-2222-2222-2222-222222222222"],
+        "department_name": ["22222222-2222-2222-2222-222222222222"],
+        "employment_type": ["22222222-2222-2222-2222-222222222222"],
+        "employment_type_id": ["55555555-5555-5555-5555-555555555555"]
+    }
+}
+
+test_rbac_most_privileged_role_combination if {
+    result := rbac.result with input as payroll_viewer_input
+        with data.config.rbac.role_combination as "most_privileged"
+
+    result.allow
+    result.allowed_fields == ["id", "name", "department_name", "employment_type"]
+    result.field_sources.id == ["22222222-2222-2222-2222-222222222222"]
+    not result.field_sources.employment_type_id
+}
+
+test_rbac_union_with_superset_role if {
+    result := rbac.result with input as object.union(employees_view_input, {
+        "user_roles": [
+            {"role_id": "11111111-1111-1111-1111-111111111111"}, # manager role
+            {"role_id": "22222222-2222-2222-2222-222222222222"} # employee role
+        ],
+        "field_permissions": field_permissions,
+        "role_permissions": [
+            view_employees_permission("11111111-1111-1111-1111-111111111111"),
+            view_employees_permission("22222222-2222-2222-2222-222222222222")
+        ]
+    })
+
+    result.allow
+    result.allowed_fields == employee_fields["11111111-1111-1111-1111-111111111111"]
+    result.field_sources.email == ["11111111-1111-1111-1111-111111111111"]
+}
+
+test_rbac_explanation if {
+    explanation := rbac.explanation with input as payroll_viewer_input
+        with data.config.rbac.role_combination as "most_privileged"
+
+    explanation.matched_roles == ["22222222-2222-2222-2222-222222222222", "55555555-5555-5555-5555-555555555555"]
+    explanation.combined_roles == ["22222222-2222-2222-2222-222222222222"]
+    explanation.permissions == {
+        view_employees_permission("22222222-2222-2222-2222-222222222222"),
+        view_employees_permission("55555555-5555-5555-5555-555555555555")
+    }
+    explanation.field_sources.id == ["22222222-2222-2222-2222-222222222222"]
+}
+
+test_rbac_explanation_of_denial if {
+    explanation := rbac.explanation with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "22222222-2222-2222-2222-222222222222"}], # employee role
+        "field_permissions": field_permissions,
+        "role_permissions": []
+    })
+
+    explanation == {"matched_roles": [], "combined_roles": [], "permissions": set(), "field_sources": {}}
+}
+
+test_rbac_inherited_permissions_and_fields if {
+    result := rbac.result with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "55555555-5555-5555-5555-555555555555"}], # team lead role without permissions of its own
+        "role_parents": [{
+            "role_id": "55555555-5555-5555-5555-555555555555",
+            "parent_id": "22222222-2222-2222-2222-222222222222" # employee role
+        }],
+        "field_permissions": array.concat([{
+            "role_id": "55555555-5555-5555-5555-555555555555",
+            "resource_id": "11111111-1111-1111-1111-111111111111",
+            "action_id": "11111111-1111-1111-1111-111111111111",
+            "field": "position"
+        }], field_permissions),
+        "role_permissions": [view_employees_permission("22222222-2222-2222-2222-222222222222")]
+    })
+
+    result.allow
+    result.allowed_fields == ["position", "id", "name", "department_name", "employment_type"]
+}
+
+test_rbac_transitive_inheritance if {
+    result := rbac.result with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "55555555-5555-5555-5555-555555555555"}],
+        "role_parents": [
+            {"role_id": "55555555-5555-5555-5555-555555555555", "parent_id": "66666666-6666-6666-6666-666666666666"},
+            {"role_id": "66666666-6666-6666-6666-666666666666", "parent_id": "11111111-1111-1111-1111-111111111111"} # manager role
+        ],
+        "field_permissions": field_permissions,
+        "role_permissions": [view_employees_permission("11111111-1111-1111-1111-111111111111")]
+    })
+
+    result.allow
+    result.allowed_fields == employee_fields["11111111-1111-1111-1111-111111111111"]
+}
+
+test_rbac_inheritance_cycle_grants_nothing if {
+    result := rbac.result with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "55555555-5555-5555-5555-555555555555"}],
+        "role_parents": [
+            {"role_id": "55555555-5555-5555-5555-555555555555", "parent_id": "66666666-6666-6666-6666-666666666666"},
+            {"role_id": "66666666-6666-6666-6666-666666666666", "parent_id": "55555555-5555-5555-5555-555555555555"},
+            {"role_id": "66666666-6666-6666-6666-666666666666", "parent_id": "11111111-1111-1111-1111-111111111111"} # manager role
+        ],
+        "field_permissions": field_permissions,
+        "role_permissions": [view_employees_permission("11111111-1111-1111-1111-111111111111")]
+    })
+
+    not result.allow
+}
+
+# Purpose-of-use Test Cases
+test_rbac_manager_payroll_purpose_limits_fields if {
+    result := rbac.result with input as {
+        "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
+        "field_permissions": field_permissions,
+        "role_permissions": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "11111111-1111-1111-1111-111111111111" # view action
+        }],
+        "role_purposes": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "purpose": "payroll"
+        }],
+        "purpose_fields": purpose_fields,
+        "purpose": "payroll",
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "action": {
+            "id": "11111111-1111-1111-1111-111111111111", # view action
+            "name": "view"
+        },
+        "data": data_employees
+    }
+
+    result.allow
+    result.allowed_fields == ["id", "name", "email", "employment_type_id", "employment_type", "joined_at"]
+    result.filtered_data.employees[0].email == data_employees.employees[0].email
+    not result.filtered_data.employees[0].position
+}
+
+test_rbac_manager_performance_review_purpose_limits_fields if {
+    result := rbac.result with input as {
+        "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+        "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
+        "field_permissions": field_permissions,
+        "role_permissions": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "11111111-1111-1111-1111-111111111111" # view action
+        }],
+        "role_purposes": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "purpose": "performance_review"
+        }],
+        "purpose_fields": purpose_fields,
+        "purpose": "performance_review",
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "action": {
+            "id": "11111111-1111-1111-1111-111111111111", # view action
+            "name": "view"
+        }
+    }
+
+    result.allow
+    result.allowed_fields == ["id", "name", "department_id", "department_name", "position", "joined_at"]
+    not "email" in result.allowed_fields
+}
+
+test_rbac_deny_unregistered_purpose if {
+    result := rbac.result with input as {
+        "user": {"id": "44444444-4444-4444-4444-444444444444"}, # Bob Engineer
+        "user_roles": [{"role_id": "22222222-2222-2222-2222-222222222222"}], # employee role
+        "field_permissions": field_permissions,
+        "role_permissions": [{
+            "role_id": "22222222-2222-2222-2222-222222222222", # employee role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "action_id": "11111111-1111-1111-1111-111111111111" # view action
+        }],
+        "role_purposes": [{
+            "role_id": "22222222-2222-2222-2222-222222222222", # employee role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "purpose": "support"
+        }],
+        "purpose_fields": purpose_fields,
+        "purpose": "payroll",
+        "resource": {
+            "id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "name": "employees"
+        },
+        "action": {
+            "id": "11111111-1111-1111-1111-111111111111", # view action
+            "name": "view"
+        }
+    }
+
+    not result.allow
+}
+
+test_rbac_purpose_fields_come_from_the_input if {
+    result := rbac.result with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
+        "field_permissions": field_permissions,
+        "role_permissions": [view_employees_permission("11111111-1111-1111-1111-111111111111")],
+        "role_purposes": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "purpose": "audit"
+        }],
+        "purpose_fields": [{
+            "purpose": "audit",
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "field": "joined_at"
+        }],
+        "purpose": "audit"
+    })
+
+    result.allow
+    result.allowed_fields == ["joined_at"]
+}
+
+test_rbac_purpose_bound_role_without_purpose_is_restricted if {
+    result := rbac.result with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
+        "field_permissions": field_permissions,
+        "role_permissions": [view_employees_permission("11111111-1111-1111-1111-111111111111")],
+        "role_purposes": [
+            {
+                "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+                "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+                "purpose": "payroll"
+            },
+            {
+                "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+                "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+                "purpose": "performance_review"
+            }
+        ],
+        "purpose_fields": purpose_fields
+    })
+
+    # Only the fields both payroll and performance reviews may expose
+    result.allow
+    result.allowed_fields == ["id", "name", "joined_at"]
+}
+
+test_rbac_inherited_purpose_binding_restricts_without_purpose if {
+    result := rbac.result with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
+        "role_parents": [{"role_id": "11111111-1111-1111-1111-111111111111", "parent_id": "22222222-2222-2222-2222-222222222222"}],
+        "field_permissions": field_permissions,
+        "role_permissions": [view_employees_permission("11111111-1111-1111-1111-111111111111")],
+        "role_purposes": [{
+            "role_id": "22222222-2222-2222-2222-222222222222", # employee role
+            "resource_id": "11111111-1111-1111-1111-111111111111", # employees resource
+            "purpose": "support"
+        }],
+        "purpose_fields": purpose_fields
+    })
+
+    result.allow
+    result.allowed_fields == ["id", "name", "email", "department_name"]
+}
+
+test_rbac_purpose_binding_for_other_resource_does_not_restrict if {
+    result := rbac.result with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
+        "field_permissions": field_permissions,
+        "role_permissions": [view_employees_permission("11111111-1111-1111-1111-111111111111")],
+        "role_purposes": [{
+            "role_id": "11111111-1111-1111-1111-111111111111", # manager role
+            "resource_id": "22222222-2222-2222-2222-222222222222", # departments resource
+            "purpose": "payroll"
+        }],
+        "purpose_fields": purpose_fields
+    })
+
+    result.allow
+    count(result.allowed_fields) == 9
+}
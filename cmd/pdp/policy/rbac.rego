@@ -1,23 +1,29 @@
 package policy.rbac
 
+import future.keywords.contains
+import future.keywords.every
 import future.keywords.if
+import future.keywords.in
 
 # Default evaluation result
 default result = {"allow": false, "allowed_fields": [], "filtered_data": null}
 
+# How the fields of several roles granting access are combined: "union" grants
+# every field any of them grants, "most_privileged" only those of the role granting the most
+default role_combination := "union"
+
+role_combination := data.config.rbac.role_combination
+
 # Main policy evaluation rule
 result = response if {
-    # Find allowed role with highest privilege
-    roles := [role_id |
-        role_id := input.user_roles[_].role_id
-        has_access_permission(role_id)
-    ]
-    trace(sprintf("Found roles with access: %v", [roles]))
-    count(roles) > 0
-    role_id := max(roles)
+    trace(sprintf("Found roles with access: %v", [access_roles]))
+    count(access_roles) > 0
 
-    # Get allowed fields for the role
-    allowed_fields := get_allowed_fields(role_id)
+    # Get allowed fields for the combined roles and the declared purpose
+    role_fields := {role_id: apply_purpose(role_id, get_allowed_fields(role_id)) |
+        some role_id in combined_roles(access_roles)
+    }
+    allowed_fields := combine_fields(role_fields)
     trace(sprintf("Allowed fields: %v", [allowed_fields]))
 
     # Filter data if present
@@ -27,10 +33,68 @@ result = response if {
     response := {
         "allow": true,
         "allowed_fields": allowed_fields,
+        "field_sources": field_sources(role_fields),
         "filtered_data": filtered_data
     }
 }
 
+# Roles granting access, directly or through the roles they inherit from
+access_roles contains role_id if {
+    role_id := input.user_roles[_].role_id
+    role_has_access(role_id)
+    purpose_permitted(role_id)
+}
+
+# Why the decision was made, returned by the explain API
+explanation := {
+    "matched_roles": sort(access_roles),
+    "combined_roles": sort(contributing_roles),
+    "permissions": matched_permissions,
+    "field_sources": object.get(result, "field_sources", {})
+}
+
+# Roles whose fields are combined into the allowed fields
+default contributing_roles := set()
+
+contributing_roles := combined_roles(access_roles)
+
+# Permissions for the action on the resource held through the roles granting access
+matched_permissions contains perm if {
+    some role_id in access_roles
+    some perm in input.role_permissions
+    perm.role_id in inherited_roles(role_id)
+    perm.action_id == input.action.id
+    match_resource_permission(perm)
+}
+
+# Roles whose fields are combined
+combined_roles(roles) := roles if {
+    role_combination != "most_privileged"
+}
+
+combined_roles(roles) := {most_privileged_role(roles)} if {
+    role_combination == "most_privileged"
+}
+
+# Fields granted by any of the roles, in role ID order without duplicates
+combine_fields(role_fields) := fields if {
+    all_fields := [field |
+        some role_id in sort(object.keys(role_fields))
+        some field in role_fields[role_id]
+    ]
+    fields := [field |
+        some i, field in all_fields
+        not field in array.slice(all_fields, 0, i)
+    ]
+}
+
+# Roles that contributed each allowed field
+field_sources(role_fields) := {field: sort(roles) |
+    some fields in role_fields
+    some field in fields
+    roles := {role_id | some role_id, granted in role_fields; field in granted}
+}
+
 # Filter data based on resource type and allowed fields
 filter_data(allowed_fields) = filtered if {
     trace(sprintf("Starting filter_data for resource: %s", [input.resource.name]))
@@ -83,50 +147,159 @@ default filter_fields(object, allowed_fields) = {}
 has_access_permission(role_id) = result if {
     trace(sprintf("Checking access for role %s", [role_id]))
 
-    # Find matching permission
-    matching_perm := [perm |
+    # Find a permission for the action on the resource
+    matching_perms := [perm |
         perm := input.role_permissions[_]
         perm.role_id == role_id
         perm.action_id == input.action.id
-    ][0]
+        match_resource_permission(perm)
+    ]
 
-    # Check resource permission
-    result := match_resource_permission(matching_perm)
+    result := count(matching_perms) > 0
     trace(sprintf("Access check result: %v", [result]))
 }
 
 default has_access_permission(role_id) = false
 
-# Check permission for resource
-match_resource_permission(perm) = result if {
-    resource_permissions := {
-        "employees": "11111111-1111-1111-1111-111111111111"
-    }
+# Roles that appear in the role inheritance graph
+graph_roles contains input.user_roles[_].role_id
 
-    expected_id := resource_permissions[input.resource.name]
-    result := perm.resource_id == expected_id
+graph_roles contains input.role_parents[_].role_id
+
+graph_roles contains input.role_parents[_].parent_id
+
+# Role inheritance graph: every role points to the roles it inherits from
+role_graph[role_id] := parents if {
+    some role_id in graph_roles
+    parents := {edge.parent_id | some edge in input.role_parents; edge.role_id == role_id}
+}
+
+# The role itself and every role it inherits from, directly or transitively
+inherited_roles(role_id) := graph.reachable(role_graph, {role_id})
+
+# Roles that inherit from themselves through a cycle of role parents
+cyclic_roles contains role_id if {
+    some role_id, parents in role_graph
+    role_id in graph.reachable(role_graph, parents)
+}
+
+# A role whose inheritance runs into a cycle is misconfigured and grants nothing
+inherits_cycle(role_id) if {
+    some inherited in inherited_roles(role_id)
+    inherited in cyclic_roles
+    trace(sprintf("Ignoring role %s: role inheritance cycle through %s", [role_id, inherited]))
+}
+
+# Check access permission of the role or a role it inherits from
+role_has_access(role_id) if {
+    not inherits_cycle(role_id)
+    some inherited in inherited_roles(role_id)
+    has_access_permission(inherited)
+}
+
+# The role granting the most fields; ties go to the lowest role ID
+most_privileged_role(roles) := role_id if {
+    field_counts := {r: count(apply_purpose(r, get_allowed_fields(r))) | some r in roles}
+    most := max([n | some n in field_counts])
+    role_id := min({r | some r, n in field_counts; n == most})
+}
+
+# Check permission for the requested resource, whose ID the PDP resolves from the PRP
+match_resource_permission(perm) = result if {
+    is_string(input.resource.id)
+    input.resource.id != ""
+    result := perm.resource_id == input.resource.id
 
     trace(sprintf("Checking permission for resource %s: expected=%s, actual=%s, result=%v",
-        [input.resource.name, expected_id, perm.resource_id, result]))
+        [input.resource.name, input.resource.id, perm.resource_id, result]))
 }
 
 default match_resource_permission(perm) = false
 
 # Get list of fields user can access (for response)
+# Field permissions are administered in the PRP and passed in the input
 get_allowed_fields(role_id) = fields if {
-    field_permissions := {
-        "11111111-1111-1111-1111-111111111111": { # manager role
-            "employees": ["id", "name", "email", "department_id", "department_name", "employment_type_id", "employment_type", "position", "joined_at"]
-        },
-        "22222222-2222-2222-2222-222222222222": { # employee role
-            "employees": ["id", "name", "department_name", "employment_type"]
-        }
-    }
-
-    role_perms := field_permissions[role_id]
-    fields := object.get(role_perms, input.resource.name, [])
+    # The role's own fields come first, then those of the roles it inherits from
+    ordered_roles := array.concat([role_id], sort({r | some r in inherited_roles(role_id); r != role_id}))
+    inherited_fields := [perm.field |
+        some r in ordered_roles
+        some perm in input.field_permissions
+        perm.role_id == r
+        perm.action_id == input.action.id
+        match_resource_permission(perm)
+    ]
+    fields := [field |
+        some i, field in inherited_fields
+        not field in array.slice(inherited_fields, 0, i)
+    ]
     trace(sprintf("Getting allowed fields for role %s and resource %s: %v",
         [role_id, input.resource.name, fields]))
 }
 
 default get_allowed_fields(role_id) = []
+
+# Fields the purpose of use may expose for the resource
+# Purpose field sets are administered in the PRP and passed in the input
+purpose_allowed_fields(purpose) := {pf.field |
+    some pf in input.purpose_fields
+    pf.purpose == purpose
+    match_resource_permission(pf)
+}
+
+# Purposes the role, or a role it inherits from, is bound to for the resource
+bound_purposes(role_id) := {role_purpose.purpose |
+    some role_purpose in input.role_purposes
+    role_purpose.role_id in inherited_roles(role_id)
+    match_resource_permission(role_purpose)
+}
+
+# Check whether a purpose of use was declared
+has_purpose if {
+    is_string(input.purpose)
+    input.purpose != ""
+}
+
+# Without a declared purpose every role with access may be used
+purpose_permitted(role_id) if {
+    not has_purpose
+}
+
+# A declared purpose must be registered for the role, or a role it inherits from, and resource
+purpose_permitted(role_id) if {
+    has_purpose
+    input.purpose in bound_purposes(role_id)
+
+    trace(sprintf("Role %s may access %s for purpose %s", [role_id, input.resource.name, input.purpose]))
+}
+
+# Restrict allowed fields to those the declared purpose may expose
+apply_purpose(role_id, fields) = restricted if {
+    has_purpose
+    purpose_allowed := purpose_allowed_fields(input.purpose)
+    restricted := [field |
+        field := fields[_]
+        field in purpose_allowed
+    ]
+    trace(sprintf("Fields allowed for purpose %s: %v", [input.purpose, restricted]))
+}
+
+# Without a declared purpose a role bound to purposes for the resource only exposes the fields
+# every one of its purposes may expose, so that omitting the purpose never widens access
+apply_purpose(role_id, fields) = restricted if {
+    not has_purpose
+    purposes := bound_purposes(role_id)
+    count(purposes) > 0
+    restricted := [field |
+        field := fields[_]
+        every purpose in purposes {
+            field in purpose_allowed_fields(purpose)
+        }
+    ]
+    trace(sprintf("Fields allowed for role %s without a declared purpose: %v", [role_id, restricted]))
+}
+
+# Roles not bound to any purpose for the resource keep their fields when none is declared
+apply_purpose(role_id, fields) = fields if {
+    not has_purpose
+    count(bound_purposes(role_id)) == 0
+}
@@ -0,0 +1,20 @@
+package policy.rebac
+
+import future.keywords.if
+import future.keywords.in
+
+# Relationship-based rules. A relationship from the user to the record grants the
+# actions configured for its type in config.rebac.relations of the policy data.
+
+default relation_actions := {"manages": ["view", "edit"]}
+
+relation_actions := data.config.rebac.relations
+
+default allow := false
+
+allow if {
+    some relationship in input.relationships
+    relationship.subject_id == input.user.id
+    relationship.object_id == input.resource.id
+    input.action.name in object.get(relation_actions, relationship.type, [])
+}
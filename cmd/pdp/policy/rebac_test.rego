@@ -0,0 +1,45 @@
+package policy
+
+import data.policy.rebac
+import future.keywords.if
+
+rebac_input(relationship_type, action) := {
+    "user": {"id": "11111111-1111-1111-1111-111111111111"}, # John Manager
+    "resource": {
+        "type": "employees",
+        "id": "44444444-4444-4444-4444-444444444444" # Bob Engineer
+    },
+    "action": {"name": action},
+    "relationships": [{
+        "subject_id": "11111111-1111-1111-1111-111111111111",
+        "object_id": "44444444-4444-4444-4444-444444444444",
+        "type": relationship_type
+    }]
+}
+
+# ReBAC Test Cases
+test_rebac_manager_may_view_report if {
+    rebac.allow with input as rebac_input("manages", "view")
+}
+
+test_rebac_unknown_relationship_denies if {
+    not rebac.allow with input as rebac_input("mentors", "view")
+}
+
+test_rebac_relationship_to_other_record_denies if {
+    not rebac.allow with input as object.union(rebac_input("manages", "view"), {
+        "resource": {"type": "employees", "id": "55555555-5555-5555-5555-555555555555"}
+    })
+}
+
+test_rebac_configured_relations if {
+    rebac.allow with input as rebac_input("mentors", "view")
+        with data.config.rebac.relations as {"mentors": ["view"]}
+}
+
+test_rebac_reverse_relationship_denies if {
+    not rebac.allow with input as object.union(rebac_input("manages", "view"), {
+        "user": {"id": "44444444-4444-4444-4444-444444444444"},
+        "resource": {"type": "employees", "id": "11111111-1111-1111-1111-111111111111"}
+    })
+}
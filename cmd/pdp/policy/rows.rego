@@ -0,0 +1,29 @@
+package policy.rows
+
+import data.policy.rbac
+import future.keywords.if
+import future.keywords.in
+
+# Row-level rules for listing a resource. The PDP evaluates them partially with
+# input.record unknown and compiles what remains into a row filter.
+
+# Row scopes of roles per resource, configured in config.rows of the policy data
+default row_scopes := {}
+
+row_scopes := data.config.rows
+
+# A role granting access without a scope may read every row
+row_scope(role_id) := object.get(row_scopes, [input.resource.name, role_id], "all")
+
+# Roles granting access to the resource may read every row
+allow if {
+    some role_id in rbac.access_roles
+    row_scope(role_id) == "all"
+}
+
+# Roles scoped to the subject's own rows may read the record of the subject
+allow if {
+    some role_id in rbac.access_roles
+    row_scope(role_id) == "self"
+    input.record.id == input.user.id
+}
@@ -0,0 +1,49 @@
+package policy
+
+import data.policy.rows
+import future.keywords.if
+
+employee_rows_input(record) := object.union(employees_view_input, {
+    "user": {"id": "44444444-4444-4444-4444-444444444444"}, # Bob Engineer
+    "user_roles": [{"role_id": "22222222-2222-2222-2222-222222222222"}], # employee role
+    "role_permissions": [view_employees_permission("22222222-2222-2222-2222-222222222222")],
+    "record": record
+})
+
+row_scopes := {"employees": {"22222222-2222-2222-2222-222222222222": "self"}}
+
+# Rows Test Cases
+test_rows_self_scope_allows_own_record if {
+    rows.allow with input as employee_rows_input({"id": "44444444-4444-4444-4444-444444444444"})
+        with data.config.rows as row_scopes
+}
+
+test_rows_self_scope_denies_other_records if {
+    not rows.allow with input as employee_rows_input({"id": "11111111-1111-1111-1111-111111111111"})
+        with data.config.rows as row_scopes
+}
+
+test_rows_unscoped_role_allows_every_record if {
+    rows.allow with input as employee_rows_input({"id": "11111111-1111-1111-1111-111111111111"})
+        with data.config.rows as {}
+}
+
+test_rows_manager_allows_every_record if {
+    rows.allow with input as object.union(employees_view_input, {
+        "user_roles": [{"role_id": "11111111-1111-1111-1111-111111111111"}], # manager role
+        "role_parents": [{
+            "role_id": "11111111-1111-1111-1111-111111111111",
+            "parent_id": "22222222-2222-2222-2222-222222222222"
+        }],
+        "role_permissions": [view_employees_permission("11111111-1111-1111-1111-111111111111")],
+        "record": {"id": "44444444-4444-4444-4444-444444444444"}
+    })
+        with data.config.rows as row_scopes
+}
+
+test_rows_deny_without_access if {
+    not rows.allow with input as object.union(employee_rows_input({"id": "44444444-4444-4444-4444-444444444444"}), {
+        "role_permissions": []
+    })
+        with data.config.rows as row_scopes
+}
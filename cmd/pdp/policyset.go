@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/tester"
+)
+
+// defaultPolicyPath is where policies are loaded from when PDP_POLICY_PATH is unset
+const defaultPolicyPath = "policy"
+
+// PolicySet is the compiled set of policy modules and data documents the PDP evaluates
+type PolicySet struct {
+	// Source is the directory or bundle file the policies were loaded from
+	Source string
+	// Revision is the bundle manifest revision, or a digest of the modules and data without one
+	Revision string
+	// Modules are the paths of the loaded policy modules
+	Modules []string
+
+	compiler *ast.Compiler
+	store    storage.Store
+	modules  map[string]*ast.Module
+	tests    map[string]*ast.Module
+	sources  map[string]string
+	data     map[string]interface{}
+}
+
+// policyPathFromEnv returns the policy directory or bundle configured by PDP_POLICY_PATH
+func policyPathFromEnv() string {
+	if path := os.Getenv("PDP_POLICY_PATH"); path != "" {
+		return path
+	}
+	return defaultPolicyPath
+}
+
+// LoadPolicySet loads every Rego module and data.json/data.yaml document from a
+// directory or an OPA bundle (.tar.gz) and compiles the modules together.
+// Rego test files are kept aside for RunTests and are not evaluated by the PDP.
+func LoadPolicySet(path string) (*PolicySet, error) {
+	b, err := loader.NewFileLoader().
+		WithProcessAnnotation(true).
+		AsBundle(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+
+	parsed := make(map[string]*ast.Module, len(b.Modules))
+	sources := make(map[string]string, len(b.Modules))
+	for _, module := range b.Modules {
+		// Modules are named relative to the source so versions from different sources compare
+		name := strings.TrimPrefix(strings.TrimPrefix(module.Path, path), "/")
+		parsed[name] = module.Parsed
+		sources[name] = string(module.Raw)
+	}
+
+	return newPolicySet(path, b.Manifest.Revision, parsed, sources, b.Data)
+}
+
+// NewPolicySetFromSources parses and compiles Rego module sources keyed by file name
+func NewPolicySetFromSources(source, revision string, sources map[string]string, data map[string]interface{}) (*PolicySet, error) {
+	parsed := make(map[string]*ast.Module, len(sources))
+	var parseErrors ast.Errors
+	for name, src := range sources {
+		module, err := ast.ParseModuleWithOpts(name, src, ast.ParserOptions{ProcessAnnotation: true})
+		if err != nil {
+			var errs ast.Errors
+			if errors.As(err, &errs) {
+				parseErrors = append(parseErrors, errs...)
+				continue
+			}
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		parsed[name] = module
+	}
+	if len(parseErrors) > 0 {
+		return nil, fmt.Errorf("failed to parse policies: %w", parseErrors)
+	}
+
+	return newPolicySet(source, revision, parsed, sources, data)
+}
+
+// newPolicySet compiles the parsed modules. Without a revision, a digest of the modules and data is used.
+func newPolicySet(source, revision string, parsed map[string]*ast.Module, sources map[string]string, data map[string]interface{}) (*PolicySet, error) {
+	modules := make(map[string]*ast.Module, len(parsed))
+	tests := make(map[string]*ast.Module)
+	paths := make([]string, 0, len(parsed))
+	for name, module := range parsed {
+		if strings.HasSuffix(name, "_test.rego") {
+			tests[name] = module
+			continue
+		}
+		modules[name] = module
+		paths = append(paths, name)
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no policy modules found in %s", source)
+	}
+	sort.Strings(paths)
+
+	compiler := ast.NewCompiler()
+	if compiler.Compile(modules); compiler.Failed() {
+		return nil, fmt.Errorf("failed to compile policies: %w", compiler.Errors)
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	if revision == "" {
+		digest := sha256.New()
+		for _, path := range paths {
+			fmt.Fprintf(digest, "%s\n%s\n", path, modules[path].String())
+		}
+		if err := json.NewEncoder(digest).Encode(data); err != nil {
+			return nil, fmt.Errorf("failed to digest policy data: %w", err)
+		}
+		revision = "sha256:" + hex.EncodeToString(digest.Sum(nil))[:12]
+	}
+
+	return &PolicySet{
+		Source:   source,
+		Revision: revision,
+		Modules:  paths,
+		compiler: compiler,
+		store:    inmem.NewFromObject(data),
+		modules:  modules,
+		tests:    tests,
+		sources:  sources,
+		data:     data,
+	}, nil
+}
+
+// RunTests runs the Rego tests shipped with the policies and reports every failing test
+func (p *PolicySet) RunTests(ctx context.Context) error {
+	if len(p.tests) == 0 {
+		return nil
+	}
+
+	results, err := p.testResults(ctx, targetRego)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, result := range results {
+		if !result.Pass() && !result.Skip {
+			failures = append(failures, result.String())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d policy tests failed:\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// testResults runs the Rego tests shipped with the policies on the evaluation target
+func (p *PolicySet) testResults(ctx context.Context, target string) ([]*tester.Result, error) {
+	modules := make(map[string]*ast.Module, len(p.modules)+len(p.tests))
+	for path, module := range p.modules {
+		modules[path] = module
+	}
+	for path, module := range p.tests {
+		modules[path] = module
+	}
+
+	ch, err := tester.NewRunner().
+		SetStore(inmem.NewFromObject(p.data)).
+		SetModules(modules).
+		Target(target).
+		RunTests(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run policy tests: %w", err)
+	}
+
+	var results []*tester.Result
+	for result := range ch {
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Prepare prepares the query against the policy set for evaluation
+func (p *PolicySet) Prepare(query string) (*rego.PreparedEvalQuery, error) {
+	return p.PrepareTarget(query, targetRego)
+}
+
+// PrepareTarget prepares the query against the policy set for evaluation on the target.
+// For the Wasm target the query and the rules it depends on are compiled to a Wasm module.
+func (p *PolicySet) PrepareTarget(query, target string) (*rego.PreparedEvalQuery, error) {
+	prepared, err := rego.New(
+		rego.Query(query),
+		rego.Compiler(p.compiler),
+		rego.Store(p.store),
+		rego.Target(target),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare %s: %w", query, err)
+	}
+
+	return &prepared, nil
+}
+
+// PreparePartial prepares a query for partial evaluation against the policy set
+func (p *PolicySet) PreparePartial(query string) (*rego.PreparedPartialQuery, error) {
+	prepared, err := rego.New(
+		rego.Query(query),
+		rego.Compiler(p.compiler),
+		rego.Store(p.store),
+	).PrepareForPartial(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare %s for partial evaluation: %w", query, err)
+	}
+
+	return &prepared, nil
+}
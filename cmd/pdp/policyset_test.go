@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// writeBundle writes the files as a gzipped tarball bundle
+func writeBundle(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write tar content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar writer: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("Failed to close gzip writer: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+}
+
+func TestLoadPolicySet_directory(t *testing.T) {
+	policies, err := LoadPolicySet("policy")
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+
+	for _, module := range policies.Modules {
+		if strings.HasSuffix(module, "_test.rego") {
+			t.Errorf("LoadPolicySet() loaded test module %s", module)
+		}
+	}
+	for _, want := range []string{"main.rego", "rbac.rego", "break_glass.rego"} {
+		found := false
+		for _, module := range policies.Modules {
+			found = found || filepath.Base(module) == want
+		}
+		if !found {
+			t.Errorf("LoadPolicySet() modules = %v, want %s", policies.Modules, want)
+		}
+	}
+}
+
+func TestLoadPolicySet_bundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	writeBundle(t, path, map[string]string{
+		"/.manifest": `{"revision": "v42"}`,
+		"/data.json": `{"config": {"min_level": 3}}`,
+		"/policy/level.rego": `package policy.level
+
+import future.keywords.if
+
+allow if input.level >= data.config.min_level
+`,
+		"/policy/level_test.rego": `package policy.level
+
+import future.keywords.if
+
+test_allow if allow with input as {"level": 3}
+`,
+	})
+
+	policies, err := LoadPolicySet(path)
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+	if policies.Revision != "v42" {
+		t.Errorf("LoadPolicySet() revision = %q, want %q", policies.Revision, "v42")
+	}
+	if len(policies.Modules) != 1 {
+		t.Errorf("LoadPolicySet() modules = %v, want only the policy module", policies.Modules)
+	}
+	if err := policies.RunTests(context.Background()); err != nil {
+		t.Errorf("RunTests() error = %v", err)
+	}
+
+	query, err := policies.Prepare("data.policy.level.allow")
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	results, err := query.Eval(context.Background(), rego.EvalInput(map[string]interface{}{"level": 5}))
+	if err != nil {
+		t.Fatalf("Eval() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Expressions[0].Value != true {
+		t.Errorf("Eval() = %v, want allow using data.json", results)
+	}
+}
+
+func TestLoadPolicySet_compileError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.rego"), []byte(`package policy.broken
+
+import future.keywords.if
+
+allow if data.policy.missing.fn(input)
+`), 0o644); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+
+	_, err := LoadPolicySet(dir)
+	if err == nil {
+		t.Fatal("LoadPolicySet() error = nil, want compile error")
+	}
+	if !strings.Contains(err.Error(), "broken.rego") {
+		t.Errorf("LoadPolicySet() error = %v, want it to name the failing file", err)
+	}
+}
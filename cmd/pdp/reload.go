@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultPolicyPollInterval is how often the policy source is checked for changes
+const defaultPolicyPollInterval = 10 * time.Second
+
+// PolicyStatus describes the active policy and the latest reload attempt
+type PolicyStatus struct {
+	Revision        string          `json:"revision"`
+	Source          string          `json:"source"`
+	Modules         []string        `json:"modules"`
+	LoadedAt        time.Time       `json:"loaded_at"`
+	EvalTarget      string          `json:"eval_target"`
+	LastCheckedAt   *time.Time      `json:"last_checked_at,omitempty"`
+	LastReloadError string          `json:"last_reload_error,omitempty"`
+	PRPSnapshot     *SnapshotStatus `json:"prp_snapshot,omitempty"`
+}
+
+// reloadStatus records the outcome of the latest policy reload attempt
+type reloadStatus struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// record updates the status after a check. The error of the latest change is kept
+// until the source changes again.
+func (s *reloadStatus) record(changed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkedAt = time.Now()
+	if changed || err != nil {
+		s.err = err
+	}
+}
+
+// PolicySource is where the PDP loads its policies from
+type PolicySource interface {
+	// Fingerprint changes whenever the policies in the source may have changed
+	Fingerprint(ctx context.Context) (string, error)
+	// Load loads and compiles the policies in the source
+	Load(ctx context.Context) (*PolicySet, error)
+	String() string
+}
+
+// fileSource loads policies from a directory or bundle file
+type fileSource struct {
+	path string
+}
+
+// NewFileSource creates a PolicySource for a policy directory or bundle file
+func NewFileSource(path string) PolicySource {
+	return &fileSource{path: path}
+}
+
+func (s *fileSource) Fingerprint(ctx context.Context) (string, error) {
+	return sourceFingerprint(s.path)
+}
+
+func (s *fileSource) Load(ctx context.Context) (*PolicySet, error) {
+	return LoadPolicySet(s.path)
+}
+
+func (s *fileSource) String() string {
+	return s.path
+}
+
+// policySourceFromEnv returns the source configured by PDP_POLICY_SOURCE: "file"
+// (the default) for PDP_POLICY_PATH, or "database" for the active PRP policy version
+func policySourceFromEnv(h *PDPHandler) (PolicySource, error) {
+	switch source := os.Getenv("PDP_POLICY_SOURCE"); source {
+	case "", "file":
+		return NewFileSource(policyPathFromEnv()), nil
+	case "database":
+		return NewDatabaseSource(h.repo, h.tenantID), nil
+	default:
+		return nil, fmt.Errorf("unknown PDP_POLICY_SOURCE %q", source)
+	}
+}
+
+// SetPolicySource sets the source the PDP's policies are loaded from. Policy versions
+// can only be activated when it is the database.
+func (h *PDPHandler) SetPolicySource(source PolicySource) {
+	h.source = source
+}
+
+// PolicyWatcher polls the policy source and swaps in changed policies
+// once they compile and the Rego tests shipped with them pass
+type PolicyWatcher struct {
+	handler     *PDPHandler
+	source      PolicySource
+	interval    time.Duration
+	fingerprint string
+}
+
+// NewPolicyWatcher creates a watcher for the policy source. The first check loads
+// the source and activates it unless it has the revision already in force.
+func NewPolicyWatcher(handler *PDPHandler, source PolicySource, interval time.Duration) *PolicyWatcher {
+	return &PolicyWatcher{
+		handler:  handler,
+		source:   source,
+		interval: interval,
+	}
+}
+
+// policyPollIntervalFromEnv returns the interval configured by PDP_POLICY_POLL_INTERVAL; 0 disables polling
+func policyPollIntervalFromEnv() (time.Duration, error) {
+	value := os.Getenv("PDP_POLICY_POLL_INTERVAL")
+	if value == "" {
+		return defaultPolicyPollInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PDP_POLICY_POLL_INTERVAL: %w", err)
+	}
+	return interval, nil
+}
+
+// Run checks the policy source every interval until the context is canceled
+func (w *PolicyWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Check reloads the policies if their source changed since the last check and
+// reports whether a new revision was activated. The active policy is kept on failure.
+func (w *PolicyWatcher) Check(ctx context.Context) (bool, error) {
+	fingerprint, err := w.source.Fingerprint(ctx)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check policy source: %v", err)
+		w.handler.reload.record(false, err)
+		return false, err
+	}
+	if fingerprint == w.fingerprint {
+		w.handler.reload.record(false, nil)
+		return false, nil
+	}
+	// Remember the change even if it fails so a broken policy is reported once, not on every poll
+	w.fingerprint = fingerprint
+
+	activated, err := w.reload(ctx)
+	if err != nil {
+		log.Printf("[ERROR] Policy reload failed, keeping revision %s: %v", w.handler.active.Load().policies.Revision, err)
+	}
+	w.handler.reload.record(true, err)
+	return activated, err
+}
+
+// reload loads, tests and activates the policies in the source
+func (w *PolicyWatcher) reload(ctx context.Context) (bool, error) {
+	policies, err := w.source.Load(ctx)
+	if err != nil {
+		return false, err
+	}
+	active := w.handler.active.Load().policies
+	if policies.Revision == active.Revision {
+		return false, nil
+	}
+	if err := policies.RunTests(ctx); err != nil {
+		return false, fmt.Errorf("revision %s rejected: %w", policies.Revision, err)
+	}
+	if err := w.handler.swapPolicies(policies); err != nil {
+		return false, fmt.Errorf("revision %s rejected: %w", policies.Revision, err)
+	}
+
+	log.Printf("[INFO] Activated policy revision %s (was %s) from %s", policies.Revision, active.Revision, w.source)
+	return true, nil
+}
+
+// sourceFingerprint summarizes the names, sizes and modification times of the files in the policy source
+func sourceFingerprint(source string) (string, error) {
+	digest := sha256.New()
+	err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(digest, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read policy source: %w", err)
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// HandlePolicyStatus reports the active policy revision, the latest reload attempt and the PRP snapshot
+func (h *PDPHandler) HandlePolicyStatus(w http.ResponseWriter, r *http.Request) {
+	active := h.active.Load()
+	status := PolicyStatus{
+		Revision:   active.policies.Revision,
+		Source:     active.policies.Source,
+		Modules:    active.policies.Modules,
+		LoadedAt:   active.loadedAt,
+		EvalTarget: active.target,
+	}
+
+	h.reload.mu.Lock()
+	if !h.reload.checkedAt.IsZero() {
+		checkedAt := h.reload.checkedAt
+		status.LastCheckedAt = &checkedAt
+	}
+	if h.reload.err != nil {
+		status.LastReloadError = h.reload.err.Error()
+	}
+	h.reload.mu.Unlock()
+
+	if h.snapshot != nil {
+		snapshot := h.snapshot.Status()
+		status.PRPSnapshot = &snapshot
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// copyPolicies copies the policy directory so a test can change it
+func copyPolicies(t testing.TB) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files, err := filepath.Glob("policy/*.rego")
+	if err != nil {
+		t.Fatalf("Failed to list policies: %v", err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read policy: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), content, 0o644); err != nil {
+			t.Fatalf("Failed to write policy: %v", err)
+		}
+	}
+	return dir
+}
+
+func appendPolicy(t *testing.T, path, content string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open policy: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+}
+
+func TestPolicyWatcher_Check(t *testing.T) {
+	dir := copyPolicies(t)
+	policies, err := LoadPolicySet(dir)
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+	handler, err := newPDPHandler(newBreakGlassMockRepo(), policies)
+	if err != nil {
+		t.Fatalf("newPDPHandler() error = %v", err)
+	}
+	watcher := NewPolicyWatcher(handler, NewFileSource(dir), time.Minute)
+	initial := policies.Revision
+
+	evaluateRevision := func() string {
+		t.Helper()
+		response, err := handler.evaluate(context.Background(), model.EvaluationRequest{
+			UserID:       testManagerUser,
+			ResourceType: "employees",
+			ResourceID:   testEmployeesRes,
+			Action:       "view",
+		})
+		if err != nil {
+			t.Fatalf("evaluate() error = %v", err)
+		}
+		return response.PolicyRevision
+	}
+
+	if got := evaluateRevision(); got != initial {
+		t.Errorf("evaluate() revision = %q, want %q", got, initial)
+	}
+
+	// Unchanged source
+	if activated, err := watcher.Check(context.Background()); activated || err != nil {
+		t.Errorf("Check() unchanged = %v, %v, want false, nil", activated, err)
+	}
+
+	// A policy change whose Rego tests fail keeps the active policy
+	appendPolicy(t, filepath.Join(dir, "main.rego"), "\nreload_marker := true\n")
+	appendPolicy(t, filepath.Join(dir, "reload_test.rego"), "package policy\n\nimport future.keywords.if\n\ntest_reload_marker if not reload_marker\n")
+	if activated, err := watcher.Check(context.Background()); activated || err == nil {
+		t.Errorf("Check() failing test = %v, %v, want false and an error", activated, err)
+	}
+	if got := evaluateRevision(); got != initial {
+		t.Errorf("evaluate() revision after failed reload = %q, want %q", got, initial)
+	}
+
+	// A compile error keeps the active policy
+	if err := os.Remove(filepath.Join(dir, "reload_test.rego")); err != nil {
+		t.Fatalf("Failed to remove test: %v", err)
+	}
+	appendPolicy(t, filepath.Join(dir, "rbac.rego"), "\nbroken if undefined_function(input)\n")
+	if activated, err := watcher.Check(context.Background()); activated || err == nil {
+		t.Errorf("Check() compile error = %v, %v, want false and an error", activated, err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.HandlePolicyStatus(rec, httptest.NewRequest(http.MethodGet, "/policy/status", nil))
+	var status PolicyStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.Revision != initial || status.LastReloadError == "" {
+		t.Errorf("HandlePolicyStatus() = %+v, want revision %q and the reload error", status, initial)
+	}
+
+	// A valid change is activated
+	content, err := os.ReadFile("policy/rbac.rego")
+	if err != nil {
+		t.Fatalf("Failed to read policy: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "rbac.rego"), append(content, []byte("\nreloaded := true\n")...), 0o644); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+	if activated, err := watcher.Check(context.Background()); !activated || err != nil {
+		t.Fatalf("Check() valid change = %v, %v, want true, nil", activated, err)
+	}
+	if got := evaluateRevision(); got == initial || got == "" {
+		t.Errorf("evaluate() revision after reload = %q, want a new revision", got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.HandlePolicyStatus(rec, httptest.NewRequest(http.MethodGet, "/policy/status", nil))
+	status = PolicyStatus{}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.Revision == initial || status.LastReloadError != "" {
+		t.Errorf("HandlePolicyStatus() = %+v, want the new revision without error", status)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// shadowQueueSize is how many decisions may wait for the candidate policy before new ones are dropped
+const shadowQueueSize = 1024
+
+// ShadowEvaluator evaluates a candidate policy alongside the active one.
+// Its decisions are never enforced; divergences are only recorded.
+type ShadowEvaluator struct {
+	query *rego.PreparedEvalQuery
+	queue chan shadowJob
+
+	mu      sync.Mutex
+	diffLog io.Writer
+
+	evaluations atomic.Int64
+	divergences atomic.Int64
+	allowFlips  atomic.Int64
+	fieldDiffs  atomic.Int64
+	errors      atomic.Int64
+	dropped     atomic.Int64
+}
+
+// shadowJob is a decision of the active policy waiting to be compared with the candidate
+type shadowJob struct {
+	req    model.EvaluationRequest
+	input  map[string]interface{}
+	active model.PolicyResponse
+}
+
+// ShadowDiff describes a divergence between the active and the candidate policy
+type ShadowDiff struct {
+	Timestamp             time.Time `json:"timestamp"`
+	UserID                string    `json:"user_id"`
+	ResourceType          string    `json:"resource_type"`
+	ResourceID            string    `json:"resource_id"`
+	Action                string    `json:"action"`
+	ActiveAllow           bool      `json:"active_allow"`
+	CandidateAllow        bool      `json:"candidate_allow"`
+	AllowFlip             bool      `json:"allow_flip"`
+	FieldsOnlyInActive    []string  `json:"fields_only_in_active,omitempty"`
+	FieldsOnlyInCandidate []string  `json:"fields_only_in_candidate,omitempty"`
+}
+
+// NewShadowEvaluator prepares the RBAC decision of the candidate policy set and writes
+// divergences to diffLog as JSON lines
+func NewShadowEvaluator(candidate *PolicySet, diffLog io.Writer) (*ShadowEvaluator, error) {
+	query, err := candidate.Prepare("data.policy.rbac.result")
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare candidate policy: %w", err)
+	}
+
+	return &ShadowEvaluator{
+		query:   query,
+		queue:   make(chan shadowJob, shadowQueueSize),
+		diffLog: diffLog,
+	}, nil
+}
+
+// Submit queues the decision for comparison off the request path. The decision is dropped
+// when the queue is full so that the candidate policy never delays or fails live decisions.
+func (s *ShadowEvaluator) Submit(req model.EvaluationRequest, input map[string]interface{}, active model.PolicyResponse) {
+	// The input's top level is extended after evaluation, e.g. with break-glass grants
+	job := shadowJob{req: req, input: maps.Clone(input), active: active}
+	job.active.AllowedFields = slices.Clone(active.AllowedFields)
+
+	select {
+	case s.queue <- job:
+	default:
+		s.dropped.Add(1)
+		log.Printf("[WARN] Shadow evaluation queue is full, dropping the decision for user %s", req.UserID)
+	}
+}
+
+// Run compares the queued decisions with the candidate policy until the context is canceled
+func (s *ShadowEvaluator) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.queue:
+			s.Compare(ctx, job.req, job.input, job.active)
+		}
+	}
+}
+
+// Compare evaluates the candidate policy with the same input as the active
+// policy and records a diff when the decisions diverge
+func (s *ShadowEvaluator) Compare(ctx context.Context, req model.EvaluationRequest, input map[string]interface{}, active model.PolicyResponse) {
+	s.evaluations.Add(1)
+
+	results, err := s.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		s.errors.Add(1)
+		log.Printf("[ERROR] Shadow policy evaluation error: %v", err)
+		return
+	}
+
+	candidate, err := parsePolicyResult(results)
+	if err != nil {
+		s.errors.Add(1)
+		log.Printf("[ERROR] Shadow policy result error: %v", err)
+		return
+	}
+
+	onlyActive, onlyCandidate := diffFields(active.AllowedFields, candidate.AllowedFields)
+	allowFlip := active.Allow != candidate.Allow
+	if !allowFlip && len(onlyActive) == 0 && len(onlyCandidate) == 0 {
+		return
+	}
+
+	s.divergences.Add(1)
+	if allowFlip {
+		s.allowFlips.Add(1)
+	}
+	if len(onlyActive) > 0 || len(onlyCandidate) > 0 {
+		s.fieldDiffs.Add(1)
+	}
+
+	diff := ShadowDiff{
+		Timestamp:             time.Now().UTC(),
+		UserID:                req.UserID,
+		ResourceType:          req.ResourceType,
+		ResourceID:            req.ResourceID,
+		Action:                req.Action,
+		ActiveAllow:           active.Allow,
+		CandidateAllow:        candidate.Allow,
+		AllowFlip:             allowFlip,
+		FieldsOnlyInActive:    onlyActive,
+		FieldsOnlyInCandidate: onlyCandidate,
+	}
+
+	log.Printf("[WARN] Shadow policy divergence: %+v", diff)
+
+	line, err := json.Marshal(diff)
+	if err != nil {
+		log.Printf("[ERROR] Failed to marshal shadow diff: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.diffLog.Write(append(line, '\n')); err != nil {
+		log.Printf("[ERROR] Failed to write shadow diff: %v", err)
+	}
+}
+
+// HandleMetrics writes the shadow evaluation counters in the Prometheus text format
+func (s *ShadowEvaluator) HandleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metrics := []struct {
+		name  string
+		help  string
+		value int64
+	}{
+		{"pdp_shadow_evaluations_total", "Number of requests evaluated against the candidate policy.", s.evaluations.Load()},
+		{"pdp_shadow_divergences_total", "Number of decisions where the candidate policy diverged from the active policy.", s.divergences.Load()},
+		{"pdp_shadow_allow_flips_total", "Number of decisions where the candidate policy flipped allow.", s.allowFlips.Load()},
+		{"pdp_shadow_field_diffs_total", "Number of decisions where the candidate policy allowed different fields.", s.fieldDiffs.Load()},
+		{"pdp_shadow_errors_total", "Number of candidate policy evaluation errors.", s.errors.Load()},
+		{"pdp_shadow_dropped_total", "Number of decisions not compared because the shadow queue was full.", s.dropped.Load()},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", m.name, m.help, m.name, m.name, m.value)
+	}
+}
+
+// diffFields returns the fields only present in active and only present in candidate
+func diffFields(active, candidate []string) ([]string, []string) {
+	inActive := make(map[string]bool, len(active))
+	for _, f := range active {
+		inActive[f] = true
+	}
+	inCandidate := make(map[string]bool, len(candidate))
+	for _, f := range candidate {
+		inCandidate[f] = true
+	}
+
+	var onlyActive, onlyCandidate []string
+	for f := range inActive {
+		if !inCandidate[f] {
+			onlyActive = append(onlyActive, f)
+		}
+	}
+	for f := range inCandidate {
+		if !inActive[f] {
+			onlyCandidate = append(onlyCandidate, f)
+		}
+	}
+	sort.Strings(onlyActive)
+	sort.Strings(onlyCandidate)
+
+	return onlyActive, onlyCandidate
+}
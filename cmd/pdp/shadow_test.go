@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// loadShadowCandidate loads a copy of the policies with rbac.rego rewritten by edit and the
+// additional files as the candidate policy set
+func loadShadowCandidate(t testing.TB, edit func(string) string, files map[string]string) *PolicySet {
+	t.Helper()
+	dir := copyPolicies(t)
+
+	rbacPath := filepath.Join(dir, "rbac.rego")
+	rbac, err := os.ReadFile(rbacPath)
+	if err != nil {
+		t.Fatalf("Failed to read policy: %v", err)
+	}
+	if err := os.WriteFile(rbacPath, []byte(edit(string(rbac))), 0o644); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	candidate, err := LoadPolicySet(dir)
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+	return candidate
+}
+
+func TestShadowEvaluator_Compare(t *testing.T) {
+	const (
+		managerRole  = "11111111-1111-1111-1111-111111111111"
+		employeeRole = "22222222-2222-2222-2222-222222222222"
+	)
+
+	unchanged := func(policy string) string { return policy }
+
+	// The candidate drops the email field for managers and revokes the employee role
+	dropEmailAndEmployees := func(policy string) string {
+		policy = strings.Replace(policy,
+			`some perm in input.field_permissions`, `some perm in input.field_permissions
+        perm.field != "email"`, 1)
+		return strings.Replace(policy,
+			`perm.role_id == role_id`, `perm.role_id == role_id
+        role_id != "22222222-2222-2222-2222-222222222222"`, 1)
+	}
+
+	tests := []struct {
+		name          string
+		edit          func(string) string
+		files         map[string]string
+		roleIDs       []string
+		wantDiff      bool
+		wantAllowFlip bool
+		wantOnlyInAct []string
+	}{
+		{
+			name:    "Identical_policy_records_nothing",
+			edit:    unchanged,
+			roleIDs: []string{managerRole},
+		},
+		{
+			name:          "Field_divergence",
+			edit:          dropEmailAndEmployees,
+			roleIDs:       []string{managerRole},
+			wantDiff:      true,
+			wantOnlyInAct: []string{"email"},
+		},
+		{
+			name:          "Allow_flip",
+			edit:          dropEmailAndEmployees,
+			roleIDs:       []string{employeeRole},
+			wantDiff:      true,
+			wantAllowFlip: true,
+			wantOnlyInAct: []string{"department_name", "employment_type", "id", "name"},
+		},
+		{
+			// The candidate revokes the employee role through a module of its own and its data.config
+			name: "Candidate_module_and_configuration",
+			edit: func(policy string) string {
+				return strings.Replace(policy, `    purpose_permitted(role_id)
+}`, `    purpose_permitted(role_id)
+    not role_id in data.policy.candidate.revoked_roles
+}`, 1)
+			},
+			files: map[string]string{
+				"candidate.rego": `package policy.candidate
+
+revoked_roles := {role_id | role_id := data.config.candidate.revoked_roles[_]}
+`,
+				"data.json": `{"config": {"candidate": {"revoked_roles": ["22222222-2222-2222-2222-222222222222"]}}}`,
+			},
+			roleIDs:       []string{employeeRole},
+			wantDiff:      true,
+			wantAllowFlip: true,
+			wantOnlyInAct: []string{"department_name", "employment_type", "id", "name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var diffLog bytes.Buffer
+			shadow, err := NewShadowEvaluator(loadShadowCandidate(t, tt.edit, tt.files), &diffLog)
+			if err != nil {
+				t.Fatalf("NewShadowEvaluator() error = %v", err)
+			}
+
+			handler := NewPDPHandler(&mocks.MockRepository{
+				GetFieldPermissionsFunc: getTestFieldPermissions,
+				GetResourceIDByTypeFunc: getTestResourceID,
+				GetUserRolesFunc: func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+					var permissions []model.RBACPermission
+					for _, roleID := range tt.roleIDs {
+						permissions = append(permissions, model.RBACPermission{
+							Role: roleID, ResourceID: "11111111-1111-1111-1111-111111111111", Action: "view",
+						})
+					}
+					return tt.roleIDs, permissions, nil
+				},
+			})
+			handler.SetShadowEvaluator(shadow)
+
+			got, err := handler.evaluateRBAC(context.Background(), model.EvaluationRequest{
+				UserID:       "user1",
+				ResourceType: "employees",
+				ResourceID:   "11111111-1111-1111-1111-111111111111",
+				Action:       "view",
+			})
+			if err != nil {
+				t.Fatalf("evaluateRBAC() error = %v", err)
+			}
+			if !got.Allow {
+				t.Errorf("evaluateRBAC() allow = false, want the active decision to be enforced")
+			}
+
+			// The decision is compared off the request path
+			if diffLog.Len() != 0 {
+				t.Errorf("evaluateRBAC() compared synchronously, diff %s", diffLog.String())
+			}
+			job := <-shadow.queue
+			shadow.Compare(context.Background(), job.req, job.input, job.active)
+
+			if !tt.wantDiff {
+				if diffLog.Len() != 0 {
+					t.Errorf("Compare() wrote diff %s, want none", diffLog.String())
+				}
+				return
+			}
+
+			var diff ShadowDiff
+			if err := json.Unmarshal(diffLog.Bytes(), &diff); err != nil {
+				t.Fatalf("Failed to decode diff log: %v", err)
+			}
+			if diff.AllowFlip != tt.wantAllowFlip {
+				t.Errorf("Compare() allow flip = %v, want %v", diff.AllowFlip, tt.wantAllowFlip)
+			}
+			if strings.Join(diff.FieldsOnlyInActive, ",") != strings.Join(tt.wantOnlyInAct, ",") {
+				t.Errorf("Compare() fields only in active = %v, want %v", diff.FieldsOnlyInActive, tt.wantOnlyInAct)
+			}
+			if got := shadow.divergences.Load(); got != 1 {
+				t.Errorf("Compare() divergences = %v, want 1", got)
+			}
+		})
+	}
+}
+
+func TestShadowEvaluator_Submit(t *testing.T) {
+	policies, err := LoadPolicySet("policy")
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+	var diffLog bytes.Buffer
+	shadow, err := NewShadowEvaluator(policies, &diffLog)
+	if err != nil {
+		t.Fatalf("NewShadowEvaluator() error = %v", err)
+	}
+
+	req := model.EvaluationRequest{UserID: "user1", ResourceType: "employees", Action: "view"}
+	input := map[string]interface{}{"user_id": "user1", "roles": []string{}}
+	for i := 0; i < shadowQueueSize+1; i++ {
+		shadow.Submit(req, input, model.PolicyResponse{Allow: true})
+	}
+	if got := shadow.dropped.Load(); got != 1 {
+		t.Errorf("Submit() dropped = %d, want 1 beyond the queue size", got)
+	}
+
+	// The queued input is a copy the request may keep extending
+	input["break_glass_grants"] = []interface{}{}
+	if job := <-shadow.queue; job.input["break_glass_grants"] != nil {
+		t.Error("Submit() queued the request's input instead of a copy")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go shadow.Run(ctx)
+	for deadline := time.Now().Add(5 * time.Second); shadow.evaluations.Load() < shadowQueueSize-1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Run() compared %d decisions, want %d", shadow.evaluations.Load(), shadowQueueSize-1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShadowEvaluator_HandleMetrics(t *testing.T) {
+	policies, err := LoadPolicySet("policy")
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+
+	shadow, err := NewShadowEvaluator(policies, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("NewShadowEvaluator() error = %v", err)
+	}
+	shadow.evaluations.Add(3)
+	shadow.allowFlips.Add(1)
+
+	rec := httptest.NewRecorder()
+	shadow.HandleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{"pdp_shadow_evaluations_total 3", "pdp_shadow_allow_flips_total 1", "pdp_shadow_errors_total 0"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("HandleMetrics() body missing %q", want)
+		}
+	}
+}
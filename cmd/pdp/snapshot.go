@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// defaultSnapshotMaxStaleness is how long the PRP snapshot is used without confirming
+// that the listener still receives the changes
+const defaultSnapshotMaxStaleness = 30 * time.Second
+
+// snapshotRetryInterval is how long to wait before listening again after the listener failed
+const snapshotRetryInterval = 5 * time.Second
+
+// PRPChangeListener delivers the row changes of the PRP tables
+type PRPChangeListener interface {
+	// Listen starts listening, reconnecting if needed. Changes before it are not delivered.
+	Listen(ctx context.Context) error
+	// WaitForChange returns the next change, or the context's error if the context is done first
+	WaitForChange(ctx context.Context) (*model.PRPChange, error)
+	// Ping checks that changes are still being delivered
+	Ping(ctx context.Context) error
+}
+
+// SnapshotStatus describes the PRP snapshot
+type SnapshotStatus struct {
+	Version   uint64     `json:"version"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	SyncedAt  *time.Time `json:"synced_at,omitempty"`
+	Fresh     bool       `json:"fresh"`
+}
+
+// PRPSnapshot keeps the PRP tables decisions are evaluated from in memory. The tables are
+// loaded whenever the listener starts listening and updated with every change it delivers.
+// Decisions read the PRP directly while the snapshot is stale.
+type PRPSnapshot struct {
+	repo         interfaces.Repository
+	listener     PRPChangeListener
+	maxStaleness time.Duration
+	current      atomic.Pointer[prpSnapshot]
+	// syncedAt is when the snapshot was last known to be in sync, in Unix nanoseconds.
+	// It is zero while the listener is not listening.
+	syncedAt atomic.Int64
+}
+
+// NewPRPSnapshot creates a PRPSnapshot loading the tables from repo and updated by listener
+func NewPRPSnapshot(repo interfaces.Repository, listener PRPChangeListener, maxStaleness time.Duration) *PRPSnapshot {
+	return &PRPSnapshot{repo: repo, listener: listener, maxStaleness: maxStaleness}
+}
+
+// SetPRPSnapshot enables evaluating decisions from an in-memory snapshot of the PRP
+func (h *PDPHandler) SetPRPSnapshot(snapshot *PRPSnapshot) {
+	h.snapshot = snapshot
+}
+
+// snapshotMaxStalenessFromEnv returns PDP_PRP_SNAPSHOT_MAX_STALENESS or the default
+func snapshotMaxStalenessFromEnv() (time.Duration, error) {
+	value := os.Getenv("PDP_PRP_SNAPSHOT_MAX_STALENESS")
+	if value == "" {
+		return defaultSnapshotMaxStaleness, nil
+	}
+	maxStaleness, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PDP_PRP_SNAPSHOT_MAX_STALENESS: %w", err)
+	}
+	if maxStaleness <= 0 {
+		return 0, fmt.Errorf("invalid PDP_PRP_SNAPSHOT_MAX_STALENESS: must be positive")
+	}
+	return maxStaleness, nil
+}
+
+// Run keeps the snapshot in sync until the context is canceled
+func (s *PRPSnapshot) Run(ctx context.Context) {
+	for {
+		err := s.sync(ctx)
+		s.syncedAt.Store(0)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[WARN] PRP snapshot is out of sync, reading the PRP directly: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(snapshotRetryInterval):
+		}
+	}
+}
+
+// sync starts listening, reloads the tables and applies the changes until the listener fails.
+// Listening before reloading ensures that no change is missed; changes already loaded are
+// applied again, which leaves the rows as they are.
+func (s *PRPSnapshot) sync(ctx context.Context) error {
+	if err := s.listener.Listen(ctx); err != nil {
+		return err
+	}
+	if err := s.Reload(ctx); err != nil {
+		return err
+	}
+	s.markSynced()
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, s.maxStaleness/2)
+		change, err := s.listener.WaitForChange(waitCtx)
+		cancel()
+
+		switch {
+		case err == nil:
+			if err := s.Apply(change); err != nil {
+				return err
+			}
+		case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+			// No change for a while, make sure none are being missed
+			if err := s.listener.Ping(ctx); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+		s.markSynced()
+	}
+}
+
+// Reload loads the tables from the PRP on a pooled connection of the repository, apart from
+// the listener's connection and the connections decisions query the PRP on
+func (s *PRPSnapshot) Reload(ctx context.Context) error {
+	tables, err := s.repo.LoadPRPTables(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load PRP tables: %w", err)
+	}
+
+	var version uint64
+	if current := s.current.Load(); current != nil {
+		version = current.version
+	}
+	snapshot := newPRPSnapshot(tables, version+1)
+	s.current.Store(snapshot)
+
+	log.Printf("[INFO] Loaded PRP snapshot version %d: %d user roles, %d role permissions, %d field permissions",
+		snapshot.version, len(snapshot.userRoles), len(snapshot.rolePermissions), len(snapshot.fieldPermissions))
+	return nil
+}
+
+// Apply applies a change to the snapshot
+func (s *PRPSnapshot) Apply(change *model.PRPChange) error {
+	current := s.current.Load()
+	if current == nil {
+		return fmt.Errorf("PRP snapshot is not loaded")
+	}
+
+	next, err := current.apply(change)
+	if err != nil {
+		return fmt.Errorf("failed to apply %s on %s: %w", change.Op, change.Table, err)
+	}
+	s.current.Store(next)
+
+	log.Printf("[DEBUG] Applied %s on %s to PRP snapshot, version %d", change.Op, change.Table, next.version)
+	return nil
+}
+
+// markSynced records that the snapshot is in sync
+func (s *PRPSnapshot) markSynced() {
+	s.syncedAt.Store(time.Now().UnixNano())
+}
+
+// fresh returns the snapshot if it is known to have been in sync within the maximum staleness
+func (s *PRPSnapshot) fresh() *prpSnapshot {
+	if s == nil {
+		return nil
+	}
+	syncedAt := s.syncedAt.Load()
+	if syncedAt == 0 || time.Since(time.Unix(0, syncedAt)) > s.maxStaleness {
+		return nil
+	}
+	return s.current.Load()
+}
+
+// Status describes the snapshot
+func (s *PRPSnapshot) Status() SnapshotStatus {
+	status := SnapshotStatus{Fresh: s.fresh() != nil}
+	if current := s.current.Load(); current != nil {
+		status.Version = current.version
+		status.UpdatedAt = &current.updatedAt
+	}
+	if syncedAt := s.syncedAt.Load(); syncedAt != 0 {
+		t := time.Unix(0, syncedAt)
+		status.SyncedAt = &t
+	}
+	return status
+}
+
+// snapshotContext makes an evaluation read from the PRP snapshot if it is fresh and
+// returns the snapshot's version, or zero when the evaluation reads the PRP directly
+func (h *PDPHandler) snapshotContext(ctx context.Context) (context.Context, uint64) {
+	snapshot := h.snapshot.fresh()
+	if snapshot == nil {
+		if h.snapshot != nil {
+			log.Printf("[DEBUG] PRP snapshot is stale, reading the PRP directly")
+		}
+		return ctx, 0
+	}
+	repo := &snapshotRepository{Repository: h.repository(ctx), snapshot: snapshot}
+	return context.WithValue(ctx, repositoryKey{}, repo), snapshot.version
+}
+
+// prpSnapshot is an immutable copy of the PRP tables keyed by their primary keys.
+// A change copies the changed table only.
+type prpSnapshot struct {
+	version          uint64
+	updatedAt        time.Time
+	resources        map[string]model.ResourceRow
+	actions          map[string]model.ActionRow
+	roles            map[string]model.RoleRow
+	userRoles        map[string]model.UserRoleRow
+	rolePermissions  map[string]model.RolePermissionRow
+	roleParents      map[model.RoleParentRow]model.RoleParentRow
+	fieldPermissions map[string]model.FieldPermissionRow
+	purposes         map[string]model.PurposeRow
+	rolePurposes     map[string]model.RolePurposeRow
+	purposeFields    map[string]model.PurposeFieldRow
+}
+
+func resourceKey(r model.ResourceRow) string                   { return r.ID }
+func actionKey(a model.ActionRow) string                       { return a.ID }
+func roleKey(r model.RoleRow) string                           { return r.ID }
+func userRoleKey(ur model.UserRoleRow) string                  { return ur.ID }
+func rolePermissionKey(rp model.RolePermissionRow) string      { return rp.ID }
+func roleParentKey(rp model.RoleParentRow) model.RoleParentRow { return rp }
+func fieldPermissionKey(fp model.FieldPermissionRow) string    { return fp.ID }
+func purposeKey(p model.PurposeRow) string                     { return p.ID }
+func rolePurposeKey(rp model.RolePurposeRow) string            { return rp.ID }
+func purposeFieldKey(pf model.PurposeFieldRow) string          { return pf.ID }
+
+// newPRPSnapshot indexes the tables
+func newPRPSnapshot(tables *model.PRPTables, version uint64) *prpSnapshot {
+	return &prpSnapshot{
+		version:          version,
+		updatedAt:        time.Now(),
+		resources:        indexRows(tables.Resources, resourceKey),
+		actions:          indexRows(tables.Actions, actionKey),
+		roles:            indexRows(tables.Roles, roleKey),
+		userRoles:        indexRows(tables.UserRoles, userRoleKey),
+		rolePermissions:  indexRows(tables.RolePermissions, rolePermissionKey),
+		roleParents:      indexRows(tables.RoleParents, roleParentKey),
+		fieldPermissions: indexRows(tables.FieldPermissions, fieldPermissionKey),
+		purposes:         indexRows(tables.Purposes, purposeKey),
+		rolePurposes:     indexRows(tables.RolePurposes, rolePurposeKey),
+		purposeFields:    indexRows(tables.PurposeFields, purposeFieldKey),
+	}
+}
+
+// indexRows keys the rows of a table by their primary key
+func indexRows[K comparable, R any](rows []R, key func(R) K) map[K]R {
+	table := make(map[K]R, len(rows))
+	for _, row := range rows {
+		table[key(row)] = row
+	}
+	return table
+}
+
+// apply returns the snapshot with the change applied. Changes to other tables are ignored.
+func (s *prpSnapshot) apply(change *model.PRPChange) (*prpSnapshot, error) {
+	next := *s
+	var err error
+	switch change.Table {
+	case "resources":
+		next.resources, err = applyChange(s.resources, change, resourceKey)
+	case "actions":
+		next.actions, err = applyChange(s.actions, change, actionKey)
+	case "roles":
+		next.roles, err = applyChange(s.roles, change, roleKey)
+	case "user_roles":
+		next.userRoles, err = applyChange(s.userRoles, change, userRoleKey)
+	case "role_permissions":
+		next.rolePermissions, err = applyChange(s.rolePermissions, change, rolePermissionKey)
+	case "role_parents":
+		next.roleParents, err = applyChange(s.roleParents, change, roleParentKey)
+	case "field_permissions":
+		next.fieldPermissions, err = applyChange(s.fieldPermissions, change, fieldPermissionKey)
+	case "purposes":
+		next.purposes, err = applyChange(s.purposes, change, purposeKey)
+	case "role_purposes":
+		next.rolePurposes, err = applyChange(s.rolePurposes, change, rolePurposeKey)
+	case "purpose_fields":
+		next.purposeFields, err = applyChange(s.purposeFields, change, purposeFieldKey)
+	default:
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	next.version++
+	next.updatedAt = time.Now()
+	return &next, nil
+}
+
+// applyChange returns a copy of the table with the old row removed and the new row stored
+func applyChange[K comparable, R any](table map[K]R, change *model.PRPChange, key func(R) K) (map[K]R, error) {
+	if change.Op == "TRUNCATE" {
+		return make(map[K]R), nil
+	}
+
+	next := maps.Clone(table)
+	if hasRow(change.Old) {
+		var old R
+		if err := json.Unmarshal(change.Old, &old); err != nil {
+			return nil, fmt.Errorf("invalid old row: %w", err)
+		}
+		delete(next, key(old))
+	}
+	if hasRow(change.New) {
+		var row R
+		if err := json.Unmarshal(change.New, &row); err != nil {
+			return nil, fmt.Errorf("invalid new row: %w", err)
+		}
+		next[key(row)] = row
+	}
+	return next, nil
+}
+
+// hasRow reports whether a change carries a row
+func hasRow(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
+
+// effectiveRoles returns the roles of the user and every role they inherit from
+func (s *prpSnapshot) effectiveRoles(userID string) map[string]bool {
+	var assigned []string
+	for _, ur := range s.userRoles {
+		if ur.UserID == userID {
+			assigned = append(assigned, ur.RoleID)
+		}
+	}
+	return s.inheritedRoles(assigned)
+}
+
+// inheritedRoles returns the assigned roles and every role they inherit from
+func (s *prpSnapshot) inheritedRoles(assigned []string) map[string]bool {
+	effective := make(map[string]bool)
+	var pending []string
+	for _, role := range assigned {
+		if !effective[role] {
+			effective[role] = true
+			pending = append(pending, role)
+		}
+	}
+	for len(pending) > 0 {
+		role := pending[0]
+		pending = pending[1:]
+		for rp := range s.roleParents {
+			if rp.RoleID == role && !effective[rp.ParentRoleID] {
+				effective[rp.ParentRoleID] = true
+				pending = append(pending, rp.ParentRoleID)
+			}
+		}
+	}
+	return effective
+}
+
+// snapshotRepository answers the lookups of decisions from a PRP snapshot the same way
+// the repository's queries do, and passes everything else to the repository it wraps
+type snapshotRepository struct {
+	interfaces.Repository
+	snapshot *prpSnapshot
+}
+
+func (r *snapshotRepository) GetUserRoles(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+	s := r.snapshot
+
+	var roles []string
+	for _, ur := range s.userRoles {
+		if _, ok := s.roles[ur.RoleID]; ok && ur.UserID == userID {
+			roles = append(roles, ur.RoleID)
+		}
+	}
+	sort.Strings(roles)
+
+	return roles, s.permissionsOf(s.effectiveRoles(userID)), nil
+}
+
+func (r *snapshotRepository) GetPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.RBACPermission, error) {
+	return r.snapshot.permissionsOf(r.snapshot.inheritedRoles(roleIDs)), nil
+}
+
+// permissionsOf returns the permissions of the effective roles
+func (s *prpSnapshot) permissionsOf(effective map[string]bool) []model.RBACPermission {
+	var permissions []model.RBACPermission
+	for _, rp := range s.rolePermissions {
+		_, roleOK := s.roles[rp.RoleID]
+		_, resourceOK := s.resources[rp.ResourceID]
+		action, actionOK := s.actions[rp.ActionID]
+		if effective[rp.RoleID] && roleOK && resourceOK && actionOK {
+			permissions = append(permissions, model.RBACPermission{Role: rp.RoleID, ResourceID: rp.ResourceID, Action: action.Name})
+		}
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		a, b := permissions[i], permissions[j]
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		if a.ResourceID != b.ResourceID {
+			return a.ResourceID < b.ResourceID
+		}
+		return a.Action < b.Action
+	})
+	return permissions
+}
+
+func (r *snapshotRepository) GetFieldPermissions(ctx context.Context, userID string) ([]model.FieldPermission, error) {
+	return r.snapshot.fieldPermissionsOf(r.snapshot.effectiveRoles(userID)), nil
+}
+
+func (r *snapshotRepository) GetFieldPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.FieldPermission, error) {
+	return r.snapshot.fieldPermissionsOf(r.snapshot.inheritedRoles(roleIDs)), nil
+}
+
+// fieldPermissionsOf returns the field permissions of the effective roles
+func (s *prpSnapshot) fieldPermissionsOf(effective map[string]bool) []model.FieldPermission {
+	var rows []model.FieldPermissionRow
+	for _, fp := range s.fieldPermissions {
+		if _, ok := s.actions[fp.ActionID]; ok && effective[fp.RoleID] {
+			rows = append(rows, fp)
+		}
+	}
+	// Ordered like the repository: by role, resource, action and position
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.RoleID != b.RoleID {
+			return a.RoleID < b.RoleID
+		}
+		if a.ResourceID != b.ResourceID {
+			return a.ResourceID < b.ResourceID
+		}
+		if actionA, actionB := s.actions[a.ActionID].Name, s.actions[b.ActionID].Name; actionA != actionB {
+			return actionA < actionB
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.Field < b.Field
+	})
+
+	permissions := make([]model.FieldPermission, 0, len(rows))
+	for _, fp := range rows {
+		permissions = append(permissions, model.FieldPermission{
+			Role:       fp.RoleID,
+			ResourceID: fp.ResourceID,
+			Action:     s.actions[fp.ActionID].Name,
+			Field:      fp.Field,
+		})
+	}
+	return permissions
+}
+
+func (r *snapshotRepository) GetRoleParents(ctx context.Context, userID string) ([]model.RoleParent, error) {
+	return r.snapshot.roleParentsOf(r.snapshot.effectiveRoles(userID)), nil
+}
+
+func (r *snapshotRepository) GetRoleParentsForRoles(ctx context.Context, roleIDs []string) ([]model.RoleParent, error) {
+	return r.snapshot.roleParentsOf(r.snapshot.inheritedRoles(roleIDs)), nil
+}
+
+// roleParentsOf returns the parent roles of the effective roles
+func (s *prpSnapshot) roleParentsOf(effective map[string]bool) []model.RoleParent {
+	var parents []model.RoleParent
+	for rp := range s.roleParents {
+		if effective[rp.RoleID] {
+			parents = append(parents, model.RoleParent{Role: rp.RoleID, ParentRole: rp.ParentRoleID})
+		}
+	}
+	sort.Slice(parents, func(i, j int) bool {
+		if parents[i].Role != parents[j].Role {
+			return parents[i].Role < parents[j].Role
+		}
+		return parents[i].ParentRole < parents[j].ParentRole
+	})
+	return parents
+}
+
+func (r *snapshotRepository) GetRolePurposes(ctx context.Context, userID string) ([]model.RolePurpose, error) {
+	return r.snapshot.rolePurposesOf(r.snapshot.effectiveRoles(userID)), nil
+}
+
+func (r *snapshotRepository) GetRolePurposesForRoles(ctx context.Context, roleIDs []string) ([]model.RolePurpose, error) {
+	return r.snapshot.rolePurposesOf(r.snapshot.inheritedRoles(roleIDs)), nil
+}
+
+// rolePurposesOf returns the purposes the effective roles are bound to
+func (s *prpSnapshot) rolePurposesOf(effective map[string]bool) []model.RolePurpose {
+	var purposes []model.RolePurpose
+	for _, rp := range s.rolePurposes {
+		if purpose, ok := s.purposes[rp.PurposeID]; ok && effective[rp.RoleID] {
+			purposes = append(purposes, model.RolePurpose{Role: rp.RoleID, ResourceID: rp.ResourceID, Purpose: purpose.Name})
+		}
+	}
+	sort.Slice(purposes, func(i, j int) bool {
+		a, b := purposes[i], purposes[j]
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		if a.ResourceID != b.ResourceID {
+			return a.ResourceID < b.ResourceID
+		}
+		return a.Purpose < b.Purpose
+	})
+	return purposes
+}
+
+func (r *snapshotRepository) GetPurposeFields(ctx context.Context) ([]model.PurposeField, error) {
+	s := r.snapshot
+
+	var rows []model.PurposeFieldRow
+	for _, pf := range s.purposeFields {
+		if _, ok := s.purposes[pf.PurposeID]; ok {
+			rows = append(rows, pf)
+		}
+	}
+	// Ordered like the repository: by purpose, resource and position
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if purposeA, purposeB := s.purposes[a.PurposeID].Name, s.purposes[b.PurposeID].Name; purposeA != purposeB {
+			return purposeA < purposeB
+		}
+		if a.ResourceID != b.ResourceID {
+			return a.ResourceID < b.ResourceID
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.Field < b.Field
+	})
+
+	fields := make([]model.PurposeField, 0, len(rows))
+	for _, pf := range rows {
+		fields = append(fields, model.PurposeField{
+			Purpose:    s.purposes[pf.PurposeID].Name,
+			ResourceID: pf.ResourceID,
+			Field:      pf.Field,
+		})
+	}
+	return fields, nil
+}
+
+// GetResourceIDByType looks resource types up in the tenant the repository reads them from
+func (r *snapshotRepository) GetResourceIDByType(ctx context.Context, resourceType string) (string, error) {
+	resourceID := ""
+	for _, resource := range r.snapshot.resources {
+		if resource.TenantID == defaultTenantID && resource.Name == resourceType &&
+			(resourceID == "" || resource.ID < resourceID) {
+			resourceID = resource.ID
+		}
+	}
+	if resourceID == "" {
+		return "", fmt.Errorf("resource type '%s': %w", resourceType, interfaces.ErrNotFound)
+	}
+	return resourceID, nil
+}
+
+func (r *snapshotRepository) GetResources(ctx context.Context) ([]model.Resource, error) {
+	var resources []model.Resource
+	for _, resource := range r.snapshot.resources {
+		if resource.TenantID == defaultTenantID {
+			resources = append(resources, model.Resource{ID: resource.ID, Name: resource.Name})
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Name != resources[j].Name {
+			return resources[i].Name < resources[j].Name
+		}
+		return resources[i].ID < resources[j].ID
+	})
+	return resources, nil
+}
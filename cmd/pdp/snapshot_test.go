@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+const (
+	testSupportUser = "33333333-3333-3333-3333-333333333333"
+	testSupportRole = "33333333-3333-3333-3333-333333333333"
+	testViewAction  = "11111111-1111-1111-1111-111111111111"
+)
+
+// getTestPRPTables returns the PRP tables of newBreakGlassMockRepo, with a support role
+// inheriting from the employee role
+func getTestPRPTables(ctx context.Context) (*model.PRPTables, error) {
+	tables := &model.PRPTables{
+		Resources: []model.ResourceRow{
+			{ID: testEmployeesRes, TenantID: defaultTenantID, Name: "employees"},
+			{ID: testAdminRes, TenantID: defaultTenantID, Name: "admin"},
+		},
+		Actions: []model.ActionRow{
+			{ID: testViewAction, Name: "view"},
+			{ID: "44444444-4444-4444-4444-444444444444", Name: "break_glass"},
+			{ID: "55555555-5555-5555-5555-555555555555", Name: "manage"},
+		},
+		Roles: []model.RoleRow{
+			{ID: testManagerRole, TenantID: defaultTenantID, Name: "manager"},
+			{ID: testEmployeeRole, TenantID: defaultTenantID, Name: "employee"},
+			{ID: testSupportRole, TenantID: defaultTenantID, Name: "support"},
+			{ID: testAdminRole, TenantID: defaultTenantID, Name: "admin"},
+		},
+		UserRoles: []model.UserRoleRow{
+			{ID: "ur-manager", UserID: testManagerUser, RoleID: testManagerRole},
+			{ID: "ur-employee", UserID: testEmployeeUser, RoleID: testEmployeeRole},
+			{ID: "ur-support", UserID: testSupportUser, RoleID: testSupportRole},
+			{ID: "ur-admin", UserID: testAdminUser, RoleID: testAdminRole},
+		},
+		RolePermissions: []model.RolePermissionRow{
+			{ID: "rp-manager-view", RoleID: testManagerRole, ResourceID: testEmployeesRes, ActionID: testViewAction},
+			{ID: "rp-manager-break-glass", RoleID: testManagerRole, ResourceID: testEmployeesRes, ActionID: "44444444-4444-4444-4444-444444444444"},
+			{ID: "rp-employee-view", RoleID: testEmployeeRole, ResourceID: testEmployeesRes, ActionID: testViewAction},
+			{ID: "rp-admin-manage", RoleID: testAdminRole, ResourceID: testAdminRes, ActionID: "55555555-5555-5555-5555-555555555555"},
+		},
+		RoleParents: []model.RoleParentRow{
+			{RoleID: testSupportRole, ParentRoleID: testEmployeeRole},
+		},
+		Purposes: []model.PurposeRow{
+			{ID: "purpose-payroll", Name: "payroll"},
+			{ID: "purpose-support", Name: "support"},
+		},
+		PurposeFields: []model.PurposeFieldRow{
+			{ID: "pf-support-name", PurposeID: "purpose-support", ResourceID: testEmployeesRes, Field: "name", Position: 2},
+			{ID: "pf-support-id", PurposeID: "purpose-support", ResourceID: testEmployeesRes, Field: "id", Position: 1},
+			{ID: "pf-payroll-email", PurposeID: "purpose-payroll", ResourceID: testEmployeesRes, Field: "email", Position: 1},
+			{ID: "pf-unknown", PurposeID: "purpose-unknown", ResourceID: testEmployeesRes, Field: "position", Position: 1},
+		},
+	}
+
+	fields, _ := getTestFieldPermissions(ctx, "")
+	for i, fp := range fields {
+		tables.FieldPermissions = append(tables.FieldPermissions, model.FieldPermissionRow{
+			ID:         fp.Role + "-" + fp.Field,
+			RoleID:     fp.Role,
+			ResourceID: fp.ResourceID,
+			ActionID:   testViewAction,
+			Field:      fp.Field,
+			Position:   i,
+		})
+	}
+	return tables, nil
+}
+
+// newTestSnapshotRepository returns a snapshotRepository over getTestPRPTables
+func newTestSnapshotRepository(t *testing.T) *snapshotRepository {
+	t.Helper()
+	tables, err := getTestPRPTables(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &snapshotRepository{snapshot: newPRPSnapshot(tables, 1)}
+}
+
+func TestSnapshotRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSnapshotRepository(t)
+
+	roles, permissions, err := repo.GetUserRoles(ctx, testManagerUser)
+	if err != nil {
+		t.Fatalf("GetUserRoles() error = %v", err)
+	}
+	if !reflect.DeepEqual(roles, []string{testManagerRole}) {
+		t.Errorf("GetUserRoles() roles = %v, want the manager role", roles)
+	}
+	wantPermissions := []model.RBACPermission{
+		{Role: testManagerRole, ResourceID: testEmployeesRes, Action: "break_glass"},
+		{Role: testManagerRole, ResourceID: testEmployeesRes, Action: "view"},
+	}
+	if !reflect.DeepEqual(permissions, wantPermissions) {
+		t.Errorf("GetUserRoles() permissions = %v, want %v", permissions, wantPermissions)
+	}
+
+	// Permissions and fields are inherited from parent roles
+	roles, permissions, _ = repo.GetUserRoles(ctx, testSupportUser)
+	wantPermissions = []model.RBACPermission{{Role: testEmployeeRole, ResourceID: testEmployeesRes, Action: "view"}}
+	if !reflect.DeepEqual(roles, []string{testSupportRole}) || !reflect.DeepEqual(permissions, wantPermissions) {
+		t.Errorf("GetUserRoles() = %v, %v, want the support role with the employee's permissions", roles, permissions)
+	}
+	parents, _ := repo.GetRoleParents(ctx, testSupportUser)
+	if want := []model.RoleParent{{Role: testSupportRole, ParentRole: testEmployeeRole}}; !reflect.DeepEqual(parents, want) {
+		t.Errorf("GetRoleParents() = %v, want %v", parents, want)
+	}
+
+	fields, err := repo.GetFieldPermissions(ctx, testSupportUser)
+	if err != nil {
+		t.Fatalf("GetFieldPermissions() error = %v", err)
+	}
+	var names []string
+	for _, fp := range fields {
+		names = append(names, fp.Field)
+	}
+	if want := []string{"id", "name", "department_name", "employment_type"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("GetFieldPermissions() fields = %v, want %v in position order", names, want)
+	}
+
+	// Roles assigned outside the PRP, e.g. by the PIP, are resolved the same way
+	permissions, _ = repo.GetPermissionsForRoles(ctx, []string{testSupportRole})
+	if !reflect.DeepEqual(permissions, wantPermissions) {
+		t.Errorf("GetPermissionsForRoles() = %v, want the employee's permissions", permissions)
+	}
+	parents, _ = repo.GetRoleParentsForRoles(ctx, []string{testSupportRole})
+	if want := []model.RoleParent{{Role: testSupportRole, ParentRole: testEmployeeRole}}; !reflect.DeepEqual(parents, want) {
+		t.Errorf("GetRoleParentsForRoles() = %v, want %v", parents, want)
+	}
+	fields, _ = repo.GetFieldPermissionsForRoles(ctx, []string{testSupportRole})
+	if len(fields) != len(names) {
+		t.Errorf("GetFieldPermissionsForRoles() = %v, want the employee's %d fields", fields, len(names))
+	}
+
+	purposeFields, err := repo.GetPurposeFields(ctx)
+	if err != nil {
+		t.Fatalf("GetPurposeFields() error = %v", err)
+	}
+	wantPurposeFields := []model.PurposeField{
+		{Purpose: "payroll", ResourceID: testEmployeesRes, Field: "email"},
+		{Purpose: "support", ResourceID: testEmployeesRes, Field: "id"},
+		{Purpose: "support", ResourceID: testEmployeesRes, Field: "name"},
+	}
+	if !reflect.DeepEqual(purposeFields, wantPurposeFields) {
+		t.Errorf("GetPurposeFields() = %v, want %v by purpose and position", purposeFields, wantPurposeFields)
+	}
+
+	if id, err := repo.GetResourceIDByType(ctx, "employees"); err != nil || id != testEmployeesRes {
+		t.Errorf("GetResourceIDByType(employees) = %q, %v, want %q", id, err, testEmployeesRes)
+	}
+	if _, err := repo.GetResourceIDByType(ctx, "payroll"); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("GetResourceIDByType(payroll) error = %v, want ErrNotFound", err)
+	}
+
+	resources, _ := repo.GetResources(ctx)
+	if len(resources) != 2 || resources[0].Name != "admin" || resources[1].Name != "employees" {
+		t.Errorf("GetResources() = %v, want admin and employees by name", resources)
+	}
+}
+
+// rowChange returns a change notification of a row
+func rowChange(t *testing.T, table, op string, old, new interface{}) *model.PRPChange {
+	t.Helper()
+	change := &model.PRPChange{Table: table, Op: op}
+	if old != nil {
+		change.Old, _ = json.Marshal(old)
+	}
+	if new != nil {
+		change.New, _ = json.Marshal(new)
+	}
+	return change
+}
+
+func TestPRPSnapshot_Apply(t *testing.T) {
+	ctx := context.Background()
+	snapshot := NewPRPSnapshot(&mocks.MockRepository{LoadPRPTablesFunc: getTestPRPTables}, nil, time.Minute)
+	if err := snapshot.Apply(rowChange(t, "user_roles", "INSERT", nil, model.UserRoleRow{ID: "x"})); err == nil {
+		t.Fatalf("Apply() before loading error = nil, want error")
+	}
+	if err := snapshot.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	promotion := model.UserRoleRow{ID: "ur-promotion", UserID: testEmployeeUser, RoleID: testManagerRole}
+	tests := []struct {
+		name        string
+		change      *model.PRPChange
+		wantVersion uint64
+		wantRoles   []string
+		wantErr     bool
+	}{
+		{
+			name:        "Insert",
+			change:      rowChange(t, "user_roles", "INSERT", nil, promotion),
+			wantVersion: 2,
+			wantRoles:   []string{testManagerRole, testEmployeeRole},
+		},
+		{
+			name:        "Insert_again",
+			change:      rowChange(t, "user_roles", "INSERT", nil, promotion),
+			wantVersion: 3,
+			wantRoles:   []string{testManagerRole, testEmployeeRole},
+		},
+		{
+			name: "Update",
+			change: rowChange(t, "user_roles", "UPDATE", promotion,
+				model.UserRoleRow{ID: promotion.ID, UserID: testEmployeeUser, RoleID: testSupportRole}),
+			wantVersion: 4,
+			wantRoles:   []string{testEmployeeRole, testSupportRole},
+		},
+		{
+			name:        "Delete",
+			change:      rowChange(t, "user_roles", "DELETE", model.UserRoleRow{ID: promotion.ID}, nil),
+			wantVersion: 5,
+			wantRoles:   []string{testEmployeeRole},
+		},
+		{
+			name:        "Other_table",
+			change:      rowChange(t, "break_glass_grants", "INSERT", nil, map[string]string{"id": "g"}),
+			wantVersion: 5,
+			wantRoles:   []string{testEmployeeRole},
+		},
+		{
+			name:    "Invalid_row",
+			change:  &model.PRPChange{Table: "user_roles", Op: "INSERT", New: json.RawMessage(`"row"`)},
+			wantErr: true,
+		},
+		{
+			name:        "Truncate",
+			change:      rowChange(t, "user_roles", "TRUNCATE", nil, nil),
+			wantVersion: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := snapshot.Apply(tt.change)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			current := snapshot.current.Load()
+			if current.version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", current.version, tt.wantVersion)
+			}
+			roles, _, _ := (&snapshotRepository{snapshot: current}).GetUserRoles(ctx, testEmployeeUser)
+			if !reflect.DeepEqual(roles, tt.wantRoles) {
+				t.Errorf("roles = %v, want %v", roles, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestPDPHandler_evaluate_snapshot(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := newBreakGlassMockRepo()
+	mockRepo.LoadPRPTablesFunc = getTestPRPTables
+	// Direct queries fail, so decisions only succeed when read from the snapshot
+	mockRepo.GetUserRolesFunc = func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
+		return nil, nil, errors.New("connection refused")
+	}
+
+	handler := NewPDPHandler(mockRepo)
+	snapshot := NewPRPSnapshot(mockRepo, nil, time.Minute)
+	handler.SetPRPSnapshot(snapshot)
+	if err := snapshot.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	req := model.EvaluationRequest{UserID: testSupportUser, ResourceType: "employees", Action: "view"}
+
+	// Not in sync yet
+	if _, err := handler.evaluate(ctx, req); err == nil {
+		t.Errorf("evaluate() with a stale snapshot error = nil, want the repository's error")
+	}
+
+	snapshot.markSynced()
+	response, err := handler.evaluate(ctx, req)
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if !response.Allow || len(response.AllowedFields) != 4 {
+		t.Errorf("evaluate() = %+v, want the inherited view access", response)
+	}
+	if response.SnapshotVersion != 1 {
+		t.Errorf("snapshot version = %d, want 1", response.SnapshotVersion)
+	}
+
+	// Too long since the snapshot was known to be in sync
+	snapshot.syncedAt.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if _, err := handler.evaluate(ctx, req); err == nil {
+		t.Errorf("evaluate() with an outdated snapshot error = nil, want the repository's error")
+	}
+}
+
+// fakeChangeListener delivers the changes sent on its channel
+type fakeChangeListener struct {
+	changes chan *model.PRPChange
+}
+
+func (l *fakeChangeListener) Listen(ctx context.Context) error {
+	return nil
+}
+
+func (l *fakeChangeListener) WaitForChange(ctx context.Context) (*model.PRPChange, error) {
+	select {
+	case change := <-l.changes:
+		return change, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *fakeChangeListener) Ping(ctx context.Context) error {
+	return nil
+}
+
+func TestPRPSnapshot_Run(t *testing.T) {
+	listener := &fakeChangeListener{changes: make(chan *model.PRPChange)}
+	snapshot := NewPRPSnapshot(&mocks.MockRepository{LoadPRPTablesFunc: getTestPRPTables}, listener, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		snapshot.Run(ctx)
+		close(done)
+	}()
+
+	listener.changes <- rowChange(t, "user_roles", "DELETE", model.UserRoleRow{ID: "ur-manager"}, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for snapshot.Status().Version < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("change was not applied, status = %+v", snapshot.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := snapshot.Status()
+	if !status.Fresh || status.SyncedAt == nil {
+		t.Errorf("Status() = %+v, want a fresh snapshot", status)
+	}
+	roles, _, _ := (&snapshotRepository{snapshot: snapshot.fresh()}).GetUserRoles(ctx, testManagerUser)
+	if len(roles) != 0 {
+		t.Errorf("roles = %v, want none after the deletion", roles)
+	}
+
+	cancel()
+	<-done
+	if snapshot.Status().Fresh {
+		t.Errorf("Status() after stopping = %+v, want a stale snapshot", snapshot.Status())
+	}
+}
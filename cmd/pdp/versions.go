@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// databaseSource loads the tenant's active policy version from the PRP
+type databaseSource struct {
+	repo     interfaces.Repository
+	tenantID string
+}
+
+// NewDatabaseSource creates a PolicySource for the tenant's active policy version
+func NewDatabaseSource(repo interfaces.Repository, tenantID string) PolicySource {
+	return &databaseSource{repo: repo, tenantID: tenantID}
+}
+
+// Fingerprint is the ID of the active version, or empty while no version was activated
+func (s *databaseSource) Fingerprint(ctx context.Context) (string, error) {
+	version, err := s.repo.GetActivePolicyVersion(ctx, s.tenantID)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return version.ID, nil
+}
+
+func (s *databaseSource) Load(ctx context.Context) (*PolicySet, error) {
+	version, err := s.repo.GetActivePolicyVersion(ctx, s.tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return versionPolicySet(version)
+}
+
+func (s *databaseSource) String() string {
+	return "prp:" + s.tenantID
+}
+
+// versionPolicySet compiles a stored policy version. Its revision is the version number.
+func versionPolicySet(version *model.PolicyVersion) (*PolicySet, error) {
+	return NewPolicySetFromSources("prp:"+version.TenantID, fmt.Sprintf("v%d", version.Version), version.Modules, version.Data)
+}
+
+// PolicyValidation is the result of compiling a policy version and running its Rego tests
+type PolicyValidation struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// PolicyVersionResponse is an uploaded policy version with its validation result
+type PolicyVersionResponse struct {
+	model.PolicyVersion
+	Validation PolicyValidation `json:"validation"`
+}
+
+// PolicyDiff lists the differences between the active policy and a version
+type PolicyDiff struct {
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Modules     []ModuleDiff `json:"modules"`
+	DataChanged bool         `json:"data_changed"`
+}
+
+// ModuleDiff is the line diff of a module that was added, removed or modified
+type ModuleDiff struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Diff   string `json:"diff"`
+}
+
+// validateVersion compiles the version, runs its Rego tests and prepares the PDP queries.
+// The prepared policy is returned only if the version is valid.
+func (h *PDPHandler) validateVersion(ctx context.Context, version *model.PolicyVersion) (*activePolicy, PolicyValidation) {
+	policies, err := versionPolicySet(version)
+	if err != nil {
+		return nil, PolicyValidation{Errors: []string{err.Error()}}
+	}
+	if err := policies.RunTests(ctx); err != nil {
+		return nil, PolicyValidation{Errors: []string{err.Error()}}
+	}
+	prepared, err := preparePolicy(policies, h.target)
+	if err != nil {
+		return nil, PolicyValidation{Errors: []string{err.Error()}}
+	}
+	if err := h.models.validate(prepared.models); err != nil {
+		return nil, PolicyValidation{Errors: []string{err.Error()}}
+	}
+	return prepared, PolicyValidation{Valid: true}
+}
+
+// HandleCreatePolicyVersion stores the uploaded modules and data as the tenant's next policy version
+func (h *PDPHandler) HandleCreatePolicyVersion(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Modules map[string]string      `json:"modules"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Modules) == 0 {
+		http.Error(w, "Missing modules", http.StatusBadRequest)
+		return
+	}
+
+	version := &model.PolicyVersion{
+		TenantID:  h.tenantID,
+		Modules:   req.Modules,
+		Data:      req.Data,
+		CreatedBy: adminID,
+	}
+	if err := h.repo.CreatePolicyVersion(r.Context(), version); err != nil {
+		log.Printf("[ERROR] Failed to create policy version: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	_, validation := h.validateVersion(r.Context(), version)
+
+	log.Printf("[AUDIT] Policy version uploaded: tenant=%s, version=%d, createdBy=%s, valid=%t",
+		version.TenantID, version.Version, adminID, validation.Valid)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PolicyVersionResponse{PolicyVersion: *version, Validation: validation})
+}
+
+// HandleListPolicyVersions lists the tenant's policy versions, newest first
+func (h *PDPHandler) HandleListPolicyVersions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireAdmin(w, r); !ok {
+		return
+	}
+
+	versions, err := h.repo.ListPolicyVersions(r.Context(), h.tenantID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list policy versions: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		versions = []model.PolicyVersion{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// HandleValidatePolicyVersion compiles a policy version and runs its Rego tests without activating it
+func (h *PDPHandler) HandleValidatePolicyVersion(w http.ResponseWriter, r *http.Request, versionParam string) {
+	if _, ok := h.requireAdmin(w, r); !ok {
+		return
+	}
+	version, ok := h.getPolicyVersion(w, r, versionParam)
+	if !ok {
+		return
+	}
+
+	_, validation := h.validateVersion(r.Context(), version)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(validation)
+}
+
+// HandleDiffPolicyVersion diffs a policy version against the active policy
+func (h *PDPHandler) HandleDiffPolicyVersion(w http.ResponseWriter, r *http.Request, versionParam string) {
+	if _, ok := h.requireAdmin(w, r); !ok {
+		return
+	}
+	version, ok := h.getPolicyVersion(w, r, versionParam)
+	if !ok {
+		return
+	}
+
+	active := h.active.Load().policies
+	diff := PolicyDiff{
+		From:        active.Revision,
+		To:          fmt.Sprintf("v%d", version.Version),
+		Modules:     diffModules(active.sources, version.Modules),
+		DataChanged: !reflect.DeepEqual(normalizeData(active.data), normalizeData(version.Data)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// HandleActivatePolicyVersion validates a policy version, records it as the active one and swaps it in
+func (h *PDPHandler) HandleActivatePolicyVersion(w http.ResponseWriter, r *http.Request, versionParam string) {
+	adminID, ok := h.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	if !h.requireDatabaseSource(w) {
+		return
+	}
+	version, ok := h.getPolicyVersion(w, r, versionParam)
+	if !ok {
+		return
+	}
+
+	h.activateVersion(w, r, version, adminID)
+}
+
+// HandleRollbackPolicyVersion reactivates the version that was active before the current one
+func (h *PDPHandler) HandleRollbackPolicyVersion(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	if !h.requireDatabaseSource(w) {
+		return
+	}
+	ctx := r.Context()
+
+	activations, err := h.repo.GetPolicyActivations(ctx, h.tenantID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get policy activations: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Activations are newest first; the first one with another version is the previous version
+	previous := 0
+	for _, activation := range activations {
+		if activation.Version != activations[0].Version {
+			previous = activation.Version
+			break
+		}
+	}
+	if previous == 0 {
+		http.Error(w, "No previous policy version to roll back to", http.StatusConflict)
+		return
+	}
+
+	version, ok := h.getPolicyVersion(w, r, strconv.Itoa(previous))
+	if !ok {
+		return
+	}
+
+	h.activateVersion(w, r, version, adminID)
+}
+
+// activateVersion activates a valid policy version and writes the activation as the response
+func (h *PDPHandler) activateVersion(w http.ResponseWriter, r *http.Request, version *model.PolicyVersion, adminID string) {
+	prepared, validation := h.validateVersion(r.Context(), version)
+	if !validation.Valid {
+		log.Printf("[AUDIT] Policy version activation rejected: tenant=%s, version=%d, activatedBy=%s",
+			version.TenantID, version.Version, adminID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(validation)
+		return
+	}
+
+	if err := h.repo.ActivatePolicyVersion(r.Context(), version.TenantID, version.Version, adminID); err != nil {
+		log.Printf("[ERROR] Failed to activate policy version: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	previous := h.active.Load().policies.Revision
+	h.active.Store(prepared)
+
+	log.Printf("[AUDIT] Policy version activated: tenant=%s, version=%d, previous=%s, activatedBy=%s",
+		version.TenantID, version.Version, previous, adminID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.PolicyActivation{
+		Version:     version.Version,
+		ActivatedBy: adminID,
+		ActivatedAt: prepared.loadedAt,
+	})
+}
+
+// requireDatabaseSource writes 409 and returns false unless the policies are loaded from the
+// tenant's policy versions. With PDP_POLICY_SOURCE=file an activated version would be replaced
+// by the files on the next change or restart.
+func (h *PDPHandler) requireDatabaseSource(w http.ResponseWriter) bool {
+	if _, ok := h.source.(*databaseSource); ok {
+		return true
+	}
+	http.Error(w, "Policy versions can only be activated with PDP_POLICY_SOURCE=database", http.StatusConflict)
+	return false
+}
+
+// getPolicyVersion looks up the tenant's policy version. It writes an error response and returns false otherwise.
+func (h *PDPHandler) getPolicyVersion(w http.ResponseWriter, r *http.Request, versionParam string) (*model.PolicyVersion, bool) {
+	number, err := strconv.Atoi(versionParam)
+	if err != nil || number < 1 {
+		http.Error(w, "Invalid policy version", http.StatusBadRequest)
+		return nil, false
+	}
+
+	version, err := h.repo.GetPolicyVersion(r.Context(), h.tenantID, number)
+	if err != nil {
+		if errors.Is(err, interfaces.ErrNotFound) {
+			http.Error(w, "Policy version not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("[ERROR] Failed to get policy version: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return version, true
+}
+
+// diffModules compares module sources by name and returns the changed modules sorted by name
+func diffModules(from, to map[string]string) []ModuleDiff {
+	names := make(map[string]bool, len(from)+len(to))
+	for name := range from {
+		names[name] = true
+	}
+	for name := range to {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	diffs := []ModuleDiff{}
+	for _, name := range sorted {
+		oldSource, inFrom := from[name]
+		newSource, inTo := to[name]
+		switch {
+		case !inFrom:
+			diffs = append(diffs, ModuleDiff{Name: name, Status: "added", Diff: diffLines("", newSource)})
+		case !inTo:
+			diffs = append(diffs, ModuleDiff{Name: name, Status: "removed", Diff: diffLines(oldSource, "")})
+		case oldSource != newSource:
+			diffs = append(diffs, ModuleDiff{Name: name, Status: "modified", Diff: diffLines(oldSource, newSource)})
+		}
+	}
+	return diffs
+}
+
+// diffLines returns the changed lines between two sources, prefixed with "-" or "+"
+func diffLines(from, to string) string {
+	a := splitLines(from)
+	b := splitLines(to)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&diff, "+%s\n", b[j])
+			j++
+		default:
+			fmt.Fprintf(&diff, "-%s\n", a[i])
+			i++
+		}
+	}
+	return diff.String()
+}
+
+func splitLines(source string) []string {
+	if source == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+}
+
+// normalizeData round-trips policy data through JSON so numbers compare equal regardless of how they were decoded
+func normalizeData(data map[string]interface{}) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var normalized interface{}
+	json.Unmarshal(b, &normalized)
+	return normalized
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// newPolicyVersionMockRepo returns a mock repository storing policy versions and activations in memory
+func newPolicyVersionMockRepo() *mocks.MockRepository {
+	var versions []model.PolicyVersion
+	var activations []model.PolicyActivation
+
+	mockRepo := newBreakGlassMockRepo()
+	mockRepo.CreatePolicyVersionFunc = func(ctx context.Context, version *model.PolicyVersion) error {
+		version.Version = len(versions) + 1
+		version.ID = fmt.Sprintf("version-%d", version.Version)
+		version.CreatedAt = time.Now()
+		versions = append(versions, *version)
+		return nil
+	}
+	mockRepo.GetPolicyVersionFunc = func(ctx context.Context, tenantID string, version int) (*model.PolicyVersion, error) {
+		if version < 1 || version > len(versions) {
+			return nil, fmt.Errorf("policy version %d: %w", version, interfaces.ErrNotFound)
+		}
+		v := versions[version-1]
+		return &v, nil
+	}
+	mockRepo.ListPolicyVersionsFunc = func(ctx context.Context, tenantID string) ([]model.PolicyVersion, error) {
+		return versions, nil
+	}
+	mockRepo.ActivatePolicyVersionFunc = func(ctx context.Context, tenantID string, version int, activatedBy string) error {
+		activations = append([]model.PolicyActivation{{Version: version, ActivatedBy: activatedBy, ActivatedAt: time.Now()}}, activations...)
+		return nil
+	}
+	mockRepo.GetPolicyActivationsFunc = func(ctx context.Context, tenantID string) ([]model.PolicyActivation, error) {
+		return activations, nil
+	}
+	mockRepo.GetActivePolicyVersionFunc = func(ctx context.Context, tenantID string) (*model.PolicyVersion, error) {
+		if len(activations) == 0 {
+			return nil, fmt.Errorf("active policy version: %w", interfaces.ErrNotFound)
+		}
+		v := versions[activations[0].Version-1]
+		return &v, nil
+	}
+	return mockRepo
+}
+
+// policySources returns the sources of the policy directory with the marker rule appended to rbac.rego
+func policySources(t *testing.T, marker string) map[string]string {
+	t.Helper()
+
+	policies, err := LoadPolicySet("policy")
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+	sources := make(map[string]string, len(policies.sources))
+	for name, source := range policies.sources {
+		sources[name] = source
+	}
+	sources["rbac.rego"] += "\n" + marker + " := true\n"
+	return sources
+}
+
+func adminRequest(method, target string, body interface{}) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	setCallerToken(req, testAdminUser)
+	return req
+}
+
+func uploadVersion(t *testing.T, handler *PDPHandler, modules map[string]string) PolicyVersionResponse {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.HandleCreatePolicyVersion(rec, adminRequest(http.MethodPost, "/policies/versions", map[string]interface{}{"modules": modules}))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("HandleCreatePolicyVersion() status = %v, body = %s", rec.Code, rec.Body.String())
+	}
+	var response PolicyVersionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode version: %v", err)
+	}
+	return response
+}
+
+func TestPDPHandler_policyVersions(t *testing.T) {
+	mockRepo := newPolicyVersionMockRepo()
+	handler := NewPDPHandler(mockRepo)
+	handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+	handler.SetPolicySource(NewDatabaseSource(mockRepo, defaultTenantID))
+	initial := handler.active.Load().policies.Revision
+
+	v1 := uploadVersion(t, handler, policySources(t, "version_one"))
+	if v1.Version != 1 || !v1.Validation.Valid || v1.CreatedBy != testAdminUser {
+		t.Fatalf("uploaded version = %+v, want valid version 1 created by the admin", v1)
+	}
+
+	broken := policySources(t, "version_two")
+	broken["rbac.rego"] += "\nbroken if undefined_function(input)\n"
+	v2 := uploadVersion(t, handler, broken)
+	if v2.Validation.Valid || len(v2.Validation.Errors) == 0 {
+		t.Errorf("uploaded broken version validation = %+v, want errors", v2.Validation)
+	}
+
+	// Non-admins cannot manage policies
+	req := httptest.NewRequest(http.MethodPost, "/policies/versions/1/activate", nil)
+	setCallerToken(req, testManagerUser)
+	rec := httptest.NewRecorder()
+	handler.HandleActivatePolicyVersion(rec, req, "1")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("HandleActivatePolicyVersion() by manager status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	// The diff shows the marker added to rbac.rego
+	rec = httptest.NewRecorder()
+	handler.HandleDiffPolicyVersion(rec, adminRequest(http.MethodGet, "/policies/versions/1/diff", nil), "1")
+	var diff PolicyDiff
+	if err := json.NewDecoder(rec.Body).Decode(&diff); err != nil {
+		t.Fatalf("Failed to decode diff: %v", err)
+	}
+	if diff.From != initial || diff.To != "v1" || len(diff.Modules) != 1 ||
+		diff.Modules[0].Name != "rbac.rego" || diff.Modules[0].Status != "modified" ||
+		!strings.Contains(diff.Modules[0].Diff, "+version_one := true") || strings.Contains(diff.Modules[0].Diff, "-") {
+		t.Errorf("HandleDiffPolicyVersion() = %+v, want only the added marker line in rbac.rego", diff)
+	}
+
+	// An invalid version is not activated
+	rec = httptest.NewRecorder()
+	handler.HandleActivatePolicyVersion(rec, adminRequest(http.MethodPost, "/policies/versions/2/activate", nil), "2")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("HandleActivatePolicyVersion() invalid status = %v, want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if got := handler.active.Load().policies.Revision; got != initial {
+		t.Errorf("active revision after invalid activation = %q, want %q", got, initial)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.HandleActivatePolicyVersion(rec, adminRequest(http.MethodPost, "/policies/versions/9/activate", nil), "9")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("HandleActivatePolicyVersion() unknown status = %v, want %v", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.HandleActivatePolicyVersion(rec, adminRequest(http.MethodPost, "/policies/versions/1/activate", nil), "1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HandleActivatePolicyVersion() status = %v, body = %s", rec.Code, rec.Body.String())
+	}
+	if got := handler.active.Load().policies.Revision; got != "v1" {
+		t.Errorf("active revision = %q, want %q", got, "v1")
+	}
+
+	// There is nothing to roll back to yet
+	rec = httptest.NewRecorder()
+	handler.HandleRollbackPolicyVersion(rec, adminRequest(http.MethodPost, "/policies/rollback", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("HandleRollbackPolicyVersion() status = %v, want %v", rec.Code, http.StatusConflict)
+	}
+
+	uploadVersion(t, handler, policySources(t, "version_three"))
+	rec = httptest.NewRecorder()
+	handler.HandleActivatePolicyVersion(rec, adminRequest(http.MethodPost, "/policies/versions/3/activate", nil), "3")
+	if got := handler.active.Load().policies.Revision; got != "v3" {
+		t.Fatalf("active revision = %q, want %q", got, "v3")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.HandleRollbackPolicyVersion(rec, adminRequest(http.MethodPost, "/policies/rollback", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HandleRollbackPolicyVersion() status = %v, body = %s", rec.Code, rec.Body.String())
+	}
+	if got := handler.active.Load().policies.Revision; got != "v1" {
+		t.Errorf("active revision after rollback = %q, want %q", got, "v1")
+	}
+}
+
+func TestPDPHandler_policyVersions_fileSource(t *testing.T) {
+	handler := NewPDPHandler(newPolicyVersionMockRepo())
+	handler.SetCallerAuthenticator(newTestCallerAuthenticator())
+	handler.SetPolicySource(NewFileSource("policy"))
+	initial := handler.active.Load().policies.Revision
+
+	// Versions can be uploaded, but not activated over the policy files
+	uploadVersion(t, handler, policySources(t, "version_one"))
+
+	rec := httptest.NewRecorder()
+	handler.HandleActivatePolicyVersion(rec, adminRequest(http.MethodPost, "/policies/versions/1/activate", nil), "1")
+	if rec.Code != http.StatusConflict {
+		t.Errorf("HandleActivatePolicyVersion() status = %v, want %v", rec.Code, http.StatusConflict)
+	}
+	rec = httptest.NewRecorder()
+	handler.HandleRollbackPolicyVersion(rec, adminRequest(http.MethodPost, "/policies/rollback", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("HandleRollbackPolicyVersion() status = %v, want %v", rec.Code, http.StatusConflict)
+	}
+	if got := handler.active.Load().policies.Revision; got != initial {
+		t.Errorf("active revision = %q, want the policy files' %q", got, initial)
+	}
+}
+
+func TestPolicyWatcher_Check_database(t *testing.T) {
+	mockRepo := newPolicyVersionMockRepo()
+	handler := NewPDPHandler(mockRepo)
+	initial := handler.active.Load().policies.Revision
+	watcher := NewPolicyWatcher(handler, NewDatabaseSource(mockRepo, defaultTenantID), time.Minute)
+
+	// The policies the PDP started with stay active until a version is activated
+	if activated, err := watcher.Check(context.Background()); activated || err != nil {
+		t.Errorf("Check() without active version = %v, %v, want false, nil", activated, err)
+	}
+	if got := handler.active.Load().policies.Revision; got != initial {
+		t.Errorf("active revision = %q, want %q", got, initial)
+	}
+
+	// A version activated by another PDP instance is picked up
+	version := &model.PolicyVersion{TenantID: defaultTenantID, Modules: policySources(t, "from_database")}
+	mockRepo.CreatePolicyVersion(context.Background(), version)
+	mockRepo.ActivatePolicyVersion(context.Background(), defaultTenantID, version.Version, testAdminUser)
+
+	if activated, err := watcher.Check(context.Background()); !activated || err != nil {
+		t.Fatalf("Check() after activation = %v, %v, want true, nil", activated, err)
+	}
+	if got := handler.active.Load().policies.Revision; got != "v1" {
+		t.Errorf("active revision = %q, want %q", got, "v1")
+	}
+}
@@ -0,0 +1,101 @@
+//go:build opa_wasm
+
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// benchmarkRequest is a decision combining every policy model, as most of the PDP's queries are evaluated for it
+var benchmarkRequest = model.EvaluationRequest{
+	UserID:       testEmployeeUser,
+	ResourceType: "employees",
+	ResourceID:   testEmployeeUser,
+	Action:       "view",
+	Data: map[string]interface{}{"employees": []interface{}{
+		map[string]interface{}{"id": testEmployeeUser, "name": "Bob", "salary": 1000},
+	}},
+}
+
+// benchmarkTargets are the evaluation targets compared by the benchmarks
+var benchmarkTargets = []string{targetRego, targetWasm}
+
+// newBenchmarkHandlers creates a handler for each target evaluating the policies with every
+// policy model. The PDP's debug logs are discarded so they do not dominate the measurements.
+func newBenchmarkHandlers(b *testing.B) map[string]*PDPHandler {
+	b.Helper()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	policies := loadModelsPolicySet(b, `{"policies": ["rbac", "abac", "rebac"], "algorithm": "deny-overrides"}`)
+	handlers := make(map[string]*PDPHandler, len(benchmarkTargets))
+	for _, target := range benchmarkTargets {
+		handlers[target] = newTargetHandler(b, newModelsMockRepo(), policies, target)
+	}
+	return handlers
+}
+
+// BenchmarkEvalTarget_rbacQuery measures the evaluation of the RBAC query alone
+func BenchmarkEvalTarget_rbacQuery(b *testing.B) {
+	handlers := newBenchmarkHandlers(b)
+	for _, target := range benchmarkTargets {
+		handler := handlers[target]
+		input, err := handler.rbacInput(context.Background(), benchmarkRequest)
+		if err != nil {
+			b.Fatalf("rbacInput() error = %v", err)
+		}
+		query := handler.active.Load().opaRBAC
+
+		b.Run(target, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := query.Eval(context.Background(), rego.EvalInput(input)); err != nil {
+					b.Fatalf("Eval() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEvalTarget_evaluate measures a decision of the PDP, from building the inputs to combining the policies
+func BenchmarkEvalTarget_evaluate(b *testing.B) {
+	handlers := newBenchmarkHandlers(b)
+	for _, target := range benchmarkTargets {
+		handler := handlers[target]
+		b.Run(target, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := handler.evaluate(context.Background(), benchmarkRequest); err != nil {
+					b.Fatalf("evaluate() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEvalTarget_evaluateParallel measures decisions evaluated concurrently, as the PDP serves them
+func BenchmarkEvalTarget_evaluateParallel(b *testing.B) {
+	handlers := newBenchmarkHandlers(b)
+	for _, target := range benchmarkTargets {
+		handler := handlers[target]
+		b.Run(target, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := handler.evaluate(context.Background(), benchmarkRequest); err != nil {
+						b.Errorf("evaluate() error = %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
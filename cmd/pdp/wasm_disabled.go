@@ -0,0 +1,6 @@
+//go:build !opa_wasm
+
+package main
+
+// wasmAvailable reports whether the PDP can evaluate queries compiled to Wasm
+const wasmAvailable = false
@@ -0,0 +1,9 @@
+//go:build opa_wasm
+
+package main
+
+// Registers the OPA Wasm runtime, which requires cgo
+import _ "github.com/open-policy-agent/opa/features/wasm"
+
+// wasmAvailable reports whether the PDP can evaluate queries compiled to Wasm
+const wasmAvailable = true
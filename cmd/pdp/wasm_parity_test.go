@@ -0,0 +1,150 @@
+//go:build opa_wasm
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// newTargetHandler creates a handler evaluating the policy set on the target
+func newTargetHandler(t testing.TB, repo interfaces.Repository, policies *PolicySet, target string) *PDPHandler {
+	t.Helper()
+	handler, err := newPDPHandler(repo, policies)
+	if err != nil {
+		t.Fatalf("newPDPHandler() error = %v", err)
+	}
+	if err := handler.SetEvalTarget(target); err != nil {
+		t.Fatalf("SetEvalTarget(%q) error = %v", target, err)
+	}
+	return handler
+}
+
+// TestWasmParity_policyTests runs the Rego tests shipped with the policies on both targets
+func TestWasmParity_policyTests(t *testing.T) {
+	policies, err := LoadPolicySet(defaultPolicyPath)
+	if err != nil {
+		t.Fatalf("LoadPolicySet() error = %v", err)
+	}
+
+	outcomes := make(map[string]map[string]bool)
+	for _, target := range []string{targetRego, targetWasm} {
+		results, err := policies.testResults(context.Background(), target)
+		if err != nil {
+			t.Fatalf("testResults(%q) error = %v", target, err)
+		}
+		if len(results) == 0 {
+			t.Fatalf("testResults(%q) ran no tests", target)
+		}
+		outcomes[target] = make(map[string]bool, len(results))
+		for _, result := range results {
+			outcomes[target][result.Package+"."+result.Name] = result.Pass()
+		}
+	}
+
+	for name, pass := range outcomes[targetRego] {
+		if wasmPass, ok := outcomes[targetWasm][name]; !ok || wasmPass != pass {
+			t.Errorf("%s: pass on Rego %v, pass on Wasm %v (ran %v)", name, pass, wasmPass, ok)
+		}
+	}
+	if len(outcomes[targetWasm]) != len(outcomes[targetRego]) {
+		t.Errorf("ran %d tests on Wasm, want %d", len(outcomes[targetWasm]), len(outcomes[targetRego]))
+	}
+}
+
+// TestWasmParity_evaluate compares the decisions and explanations of the PDP on both targets
+func TestWasmParity_evaluate(t *testing.T) {
+	policies := loadModelsPolicySet(t, `{
+		"policies": ["rbac", "abac", "rebac"],
+		"algorithm": "permit-overrides"
+	}`)
+	repo := newModelsMockRepo()
+	regoHandler := newTargetHandler(t, repo, policies, targetRego)
+	wasmHandler := newTargetHandler(t, repo, policies, targetWasm)
+
+	// Monday 10:00 in Tokyo
+	env := &model.Environment{ClientIP: "10.1.2.3", RequestTime: time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC), Timezone: "Asia/Tokyo"}
+	requests := []struct {
+		name string
+		req  model.EvaluationRequest
+	}{
+		{
+			name: "Manager_views_managed_employee",
+			req:  model.EvaluationRequest{UserID: testManagerUser, ResourceType: "employees", ResourceID: testEmployeeUser, Action: "view", Environment: env},
+		},
+		{
+			name: "Employee_views_own_record",
+			req:  model.EvaluationRequest{UserID: testEmployeeUser, ResourceType: "employees", ResourceID: testEmployeeUser, Action: "view"},
+		},
+		{
+			name: "Employee_views_other_department",
+			req:  model.EvaluationRequest{UserID: testEmployeeUser, ResourceType: "employees", ResourceID: testHRUser, Action: "view"},
+		},
+		{
+			name: "Employee_edits",
+			req:  model.EvaluationRequest{UserID: testEmployeeUser, ResourceType: "employees", ResourceID: testEmployeeUser, Action: "edit"},
+		},
+		{
+			name: "Unknown_user",
+			req:  model.EvaluationRequest{UserID: "00000000-0000-0000-0000-000000000000", ResourceType: "employees", Action: "view"},
+		},
+		{
+			name: "Administrator",
+			req:  model.EvaluationRequest{UserID: testAdminUser, ResourceType: "admin", Action: "manage"},
+		},
+		{
+			name: "Manager_cannot_act_as_employee",
+			req:  model.EvaluationRequest{UserID: testManagerUser, ActAs: testEmployeeUser, ResourceType: "employees", Action: "view"},
+		},
+		{
+			name: "Filtered_data",
+			req: model.EvaluationRequest{
+				UserID:       testEmployeeUser,
+				ResourceType: "employees",
+				Action:       "view",
+				Data: map[string]interface{}{"employees": []interface{}{
+					map[string]interface{}{"id": testEmployeeUser, "name": "Bob", "salary": 1000},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			regoResponse, regoErr := regoHandler.evaluate(context.Background(), tt.req)
+			wasmResponse, wasmErr := wasmHandler.evaluate(context.Background(), tt.req)
+			if (regoErr == nil) != (wasmErr == nil) {
+				t.Fatalf("evaluate() error on Rego = %v, on Wasm = %v", regoErr, wasmErr)
+			}
+			if !reflect.DeepEqual(regoResponse, wasmResponse) {
+				t.Errorf("evaluate() on Rego = %+v, on Wasm = %+v", regoResponse, wasmResponse)
+			}
+
+			// Explained requests fall back to Rego for the traced queries
+			regoExplanation := explainEvaluation(t, regoHandler, tt.req)
+			wasmExplanation := explainEvaluation(t, wasmHandler, tt.req)
+			if !reflect.DeepEqual(regoExplanation, wasmExplanation) {
+				t.Errorf("explanation on Rego = %+v, on Wasm = %+v", regoExplanation, wasmExplanation)
+			}
+		})
+	}
+}
+
+// explainEvaluation evaluates the request with an explainer and returns the explanation
+func explainEvaluation(t *testing.T, handler *PDPHandler, req model.EvaluationRequest) *model.Explanation {
+	t.Helper()
+	explain, err := newExplainer(explainNotes)
+	if err != nil {
+		t.Fatalf("newExplainer() error = %v", err)
+	}
+	ctx := context.WithValue(context.Background(), explainerKey{}, explain)
+	if _, err := handler.evaluate(ctx, req); err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	return explain.explanation
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// defaultTimezone is the timezone time-of-day rules are evaluated in, unless PEP_TIMEZONE is set
+const defaultTimezone = "UTC"
+
+// EnvironmentConfig is how the PEP observes the context requests are made in
+type EnvironmentConfig struct {
+	// TrustedProxies are the networks of the proxies whose X-Forwarded-For entries are trusted
+	TrustedProxies []netip.Prefix
+	// Timezone is the timezone time-of-day rules are evaluated in. The timezone clients declare
+	// in X-Timezone is only forwarded for information, so that clients cannot move business hours.
+	Timezone string
+}
+
+// SetEnvironmentConfig sets how the context of requests is observed
+func (h *ProxyHandler) SetEnvironmentConfig(config EnvironmentConfig) {
+	h.environmentConfig = config
+}
+
+// newEnvironmentConfigFromEnv reads the trusted proxies from PEP_TRUSTED_PROXIES, a comma-separated
+// list of CIDRs or addresses, and the timezone from PEP_TIMEZONE
+func newEnvironmentConfigFromEnv() (EnvironmentConfig, error) {
+	config := EnvironmentConfig{Timezone: defaultTimezone}
+
+	if proxies := os.Getenv("PEP_TRUSTED_PROXIES"); proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			prefix, err := parsePrefix(strings.TrimSpace(proxy))
+			if err != nil {
+				return EnvironmentConfig{}, fmt.Errorf("invalid PEP_TRUSTED_PROXIES: %w", err)
+			}
+			config.TrustedProxies = append(config.TrustedProxies, prefix)
+		}
+	}
+
+	if timezone := os.Getenv("PEP_TIMEZONE"); timezone != "" {
+		if !validTimezone(timezone) {
+			return EnvironmentConfig{}, fmt.Errorf("invalid PEP_TIMEZONE: unknown timezone %q", timezone)
+		}
+		config.Timezone = timezone
+	}
+	return config, nil
+}
+
+// parsePrefix parses a CIDR, or a single address as the network of only that address
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// validTimezone reports whether the timezone is an IANA timezone name
+func validTimezone(timezone string) bool {
+	if timezone == "" || timezone == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(timezone)
+	return err == nil
+}
+
+// environment returns the context of the request forwarded to the PDP: the client's IP,
+// the time the PEP received the request, the configured and the client's timezone and the TLS connection
+func (h *ProxyHandler) environment(r *http.Request) *model.Environment {
+	env := &model.Environment{
+		ClientIP:    h.environmentConfig.clientIP(r),
+		RequestTime: time.Now(),
+		Timezone:    h.environmentConfig.Timezone,
+		TLS:         tlsInfo(r.TLS),
+	}
+	if env.Timezone == "" {
+		env.Timezone = defaultTimezone
+	}
+	if timezone := r.Header.Get("X-Timezone"); validTimezone(timezone) {
+		env.ClientTimezone = timezone
+	}
+	return env
+}
+
+// clientIP returns the IP address of the client. The X-Forwarded-For entries are trusted only
+// as far as they were added by trusted proxies: walking back from the connection's peer, the
+// first address that is not a trusted proxy is the client.
+func (c EnvironmentConfig) clientIP(r *http.Request) string {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	client := peer.Addr().Unmap()
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0 && c.trusted(client); i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+	}
+	return client.String()
+}
+
+// trusted reports whether the address belongs to a trusted proxy
+func (c EnvironmentConfig) trusted(addr netip.Addr) bool {
+	for _, prefix := range c.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsInfo describes the TLS connection, or returns nil for plain HTTP
+func tlsInfo(state *tls.ConnectionState) *model.TLSInfo {
+	if state == nil {
+		return nil
+	}
+	return &model.TLSInfo{
+		Version:           tls.VersionName(state.Version),
+		CipherSuite:       tls.CipherSuiteName(state.CipherSuite),
+		ServerName:        state.ServerName,
+		ClientCertificate: len(state.PeerCertificates) > 0,
+	}
+}
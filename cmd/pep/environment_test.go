@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+func TestEnvironmentConfig_clientIP(t *testing.T) {
+	config := EnvironmentConfig{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}}
+
+	tests := []struct {
+		name       string
+		config     EnvironmentConfig
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "Direct_client",
+			config:     config,
+			remoteAddr: "203.0.113.7:51234",
+			want:       "203.0.113.7",
+		},
+		{
+			// Only trusted proxies may claim who the client is
+			name:       "Forwarded_by_untrusted_peer",
+			config:     config,
+			remoteAddr: "203.0.113.7:51234",
+			forwarded:  []string{"192.0.2.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Forwarded_by_trusted_proxy",
+			config:     config,
+			remoteAddr: "10.0.0.2:51234",
+			forwarded:  []string{"198.51.100.9"},
+			want:       "198.51.100.9",
+		},
+		{
+			// Entries left of the first untrusted address may be spoofed by the client
+			name:       "Chain_of_trusted_proxies",
+			config:     config,
+			remoteAddr: "10.0.0.2:51234",
+			forwarded:  []string{"192.0.2.1, 198.51.100.9", "10.1.1.1"},
+			want:       "198.51.100.9",
+		},
+		{
+			name:       "Only_trusted_addresses",
+			config:     config,
+			remoteAddr: "10.0.0.2:51234",
+			forwarded:  []string{"10.2.2.2, 10.1.1.1"},
+			want:       "10.2.2.2",
+		},
+		{
+			name:       "Invalid_entry",
+			config:     config,
+			remoteAddr: "10.0.0.2:51234",
+			forwarded:  []string{"unknown, 10.1.1.1"},
+			want:       "10.1.1.1",
+		},
+		{
+			name:       "No_trusted_proxies",
+			config:     EnvironmentConfig{},
+			remoteAddr: "10.0.0.2:51234",
+			forwarded:  []string{"198.51.100.9"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "IPv6_proxy",
+			config:     config,
+			remoteAddr: "[2001:db8::2]:51234",
+			forwarded:  []string{"2001:db9::1"},
+			want:       "2001:db9::1",
+		},
+		{
+			name:       "IPv4_mapped_peer",
+			config:     config,
+			remoteAddr: "[::ffff:203.0.113.7]:51234",
+			want:       "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, forwarded := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if got := tt.config.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEnvironmentConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		proxies  string
+		timezone string
+		want     EnvironmentConfig
+		wantErr  bool
+	}{
+		{
+			name: "Defaults",
+			want: EnvironmentConfig{Timezone: "UTC"},
+		},
+		{
+			name:     "Configured",
+			proxies:  "10.0.0.0/8, 192.0.2.10",
+			timezone: "Asia/Tokyo",
+			want: EnvironmentConfig{
+				TrustedProxies: []netip.Prefix{
+					netip.MustParsePrefix("10.0.0.0/8"),
+					netip.MustParsePrefix("192.0.2.10/32"),
+				},
+				Timezone: "Asia/Tokyo",
+			},
+		},
+		{
+			name:    "Invalid_proxy",
+			proxies: "10.0.0.0/33",
+			wantErr: true,
+		},
+		{
+			name:     "Invalid_timezone",
+			timezone: "Mars/Olympus",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PEP_TRUSTED_PROXIES", tt.proxies)
+			t.Setenv("PEP_TIMEZONE", tt.timezone)
+			got, err := newEnvironmentConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newEnvironmentConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newEnvironmentConfigFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_ServeHTTP_environment(t *testing.T) {
+	var gotReq model.EvaluationRequest
+	pdpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("Failed to decode evaluation request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(model.PolicyResponse{Allow: false, Message: "Access denied"})
+	}))
+	defer pdpServer.Close()
+
+	handler := NewProxyHandler(pdpServer.URL, &mockResourceRepository{returnID: "11111111-1111-1111-1111-111111111111"})
+	handler.SetEnvironmentConfig(EnvironmentConfig{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		Timezone:       "Europe/Berlin",
+	})
+
+	tests := []struct {
+		name               string
+		timezone           string
+		tls                *tls.ConnectionState
+		wantClientTimezone string
+		wantTLS            *model.TLSInfo
+	}{
+		{
+			name: "Plain_HTTP_without_timezone",
+		},
+		{
+			// The declared timezone is forwarded but rules are still evaluated in the configured one
+			name:               "Declared_timezone",
+			timezone:           "Asia/Tokyo",
+			wantClientTimezone: "Asia/Tokyo",
+		},
+		{
+			name:     "Unknown_timezone",
+			timezone: "Mars/Olympus",
+		},
+		{
+			name:     "TLS_with_client_certificate",
+			timezone: "Local",
+			tls: &tls.ConnectionState{
+				Version:          tls.VersionTLS13,
+				CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+				ServerName:       "employee.local",
+				PeerCertificates: []*x509.Certificate{{}},
+			},
+			wantTLS: &model.TLSInfo{
+				Version:           "TLS 1.3",
+				CipherSuite:       "TLS_AES_128_GCM_SHA256",
+				ServerName:        "employee.local",
+				ClientCertificate: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotReq = model.EvaluationRequest{}
+			req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+			req.RemoteAddr = "10.0.0.2:51234"
+			req.Header.Set("X-Forwarded-For", "198.51.100.9")
+			req.Header.Set("X-User-ID", "user1")
+			if tt.timezone != "" {
+				req.Header.Set("X-Timezone", tt.timezone)
+			}
+			req.TLS = tt.tls
+
+			before := time.Now()
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			env := gotReq.Environment
+			if env == nil {
+				t.Fatal("Evaluation request has no environment")
+			}
+			if env.ClientIP != "198.51.100.9" {
+				t.Errorf("Environment client IP = %q, want %q", env.ClientIP, "198.51.100.9")
+			}
+			if env.RequestTime.Before(before.Add(-time.Second)) || env.RequestTime.After(time.Now()) {
+				t.Errorf("Environment request time = %v, want the time of the request", env.RequestTime)
+			}
+			if env.Timezone != "Europe/Berlin" {
+				t.Errorf("Environment timezone = %q, want the configured %q", env.Timezone, "Europe/Berlin")
+			}
+			if env.ClientTimezone != tt.wantClientTimezone {
+				t.Errorf("Environment client timezone = %q, want %q", env.ClientTimezone, tt.wantClientTimezone)
+			}
+			if !reflect.DeepEqual(env.TLS, tt.wantTLS) {
+				t.Errorf("Environment TLS = %+v, want %+v", env.TLS, tt.wantTLS)
+			}
+		})
+	}
+}
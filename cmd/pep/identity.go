@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+// Subject types passed to the policy
+const (
+	SubjectTypeUser    = "user"
+	SubjectTypeService = "service"
+)
+
+// ErrNoCredentials is returned by an IdentityExtractor when the request does not carry its credentials
+var ErrNoCredentials = errors.New("no credentials")
+
+// Subject is the authenticated caller of a request
+type Subject struct {
+	ID       string
+	Type     string
+	TenantID string
+	ActAs    string
+	Purpose  string
+}
+
+// IdentityExtractor extracts the subject of a request from its credentials
+type IdentityExtractor interface {
+	Extract(r *http.Request) (*Subject, error)
+}
+
+// IdentityRoute selects the extractors tried, in order, for requests under PathPrefix
+type IdentityRoute struct {
+	PathPrefix string
+	Extractors []IdentityExtractor
+}
+
+// APIKeyRepository defines the interface for API key lookups
+type APIKeyRepository interface {
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+}
+
+// HeaderExtractor trusts a header set by an upstream component to identify the user
+type HeaderExtractor struct {
+	Header string
+}
+
+// Extract implements IdentityExtractor
+func (e *HeaderExtractor) Extract(r *http.Request) (*Subject, error) {
+	userID := r.Header.Get(e.Header)
+	if userID == "" {
+		return nil, ErrNoCredentials
+	}
+	return &Subject{ID: userID, Type: SubjectTypeUser}, nil
+}
+
+// APIKeyExtractor identifies machine clients by an API key stored hashed in the PRP
+type APIKeyExtractor struct {
+	Header string
+	Repo   APIKeyRepository
+}
+
+// Extract implements IdentityExtractor
+func (e *APIKeyExtractor) Extract(r *http.Request) (*Subject, error) {
+	apiKey := r.Header.Get(e.Header)
+	if apiKey == "" {
+		return nil, ErrNoCredentials
+	}
+
+	key, err := e.Repo.GetAPIKeyByHash(r.Context(), HashAPIKey(apiKey))
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return nil, fmt.Errorf("unknown API key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("API key %s expired", key.ID)
+	}
+
+	return &Subject{ID: key.OwnerID, Type: SubjectTypeService, TenantID: key.TenantID}, nil
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash an API key is stored under
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// MTLSExtractor identifies machine clients by their verified TLS client certificate.
+// Field selects the certificate attribute used as the subject ID: "cn", "uri" or "dns".
+type MTLSExtractor struct {
+	Field string
+}
+
+// Extract implements IdentityExtractor
+func (e *MTLSExtractor) Extract(r *http.Request) (*Subject, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	var id string
+	switch e.Field {
+	case "uri":
+		if len(cert.URIs) > 0 {
+			id = cert.URIs[0].String()
+		}
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			id = cert.DNSNames[0]
+		}
+	default:
+		id = cert.Subject.CommonName
+	}
+	if id == "" {
+		return nil, fmt.Errorf("client certificate has no %s identity", e.Field)
+	}
+
+	return &Subject{ID: id, Type: SubjectTypeService}, nil
+}
+
+// JWTExtractor identifies callers by a bearer JWT signed with an HS256 secret or an RS256 key.
+// An RFC 8693 "act" claim marks the token holder as acting for the "sub" user.
+type JWTExtractor struct {
+	Secret    []byte
+	PublicKey *rsa.PublicKey
+	Issuer    string
+	Audience  string
+}
+
+// Extract implements IdentityExtractor
+func (e *JWTExtractor) Extract(r *http.Request) (*Subject, error) {
+	authorization := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := pkg.VerifyJWT(token, func(alg, _ string) (interface{}, error) {
+		switch {
+		case alg == pkg.AlgHS256 && e.Secret != nil:
+			return e.Secret, nil
+		case alg == pkg.AlgRS256 && e.PublicKey != nil:
+			return e.PublicKey, nil
+		}
+		return nil, fmt.Errorf("algorithm %s not accepted", alg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Issuer != "" && claims["iss"] != e.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if e.Audience != "" && !pkg.HasAudience(claims["aud"], e.Audience) {
+		return nil, fmt.Errorf("token not issued for audience %s", e.Audience)
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	subject := &Subject{ID: sub, Type: SubjectTypeUser}
+	if subjectType, ok := claims["subject_type"].(string); ok && subjectType != "" {
+		subject.Type = subjectType
+	}
+	subject.TenantID, _ = claims["tenant_id"].(string)
+	subject.Purpose, _ = claims["purpose"].(string)
+
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		if actor, _ := act["sub"].(string); actor != "" {
+			subject.ID = actor
+			subject.ActAs = sub
+		}
+	}
+
+	return subject, nil
+}
+
+// extractSubject runs the extractors of the route matching the request path.
+// It returns ErrNoCredentials when none of them found credentials.
+func (h *ProxyHandler) extractSubject(r *http.Request) (*Subject, error) {
+	var route *IdentityRoute
+	for i := range h.identityRoutes {
+		candidate := &h.identityRoutes[i]
+		if strings.HasPrefix(r.URL.Path, candidate.PathPrefix) &&
+			(route == nil || len(candidate.PathPrefix) > len(route.PathPrefix)) {
+			route = candidate
+		}
+	}
+	if route == nil {
+		return nil, ErrNoCredentials
+	}
+
+	for _, extractor := range route.Extractors {
+		subject, err := extractor.Extract(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return subject, err
+	}
+
+	return nil, ErrNoCredentials
+}
+
+// newIdentityRoutesFromEnv builds the identity routes from PEP_IDENTITY_ROUTES, e.g.
+// "/batch=api_key,mtls;/=session,jwt,header". Requests fall back to the X-User-ID header when it is unset.
+// rp is nil when OIDC login is not configured.
+func newIdentityRoutesFromEnv(repo APIKeyRepository, rp *OIDCRelyingParty) ([]IdentityRoute, error) {
+	config := os.Getenv("PEP_IDENTITY_ROUTES")
+	if config == "" {
+		config = "/=header"
+	}
+
+	var routes []IdentityRoute
+	for _, routeConfig := range strings.Split(config, ";") {
+		prefix, names, ok := strings.Cut(strings.TrimSpace(routeConfig), "=")
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf("invalid identity route %q", routeConfig)
+		}
+
+		route := IdentityRoute{PathPrefix: prefix}
+		for _, name := range strings.Split(names, ",") {
+			extractor, err := newIdentityExtractorFromEnv(strings.TrimSpace(name), repo, rp)
+			if err != nil {
+				return nil, err
+			}
+			route.Extractors = append(route.Extractors, extractor)
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+// newIdentityExtractorFromEnv builds the named extractor from its PEP_* environment settings
+func newIdentityExtractorFromEnv(name string, repo APIKeyRepository, rp *OIDCRelyingParty) (IdentityExtractor, error) {
+	switch name {
+	case "session":
+		if rp == nil {
+			return nil, fmt.Errorf("session extractor requires PEP_OIDC_ISSUER")
+		}
+		return &SessionExtractor{}, nil
+	case "header":
+		return &HeaderExtractor{Header: "X-User-ID"}, nil
+	case "api_key":
+		return &APIKeyExtractor{Header: "X-API-Key", Repo: repo}, nil
+	case "mtls":
+		return &MTLSExtractor{Field: os.Getenv("PEP_MTLS_SUBJECT_FIELD")}, nil
+	case "jwt":
+		extractor := &JWTExtractor{
+			Issuer:   os.Getenv("PEP_JWT_ISSUER"),
+			Audience: os.Getenv("PEP_JWT_AUDIENCE"),
+		}
+		if secret := os.Getenv("PEP_JWT_SECRET"); secret != "" {
+			extractor.Secret = []byte(secret)
+		}
+		if path := os.Getenv("PEP_JWT_PUBLIC_KEY"); path != "" {
+			publicKey, err := pkg.LoadRSAPublicKey(path)
+			if err != nil {
+				return nil, err
+			}
+			extractor.PublicKey = publicKey
+		}
+		if extractor.Secret == nil && extractor.PublicKey == nil {
+			return nil, fmt.Errorf("jwt extractor requires PEP_JWT_SECRET or PEP_JWT_PUBLIC_KEY")
+		}
+		return extractor, nil
+	}
+	return nil, fmt.Errorf("unknown identity extractor %q", name)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+// Mock APIKeyRepository for testing
+type mockAPIKeyRepository struct {
+	keys map[string]*model.APIKey
+}
+
+func (m *mockAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	key, ok := m.keys[keyHash]
+	if !ok {
+		return nil, fmt.Errorf("api key: %w", interfaces.ErrNotFound)
+	}
+	return key, nil
+}
+
+func TestAPIKeyExtractor_Extract(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	extractor := &APIKeyExtractor{
+		Header: "X-API-Key",
+		Repo: &mockAPIKeyRepository{keys: map[string]*model.APIKey{
+			HashAPIKey("batch-key"):   {ID: "key1", OwnerID: "batch", TenantID: "tenant1"},
+			HashAPIKey("expired-key"): {ID: "key2", OwnerID: "batch", TenantID: "tenant1", ExpiresAt: &expired},
+		}},
+	}
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		want    *Subject
+		wantErr error
+	}{
+		{
+			name:   "Valid_key",
+			apiKey: "batch-key",
+			want:   &Subject{ID: "batch", Type: SubjectTypeService, TenantID: "tenant1"},
+		},
+		{
+			name:    "No_key",
+			wantErr: ErrNoCredentials,
+		},
+		{
+			name:    "Unknown_key",
+			apiKey:  "other-key",
+			wantErr: errors.New("unknown API key"),
+		},
+		{
+			name:    "Expired_key",
+			apiKey:  "expired-key",
+			wantErr: errors.New("API key key2 expired"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+
+			got, err := extractor.Extract(req)
+			if tt.wantErr != nil {
+				if err == nil || (!errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error()) {
+					t.Errorf("Extract() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if *got != *tt.want {
+				t.Errorf("Extract() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTExtractor_Extract(t *testing.T) {
+	secret := []byte("test-secret")
+	extractor := &JWTExtractor{Secret: secret, Issuer: "https://idp.example.com", Audience: "pep"}
+
+	sign := func(t *testing.T, claims map[string]interface{}, key []byte) string {
+		t.Helper()
+		token, err := pkg.SignJWT(claims, pkg.AlgHS256, "", key)
+		if err != nil {
+			t.Fatalf("SignJWT() error = %v", err)
+		}
+		return token
+	}
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": "https://idp.example.com",
+			"aud": "pep",
+			"sub": "user1",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    *Subject
+		wantErr bool
+	}{
+		{
+			name:  "User_token",
+			token: sign(t, claims(map[string]interface{}{"tenant_id": "tenant1", "purpose": "payroll"}), secret),
+			want:  &Subject{ID: "user1", Type: SubjectTypeUser, TenantID: "tenant1", Purpose: "payroll"},
+		},
+		{
+			name:  "Delegated_token",
+			token: sign(t, claims(map[string]interface{}{"act": map[string]interface{}{"sub": "support1"}}), secret),
+			want:  &Subject{ID: "support1", Type: SubjectTypeUser, ActAs: "user1"},
+		},
+		{
+			name:  "Service_token",
+			token: sign(t, claims(map[string]interface{}{"sub": "batch", "subject_type": SubjectTypeService}), secret),
+			want:  &Subject{ID: "batch", Type: SubjectTypeService},
+		},
+		{
+			name:    "Wrong_secret",
+			token:   sign(t, claims(nil), []byte("other-secret")),
+			wantErr: true,
+		},
+		{
+			name:    "Wrong_audience",
+			token:   sign(t, claims(map[string]interface{}{"aud": []string{"other"}}), secret),
+			wantErr: true,
+		},
+		{
+			name:    "Expired",
+			token:   sign(t, claims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}), secret),
+			wantErr: true,
+		},
+		{
+			name:    "No_expiry",
+			token:   sign(t, map[string]interface{}{"iss": "https://idp.example.com", "aud": "pep", "sub": "user1"}, secret),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			got, err := extractor.Extract(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Extract() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *got != *tt.want {
+				t.Errorf("Extract() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_extractSubject(t *testing.T) {
+	handler := NewProxyHandler("http://pdp", &mockResourceRepository{})
+	handler.SetIdentityRoutes([]IdentityRoute{
+		{PathPrefix: "/", Extractors: []IdentityExtractor{&HeaderExtractor{Header: "X-User-ID"}}},
+		{PathPrefix: "/batch", Extractors: []IdentityExtractor{&APIKeyExtractor{
+			Header: "X-API-Key",
+			Repo: &mockAPIKeyRepository{keys: map[string]*model.APIKey{
+				HashAPIKey("batch-key"): {ID: "key1", OwnerID: "batch"},
+			}},
+		}}},
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		wantID  string
+		wantErr error
+	}{
+		{
+			name:    "Header_on_default_route",
+			path:    "/employees",
+			headers: map[string]string{"X-User-ID": "user1"},
+			wantID:  "user1",
+		},
+		{
+			name:    "API_key_on_batch_route",
+			path:    "/batch/employees",
+			headers: map[string]string{"X-API-Key": "batch-key"},
+			wantID:  "batch",
+		},
+		{
+			name:    "Header_not_accepted_on_batch_route",
+			path:    "/batch/employees",
+			headers: map[string]string{"X-User-ID": "user1"},
+			wantErr: ErrNoCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			got, err := handler.extractSubject(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("extractSubject() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got.ID != tt.wantID {
+				t.Errorf("extractSubject() ID = %q, want %q", got.ID, tt.wantID)
+			}
+		})
+	}
+}
@@ -363,3 +363,117 @@ func TestProxyHandler_checkAccess(t *testing.T) {
 		})
 	}
 }
+
+func TestProxyHandler_ServeHTTP_impersonation(t *testing.T) {
+	var gotReq model.EvaluationRequest
+	pdpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("Failed to decode evaluation request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(model.PolicyResponse{
+			Allow:   false,
+			Message: "Access denied - impersonation not permitted",
+			Impersonation: &model.Impersonation{
+				OperatorID: "user1",
+				TargetID:   "user2",
+			},
+		})
+	}))
+	defer pdpServer.Close()
+
+	handler := NewProxyHandler(pdpServer.URL, &mockResourceRepository{returnID: "11111111-1111-1111-1111-111111111111"})
+
+	req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+	req.Header.Set("X-User-ID", "user1")
+	req.Header.Set("X-Act-As", "user2")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Status code = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+	if gotReq.ActAs != "user2" {
+		t.Errorf("Evaluation request act_as = %q, want %q", gotReq.ActAs, "user2")
+	}
+	if got := rec.Header().Get("X-Impersonated-By"); got != "user1" {
+		t.Errorf("X-Impersonated-By = %q, want %q", got, "user1")
+	}
+	if got := rec.Header().Get("X-Acting-As"); got != "user2" {
+		t.Errorf("X-Acting-As = %q, want %q", got, "user2")
+	}
+}
+
+func TestProxyHandler_ServeHTTP_purpose(t *testing.T) {
+	var gotReq model.EvaluationRequest
+	pdpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("Failed to decode evaluation request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(model.PolicyResponse{Allow: false, Message: "Access denied"})
+	}))
+	defer pdpServer.Close()
+
+	handler := NewProxyHandler(pdpServer.URL, &mockResourceRepository{returnID: "11111111-1111-1111-1111-111111111111"})
+
+	req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+	req.Header.Set("X-User-ID", "user1")
+	req.Header.Set("X-Purpose", "payroll")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if gotReq.Purpose != "payroll" {
+		t.Errorf("Evaluation request purpose = %q, want %q", gotReq.Purpose, "payroll")
+	}
+}
+
+func TestProxyHandler_ServeHTTP_forwardsEffectiveUser(t *testing.T) {
+	pdpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model.PolicyResponse{
+			Allow:        true,
+			FilteredData: map[string]interface{}{"employees": []interface{}{}},
+			Impersonation: &model.Impersonation{
+				OperatorID: "user1",
+				TargetID:   "user2",
+			},
+		})
+	}))
+	defer pdpServer.Close()
+
+	var gotUserID string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID = r.Header.Get("X-User-ID")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]interface{}{"employees": {}})
+	}))
+	defer targetServer.Close()
+
+	handler := NewProxyHandler(pdpServer.URL, &mockResourceRepository{returnID: "11111111-1111-1111-1111-111111111111"})
+	handler.SetDirector(func(req *http.Request) {
+		targetURL, _ := url.Parse(targetServer.URL)
+		req.URL.Scheme = targetURL.Scheme
+		req.URL.Host = targetURL.Host
+		req.Host = targetURL.Host
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+	req.Header.Set("X-User-ID", "user1")
+	req.Header.Set("X-Act-As", "user2")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status code = %v, want %v", rec.Code, http.StatusOK)
+	}
+	// Row filtering in the backend applies to the impersonated user
+	if gotUserID != "user2" {
+		t.Errorf("Backend X-User-ID = %q, want %q", gotUserID, "user2")
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+const (
+	sessionCookieName   = "pep_session"
+	oidcStateCookieName = "pep_oidc_state"
+	// oidcLoginTimeout is how long a started login may take to come back to the callback
+	oidcLoginTimeout = 10 * time.Minute
+	// sessionRefreshLeeway refreshes tokens shortly before they expire
+	sessionRefreshLeeway = 30 * time.Second
+)
+
+// OIDCConfig configures the PEP as an OpenID Connect relying party
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// AcceptMissingEmailVerified accepts ID tokens without an email_verified claim, for providers
+	// that only issue verified email addresses and omit the claim. A false claim is always rejected.
+	AcceptMissingEmailVerified bool
+}
+
+// UserRepository defines the interface for mapping ID token claims to PRP users
+type UserRepository interface {
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+}
+
+// Session is the state kept in the encrypted session cookie
+type Session struct {
+	UserID       string    `json:"user_id"`
+	TenantID     string    `json:"tenant_id"`
+	Email        string    `json:"email"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// oidcLogin is the state kept in a cookie between the login redirect and the callback
+type oidcLogin struct {
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ReturnTo     string    `json:"return_to"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+}
+
+type sessionContextKey struct{}
+
+// OIDCRelyingParty logs browser users in with the authorization code flow and PKCE
+// and keeps their session in an encrypted cookie
+type OIDCRelyingParty struct {
+	config   OIDCConfig
+	provider oidcProviderMetadata
+	keys     map[string]*rsa.PublicKey
+	users    UserRepository
+	cookies  cipher.AEAD
+	client   *http.Client
+}
+
+// NewOIDCRelyingParty discovers the provider's endpoints and signing keys.
+// sessionKey is the 16, 24 or 32 byte AES key cookies are encrypted with.
+func NewOIDCRelyingParty(ctx context.Context, config OIDCConfig, sessionKey []byte, users UserRepository) (*OIDCRelyingParty, error) {
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	rp := &OIDCRelyingParty{
+		config:  config,
+		users:   users,
+		cookies: aead,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+
+	discoveryURL := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := rp.getJSON(ctx, discoveryURL, &rp.provider); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	if rp.provider.Issuer != config.Issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match %q", rp.provider.Issuer, config.Issuer)
+	}
+
+	var jwks pkg.JWKSet
+	if err := rp.getJSON(ctx, rp.provider.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	rp.keys = make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.RSAPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid provider key %s: %w", jwk.Kid, err)
+		}
+		rp.keys[jwk.Kid] = key
+	}
+	if len(rp.keys) == 0 {
+		return nil, fmt.Errorf("provider has no RSA signing keys")
+	}
+
+	return rp, nil
+}
+
+// ServeHTTP serves /auth/login, /auth/callback and /auth/logout
+func (rp *OIDCRelyingParty) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/auth/login":
+		rp.handleLogin(w, r)
+	case "/auth/callback":
+		rp.handleCallback(w, r)
+	case "/auth/logout":
+		rp.clearCookie(w, sessionCookieName)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (rp *OIDCRelyingParty) handleLogin(w http.ResponseWriter, r *http.Request) {
+	login := oidcLogin{
+		State:        randomString(),
+		Nonce:        randomString(),
+		CodeVerifier: randomString(),
+		ReturnTo:     "/",
+		ExpiresAt:    time.Now().Add(oidcLoginTimeout),
+	}
+	// Only return to local paths to avoid an open redirect
+	if returnTo := r.URL.Query().Get("return_to"); strings.HasPrefix(returnTo, "/") && !strings.HasPrefix(returnTo, "//") {
+		login.ReturnTo = returnTo
+	}
+	if err := rp.setCookie(w, oidcStateCookieName, login, oidcLoginTimeout); err != nil {
+		log.Printf("[ERROR] Failed to store login state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.config.ClientID},
+		"redirect_uri":          {rp.config.RedirectURL},
+		"scope":                 {strings.Join(rp.config.Scopes, " ")},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, rp.provider.AuthorizationEndpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+func (rp *OIDCRelyingParty) handleCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var login oidcLogin
+	if err := rp.readCookie(r, oidcStateCookieName, &login); err != nil || time.Now().After(login.ExpiresAt) {
+		http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	rp.clearCookie(w, oidcStateCookieName)
+
+	query := r.URL.Query()
+	if query.Get("state") != login.State {
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+	if errorCode := query.Get("error"); errorCode != "" {
+		log.Printf("[ERROR] OIDC provider returned error: %s: %s", errorCode, query.Get("error_description"))
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := rp.exchangeToken(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {query.Get("code")},
+		"redirect_uri":  {rp.config.RedirectURL},
+		"code_verifier": {login.CodeVerifier},
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to exchange authorization code: %v", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := rp.verifyIDToken(tokens.IDToken, login.Nonce)
+	if err != nil {
+		log.Printf("[ERROR] Invalid ID token: %v", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	// Map the ID token to the PRP user by its verified email address
+	email, _ := claims["email"].(string)
+	if email == "" || !rp.emailVerified(claims) {
+		log.Printf("[AUDIT] Login rejected without a verified email address: email=%s, sub=%v, email_verified=%v",
+			email, claims["sub"], claims["email_verified"])
+		http.Error(w, "Login failed: no verified email address", http.StatusForbidden)
+		return
+	}
+	user, err := rp.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		log.Printf("[AUDIT] Login rejected for unknown user: email=%s, sub=%v", email, claims["sub"])
+		http.Error(w, "Login failed: unknown user", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to look up user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	session := Session{
+		UserID:       user.ID,
+		TenantID:     user.Tenant,
+		Email:        email,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second),
+	}
+	if err := rp.setCookie(w, sessionCookieName, session, 0); err != nil {
+		log.Printf("[ERROR] Failed to store session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[AUDIT] User logged in: user=%s, email=%s, sub=%v", user.ID, email, claims["sub"])
+	http.Redirect(w, r, login.ReturnTo, http.StatusFound)
+}
+
+// emailVerified reports whether the provider asserts that the email claim of the ID token is verified
+func (rp *OIDCRelyingParty) emailVerified(claims map[string]interface{}) bool {
+	verified, ok := claims["email_verified"]
+	if !ok {
+		return rp.config.AcceptMissingEmailVerified
+	}
+	return verified == true
+}
+
+// Middleware makes the session cookie available to SessionExtractor,
+// refreshing its tokens when they are about to expire
+func (rp *OIDCRelyingParty) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var session Session
+		err := rp.readCookie(r, sessionCookieName, &session)
+		if errors.Is(err, http.ErrNoCookie) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] Discarding invalid session cookie: %v", err)
+			rp.clearCookie(w, sessionCookieName)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if time.Until(session.ExpiresAt) < sessionRefreshLeeway {
+			if err := rp.refresh(r.Context(), &session); err != nil {
+				log.Printf("[INFO] Session of user %s ended: %v", session.UserID, err)
+				rp.clearCookie(w, sessionCookieName)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := rp.setCookie(w, sessionCookieName, session, 0); err != nil {
+				log.Printf("[ERROR] Failed to store refreshed session: %v", err)
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, &session)))
+	})
+}
+
+// refresh renews the session's tokens with its refresh token
+func (rp *OIDCRelyingParty) refresh(ctx context.Context, session *Session) error {
+	if session.RefreshToken == "" {
+		return fmt.Errorf("session expired")
+	}
+
+	tokens, err := rp.exchangeToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {session.RefreshToken},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refresh tokens: %w", err)
+	}
+	if tokens.IDToken != "" {
+		if _, err := rp.verifyIDToken(tokens.IDToken, ""); err != nil {
+			return fmt.Errorf("invalid refreshed ID token: %w", err)
+		}
+	}
+
+	session.AccessToken = tokens.AccessToken
+	if tokens.RefreshToken != "" {
+		session.RefreshToken = tokens.RefreshToken
+	}
+	session.ExpiresAt = time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second)
+	return nil
+}
+
+func (rp *OIDCRelyingParty) exchangeToken(ctx context.Context, params url.Values) (*oidcTokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rp.provider.TokenEndpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(rp.config.ClientID), url.QueryEscape(rp.config.ClientSecret))
+
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	return &tokens, nil
+}
+
+// verifyIDToken checks the ID token's signature, issuer, audience and, when given, nonce
+func (rp *OIDCRelyingParty) verifyIDToken(idToken, nonce string) (map[string]interface{}, error) {
+	claims, err := pkg.VerifyJWT(idToken, func(alg, kid string) (interface{}, error) {
+		if alg != pkg.AlgRS256 {
+			return nil, fmt.Errorf("algorithm %s not accepted", alg)
+		}
+		key, ok := rp.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims["iss"] != rp.provider.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if !pkg.HasAudience(claims["aud"], rp.config.ClientID) {
+		return nil, fmt.Errorf("token not issued for client %s", rp.config.ClientID)
+	}
+	if nonce != "" && claims["nonce"] != nonce {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+	return claims, nil
+}
+
+func (rp *OIDCRelyingParty) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// setCookie stores v encrypted in the named cookie. maxAge 0 makes it a browser session cookie.
+func (rp *OIDCRelyingParty) setCookie(w http.ResponseWriter, name string, v interface{}, maxAge time.Duration) error {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, rp.cookies.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// The cookie name is authenticated so one cookie cannot be replayed as another
+	sealed := rp.cookies.Seal(nonce, nonce, plaintext, []byte(name))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    base64.RawURLEncoding.EncodeToString(sealed),
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(rp.config.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// readCookie decrypts the named cookie into v
+func (rp *OIDCRelyingParty) readCookie(r *http.Request, name string, v interface{}) error {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(sealed) < rp.cookies.NonceSize() {
+		return fmt.Errorf("malformed %s cookie", name)
+	}
+	nonceSize := rp.cookies.NonceSize()
+	plaintext, err := rp.cookies.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s cookie: %w", name, err)
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+func (rp *OIDCRelyingParty) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(rp.config.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// SessionExtractor identifies browser users by the session established by OIDCRelyingParty.
+// It requires the OIDCRelyingParty middleware in front of the proxy.
+type SessionExtractor struct{}
+
+// Extract implements IdentityExtractor
+func (e *SessionExtractor) Extract(r *http.Request) (*Subject, error) {
+	session, ok := r.Context().Value(sessionContextKey{}).(*Session)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return &Subject{ID: session.UserID, Type: SubjectTypeUser, TenantID: session.TenantID}, nil
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
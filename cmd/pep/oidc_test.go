@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/mocks"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// Mock UserRepository for testing
+type mockUserRepository struct {
+	users map[string]*model.User
+}
+
+func (m *mockUserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, ok := m.users[email]
+	if !ok {
+		return nil, fmt.Errorf("user with email '%s': %w", email, interfaces.ErrNotFound)
+	}
+	return user, nil
+}
+
+// newTestRelyingParty starts a mock IdP logging in the user with the given email
+func newTestRelyingParty(t *testing.T, email string, accessTokenTTL time.Duration) (*OIDCRelyingParty, *mocks.MockIdP) {
+	t.Helper()
+
+	idp, err := mocks.NewMockIdP("pep", "pep-secret", map[string]interface{}{
+		"sub":            "idp-user-1",
+		"email":          email,
+		"email_verified": true,
+	})
+	if err != nil {
+		t.Fatalf("NewMockIdP() error = %v", err)
+	}
+	idp.AccessTokenTTL = accessTokenTTL
+	server := httptest.NewServer(idp)
+	t.Cleanup(server.Close)
+	idp.Issuer = server.URL
+
+	rp, err := NewOIDCRelyingParty(context.Background(), OIDCConfig{
+		Issuer:       server.URL,
+		ClientID:     "pep",
+		ClientSecret: "pep-secret",
+		RedirectURL:  "http://pep.local/auth/callback",
+	}, []byte("0123456789abcdef0123456789abcdef"), &mockUserRepository{users: map[string]*model.User{
+		"john@example.com": {ID: "11111111-1111-1111-1111-111111111111", Tenant: "tenant1", Email: "john@example.com"},
+	}})
+	if err != nil {
+		t.Fatalf("NewOIDCRelyingParty() error = %v", err)
+	}
+	return rp, idp
+}
+
+// login runs the authorization code flow against the mock IdP and returns the callback response
+func login(t *testing.T, rp *OIDCRelyingParty) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	rp.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login?return_to=/employees", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %v, want %v", rec.Code, http.StatusFound)
+	}
+	stateCookies := rec.Result().Cookies()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize request error = %v", err)
+	}
+	resp.Body.Close()
+	callbackURL, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %v, location = %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/callback?"+callbackURL.RawQuery, nil)
+	for _, cookie := range stateCookies {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	rp.ServeHTTP(rec, req)
+	return rec
+}
+
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookieName && cookie.MaxAge >= 0 {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestOIDCRelyingParty_login(t *testing.T) {
+	rp, _ := newTestRelyingParty(t, "john@example.com", time.Hour)
+
+	rec := login(t, rp)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/employees" {
+		t.Fatalf("callback status = %v, location = %q, want redirect to /employees", rec.Code, rec.Header().Get("Location"))
+	}
+	cookie := sessionCookie(rec)
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("callback did not set an HttpOnly session cookie: %v", rec.Result().Cookies())
+	}
+
+	// The session identifies the PRP user mapped from the ID token's email
+	var subject *Subject
+	handler := rp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, _ = (&SessionExtractor{}).Extract(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+	req.AddCookie(cookie)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := Subject{ID: "11111111-1111-1111-1111-111111111111", Type: SubjectTypeUser, TenantID: "tenant1"}
+	if subject == nil || *subject != want {
+		t.Errorf("SessionExtractor.Extract() = %+v, want %+v", subject, want)
+	}
+}
+
+func TestOIDCRelyingParty_unknownUser(t *testing.T) {
+	rp, _ := newTestRelyingParty(t, "mallory@example.com", time.Hour)
+
+	rec := login(t, rp)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("callback status = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+	if sessionCookie(rec) != nil {
+		t.Errorf("callback set a session cookie for an unknown user")
+	}
+}
+
+func TestOIDCRelyingParty_emailVerified(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified interface{}
+		acceptMissing bool
+		wantStatus    int
+	}{
+		{
+			name:          "Verified",
+			emailVerified: true,
+			wantStatus:    http.StatusFound,
+		},
+		{
+			name:          "Not_verified",
+			emailVerified: false,
+			acceptMissing: true,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "Verified_as_string",
+			emailVerified: "true",
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:       "Missing_claim",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:          "Missing_claim_accepted_for_provider",
+			acceptMissing: true,
+			wantStatus:    http.StatusFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp, idp := newTestRelyingParty(t, "john@example.com", time.Hour)
+			rp.config.AcceptMissingEmailVerified = tt.acceptMissing
+			if tt.emailVerified == nil {
+				delete(idp.Claims, "email_verified")
+			} else {
+				idp.Claims["email_verified"] = tt.emailVerified
+			}
+
+			rec := login(t, rp)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("callback status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if (sessionCookie(rec) != nil) != (tt.wantStatus == http.StatusFound) {
+				t.Errorf("callback session cookie set = %v, want %v", sessionCookie(rec) != nil, tt.wantStatus == http.StatusFound)
+			}
+		})
+	}
+}
+
+func TestOIDCRelyingParty_tamperedState(t *testing.T) {
+	rp, _ := newTestRelyingParty(t, "john@example.com", time.Hour)
+
+	rec := httptest.NewRecorder()
+	rp.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/callback?code=abc&state=forged", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	rp.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("callback status = %v, want %v", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOIDCRelyingParty_Middleware_refresh(t *testing.T) {
+	// Access tokens expire immediately so every request refreshes them
+	rp, idp := newTestRelyingParty(t, "john@example.com", 0)
+
+	cookie := sessionCookie(login(t, rp))
+	if cookie == nil {
+		t.Fatal("login did not set a session cookie")
+	}
+
+	var subject *Subject
+	handler := rp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, _ = (&SessionExtractor{}).Extract(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if idp.RefreshCount() != 1 {
+		t.Errorf("refresh count = %d, want 1", idp.RefreshCount())
+	}
+	if subject == nil || subject.ID != "11111111-1111-1111-1111-111111111111" {
+		t.Errorf("SessionExtractor.Extract() = %+v, want the logged in user", subject)
+	}
+	refreshed := sessionCookie(rec)
+	if refreshed == nil || refreshed.Value == cookie.Value {
+		t.Fatal("Middleware did not store the refreshed session")
+	}
+
+	// The rotated refresh token in the old cookie is no longer accepted
+	subject = nil
+	req = httptest.NewRequest(http.MethodGet, "/employees", nil)
+	req.AddCookie(cookie)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if subject != nil {
+		t.Errorf("SessionExtractor.Extract() = %+v after refresh token reuse, want no session", subject)
+	}
+}
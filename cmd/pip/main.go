@@ -9,15 +9,16 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
 	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
 	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
 )
 
-// DBConnWrapper wraps a pgx.Conn to implement interfaces.DBConn
+// DBConnWrapper wraps a pgxpool.Pool to implement interfaces.DBConn
 type DBConnWrapper struct {
-	conn *pgx.Conn
+	conn *pgxpool.Pool
 }
 
 // Query implements interfaces.DBConn
@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
@@ -19,6 +20,9 @@ type PolicyInformationProvider interface {
 	GetRelationships(ctx context.Context, userID string) ([]model.Relationship, error)
 }
 
+// ErrNotFound is returned by a Repository when the requested record does not exist
+var ErrNotFound = errors.New("not found")
+
 // Repository represents a data access layer
 type Repository interface {
 	GetUserRoles(ctx context.Context, userID string) ([]string, []model.RBACPermission, error)
@@ -26,6 +30,30 @@ type Repository interface {
 	GetResourceAttributes(ctx context.Context, resourceID string) (*model.ResourceAttributes, error)
 	GetUserRelationships(ctx context.Context, userID string) ([]model.Relationship, error)
 	GetResourceIDByType(ctx context.Context, resourceType string) (string, error)
+	GetResources(ctx context.Context) ([]model.Resource, error)
+	GetResourceGrantees(ctx context.Context, resourceID string) ([]model.ResourceGrantee, error)
+	GetRolePurposes(ctx context.Context, userID string) ([]model.RolePurpose, error)
+	GetPurposeFields(ctx context.Context) ([]model.PurposeField, error)
+	GetFieldPermissions(ctx context.Context, userID string) ([]model.FieldPermission, error)
+	GetRoleParents(ctx context.Context, userID string) ([]model.RoleParent, error)
+	GetPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.RBACPermission, error)
+	GetFieldPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.FieldPermission, error)
+	GetRoleParentsForRoles(ctx context.Context, roleIDs []string) ([]model.RoleParent, error)
+	GetRolePurposesForRoles(ctx context.Context, roleIDs []string) ([]model.RolePurpose, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	LoadPRPTables(ctx context.Context) (*model.PRPTables, error)
+
+	CreateBreakGlassGrant(ctx context.Context, grant *model.BreakGlassGrant) error
+	GetActiveBreakGlassGrants(ctx context.Context, userID string) ([]model.BreakGlassGrant, error)
+	RevokeBreakGlassGrant(ctx context.Context, grantID, revokedBy string) error
+
+	CreatePolicyVersion(ctx context.Context, version *model.PolicyVersion) error
+	GetPolicyVersion(ctx context.Context, tenantID string, version int) (*model.PolicyVersion, error)
+	ListPolicyVersions(ctx context.Context, tenantID string) ([]model.PolicyVersion, error)
+	GetActivePolicyVersion(ctx context.Context, tenantID string) (*model.PolicyVersion, error)
+	ActivatePolicyVersion(ctx context.Context, tenantID string, version int, activatedBy string) error
+	GetPolicyActivations(ctx context.Context, tenantID string) ([]model.PolicyActivation, error)
 }
 
 // HTTPClient represents an HTTP client interface
@@ -0,0 +1,223 @@
+package mocks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/pkg"
+)
+
+// mockIdPKeyID is the key ID the mock IdP signs ID tokens with
+const mockIdPKeyID = "mock-idp-key"
+
+// MockIdP is a minimal OpenID Connect provider for tests. It supports discovery,
+// the authorization code flow with PKCE (S256), refresh tokens and a JWKS endpoint,
+// and logs in the user described by Claims without prompting.
+type MockIdP struct {
+	// Issuer is the base URL the IdP is served from, e.g. an httptest.Server URL
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Claims are added to every ID token, e.g. "sub" and "email"
+	Claims map[string]interface{}
+	// AccessTokenTTL is the expires_in returned with access tokens
+	AccessTokenTTL time.Duration
+
+	key           *rsa.PrivateKey
+	mu            sync.Mutex
+	codes         map[string]mockAuthCode
+	refreshTokens map[string]bool
+	refreshCount  int
+}
+
+type mockAuthCode struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// NewMockIdP returns a mock IdP for the given client with a fresh signing key
+func NewMockIdP(clientID, clientSecret string, claims map[string]interface{}) (*MockIdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &MockIdP{
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		Claims:         claims,
+		AccessTokenTTL: time.Hour,
+		key:            key,
+		codes:          make(map[string]mockAuthCode),
+		refreshTokens:  make(map[string]bool),
+	}, nil
+}
+
+// RefreshCount returns how many times tokens were refreshed
+func (m *MockIdP) RefreshCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.refreshCount
+}
+
+// ServeHTTP implements http.Handler
+func (m *MockIdP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		m.handleDiscovery(w)
+	case "/authorize":
+		m.handleAuthorize(w, r)
+	case "/token":
+		m.handleToken(w, r)
+	case "/jwks":
+		writeJSON(w, http.StatusOK, pkg.JWKSet{Keys: []pkg.JWK{pkg.NewRSAJWK(mockIdPKeyID, &m.key.PublicKey)}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockIdP) handleDiscovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                m.Issuer,
+		"authorization_endpoint":                m.Issuer + "/authorize",
+		"token_endpoint":                        m.Issuer + "/token",
+		"jwks_uri":                              m.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"id_token_signing_alg_values_supported": []string{pkg.AlgRS256},
+	})
+}
+
+func (m *MockIdP) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != m.ClientID {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomToken()
+	m.mu.Lock()
+	m.codes[code] = mockAuthCode{
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	m.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (m *MockIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != m.ClientID || clientSecret != m.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var nonce string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, ok := m.codes[r.PostForm.Get("code")]
+		delete(m.codes, r.PostForm.Get("code"))
+		if !ok || code.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(challenge[:]) != code.codeChallenge {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+		nonce = code.nonce
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		if !m.refreshTokens[refreshToken] {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		// Refresh tokens are rotated on every use
+		delete(m.refreshTokens, refreshToken)
+		m.refreshCount++
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": m.Issuer,
+		"aud": m.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range m.Claims {
+		claims[k] = v
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	idToken, err := pkg.SignJWT(claims, pkg.AlgRS256, mockIdPKeyID, m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	refreshToken := randomToken()
+	m.refreshTokens[refreshToken] = true
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  randomToken(),
+		"token_type":    "Bearer",
+		"expires_in":    int(m.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"id_token":      idToken,
+	})
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -8,11 +8,35 @@ import (
 
 // MockRepository is a mock implementation of the Repository interface
 type MockRepository struct {
-	GetUserRolesFunc          func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error)
-	GetUserAttributesFunc     func(ctx context.Context, userID string) (*model.UserAttributes, error)
-	GetResourceAttributesFunc func(ctx context.Context, resourceID string) (*model.ResourceAttributes, error)
-	GetUserRelationshipsFunc  func(ctx context.Context, userID string) ([]model.Relationship, error)
-	GetResourceIDByTypeFunc   func(ctx context.Context, resourceType string) (string, error)
+	GetUserRolesFunc                func(ctx context.Context, userID string) ([]string, []model.RBACPermission, error)
+	GetUserAttributesFunc           func(ctx context.Context, userID string) (*model.UserAttributes, error)
+	GetResourceAttributesFunc       func(ctx context.Context, resourceID string) (*model.ResourceAttributes, error)
+	GetUserRelationshipsFunc        func(ctx context.Context, userID string) ([]model.Relationship, error)
+	GetResourceIDByTypeFunc         func(ctx context.Context, resourceType string) (string, error)
+	GetResourcesFunc                func(ctx context.Context) ([]model.Resource, error)
+	GetResourceGranteesFunc         func(ctx context.Context, resourceID string) ([]model.ResourceGrantee, error)
+	GetRolePurposesFunc             func(ctx context.Context, userID string) ([]model.RolePurpose, error)
+	GetPurposeFieldsFunc            func(ctx context.Context) ([]model.PurposeField, error)
+	GetFieldPermissionsFunc         func(ctx context.Context, userID string) ([]model.FieldPermission, error)
+	GetRoleParentsFunc              func(ctx context.Context, userID string) ([]model.RoleParent, error)
+	GetPermissionsForRolesFunc      func(ctx context.Context, roleIDs []string) ([]model.RBACPermission, error)
+	GetFieldPermissionsForRolesFunc func(ctx context.Context, roleIDs []string) ([]model.FieldPermission, error)
+	GetRoleParentsForRolesFunc      func(ctx context.Context, roleIDs []string) ([]model.RoleParent, error)
+	GetRolePurposesForRolesFunc     func(ctx context.Context, roleIDs []string) ([]model.RolePurpose, error)
+	GetAPIKeyByHashFunc             func(ctx context.Context, keyHash string) (*model.APIKey, error)
+	GetUserByEmailFunc              func(ctx context.Context, email string) (*model.User, error)
+	LoadPRPTablesFunc               func(ctx context.Context) (*model.PRPTables, error)
+
+	CreateBreakGlassGrantFunc     func(ctx context.Context, grant *model.BreakGlassGrant) error
+	GetActiveBreakGlassGrantsFunc func(ctx context.Context, userID string) ([]model.BreakGlassGrant, error)
+	RevokeBreakGlassGrantFunc     func(ctx context.Context, grantID, revokedBy string) error
+
+	CreatePolicyVersionFunc    func(ctx context.Context, version *model.PolicyVersion) error
+	GetPolicyVersionFunc       func(ctx context.Context, tenantID string, version int) (*model.PolicyVersion, error)
+	ListPolicyVersionsFunc     func(ctx context.Context, tenantID string) ([]model.PolicyVersion, error)
+	GetActivePolicyVersionFunc func(ctx context.Context, tenantID string) (*model.PolicyVersion, error)
+	ActivatePolicyVersionFunc  func(ctx context.Context, tenantID string, version int, activatedBy string) error
+	GetPolicyActivationsFunc   func(ctx context.Context, tenantID string) ([]model.PolicyActivation, error)
 }
 
 func (m *MockRepository) GetUserRoles(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
@@ -49,3 +73,157 @@ func (m *MockRepository) GetResourceIDByType(ctx context.Context, resourceType s
 	}
 	return "", nil
 }
+
+func (m *MockRepository) GetResources(ctx context.Context) ([]model.Resource, error) {
+	if m.GetResourcesFunc != nil {
+		return m.GetResourcesFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetResourceGrantees(ctx context.Context, resourceID string) ([]model.ResourceGrantee, error) {
+	if m.GetResourceGranteesFunc != nil {
+		return m.GetResourceGranteesFunc(ctx, resourceID)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetRolePurposes(ctx context.Context, userID string) ([]model.RolePurpose, error) {
+	if m.GetRolePurposesFunc != nil {
+		return m.GetRolePurposesFunc(ctx, userID)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetPurposeFields(ctx context.Context) ([]model.PurposeField, error) {
+	if m.GetPurposeFieldsFunc != nil {
+		return m.GetPurposeFieldsFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetFieldPermissions(ctx context.Context, userID string) ([]model.FieldPermission, error) {
+	if m.GetFieldPermissionsFunc != nil {
+		return m.GetFieldPermissionsFunc(ctx, userID)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetRoleParents(ctx context.Context, userID string) ([]model.RoleParent, error) {
+	if m.GetRoleParentsFunc != nil {
+		return m.GetRoleParentsFunc(ctx, userID)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.RBACPermission, error) {
+	if m.GetPermissionsForRolesFunc != nil {
+		return m.GetPermissionsForRolesFunc(ctx, roleIDs)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetFieldPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.FieldPermission, error) {
+	if m.GetFieldPermissionsForRolesFunc != nil {
+		return m.GetFieldPermissionsForRolesFunc(ctx, roleIDs)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetRoleParentsForRoles(ctx context.Context, roleIDs []string) ([]model.RoleParent, error) {
+	if m.GetRoleParentsForRolesFunc != nil {
+		return m.GetRoleParentsForRolesFunc(ctx, roleIDs)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetRolePurposesForRoles(ctx context.Context, roleIDs []string) ([]model.RolePurpose, error) {
+	if m.GetRolePurposesForRolesFunc != nil {
+		return m.GetRolePurposesForRolesFunc(ctx, roleIDs)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	if m.GetAPIKeyByHashFunc != nil {
+		return m.GetAPIKeyByHashFunc(ctx, keyHash)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	if m.GetUserByEmailFunc != nil {
+		return m.GetUserByEmailFunc(ctx, email)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) LoadPRPTables(ctx context.Context) (*model.PRPTables, error) {
+	if m.LoadPRPTablesFunc != nil {
+		return m.LoadPRPTablesFunc(ctx)
+	}
+	return &model.PRPTables{}, nil
+}
+
+func (m *MockRepository) CreateBreakGlassGrant(ctx context.Context, grant *model.BreakGlassGrant) error {
+	if m.CreateBreakGlassGrantFunc != nil {
+		return m.CreateBreakGlassGrantFunc(ctx, grant)
+	}
+	return nil
+}
+
+func (m *MockRepository) GetActiveBreakGlassGrants(ctx context.Context, userID string) ([]model.BreakGlassGrant, error) {
+	if m.GetActiveBreakGlassGrantsFunc != nil {
+		return m.GetActiveBreakGlassGrantsFunc(ctx, userID)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) RevokeBreakGlassGrant(ctx context.Context, grantID, revokedBy string) error {
+	if m.RevokeBreakGlassGrantFunc != nil {
+		return m.RevokeBreakGlassGrantFunc(ctx, grantID, revokedBy)
+	}
+	return nil
+}
+
+func (m *MockRepository) CreatePolicyVersion(ctx context.Context, version *model.PolicyVersion) error {
+	if m.CreatePolicyVersionFunc != nil {
+		return m.CreatePolicyVersionFunc(ctx, version)
+	}
+	return nil
+}
+
+func (m *MockRepository) GetPolicyVersion(ctx context.Context, tenantID string, version int) (*model.PolicyVersion, error) {
+	if m.GetPolicyVersionFunc != nil {
+		return m.GetPolicyVersionFunc(ctx, tenantID, version)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) ListPolicyVersions(ctx context.Context, tenantID string) ([]model.PolicyVersion, error) {
+	if m.ListPolicyVersionsFunc != nil {
+		return m.ListPolicyVersionsFunc(ctx, tenantID)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetActivePolicyVersion(ctx context.Context, tenantID string) (*model.PolicyVersion, error) {
+	if m.GetActivePolicyVersionFunc != nil {
+		return m.GetActivePolicyVersionFunc(ctx, tenantID)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) ActivatePolicyVersion(ctx context.Context, tenantID string, version int, activatedBy string) error {
+	if m.ActivatePolicyVersionFunc != nil {
+		return m.ActivatePolicyVersionFunc(ctx, tenantID, version, activatedBy)
+	}
+	return nil
+}
+
+func (m *MockRepository) GetPolicyActivations(ctx context.Context, tenantID string) ([]model.PolicyActivation, error) {
+	if m.GetPolicyActivationsFunc != nil {
+		return m.GetPolicyActivationsFunc(ctx, tenantID)
+	}
+	return nil, nil
+}
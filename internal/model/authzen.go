@@ -0,0 +1,60 @@
+package model
+
+// AuthZENSubject is the user or service requesting access in the OpenID AuthZEN Authorization API
+type AuthZENSubject struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// AuthZENResource is the resource access is requested to
+type AuthZENResource struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// AuthZENAction is the action requested on the resource
+type AuthZENAction struct {
+	Name       string                 `json:"name"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// AuthZENEvaluationRequest is an Access Evaluation API request
+type AuthZENEvaluationRequest struct {
+	Subject  *AuthZENSubject        `json:"subject,omitempty"`
+	Resource *AuthZENResource       `json:"resource,omitempty"`
+	Action   *AuthZENAction         `json:"action,omitempty"`
+	Context  map[string]interface{} `json:"context,omitempty"`
+}
+
+// AuthZENEvaluationResponse is an Access Evaluation API decision
+type AuthZENEvaluationResponse struct {
+	Decision bool                   `json:"decision"`
+	Context  map[string]interface{} `json:"context,omitempty"`
+}
+
+// AuthZENEvaluationsOptions controls how an Access Evaluations API request is executed
+type AuthZENEvaluationsOptions struct {
+	EvaluationsSemantic string `json:"evaluations_semantic,omitempty"`
+}
+
+// AuthZENEvaluationsRequest is an Access Evaluations API request. The top-level
+// subject, resource, action and context are defaults for each evaluation.
+type AuthZENEvaluationsRequest struct {
+	AuthZENEvaluationRequest
+	Evaluations []AuthZENEvaluationRequest `json:"evaluations,omitempty"`
+	Options     AuthZENEvaluationsOptions  `json:"options,omitempty"`
+}
+
+// AuthZENEvaluationsResponse holds the decisions of an Access Evaluations API request in order
+type AuthZENEvaluationsResponse struct {
+	Evaluations []AuthZENEvaluationResponse `json:"evaluations"`
+}
+
+// AuthZENConfiguration is the PDP metadata published at /.well-known/authzen-configuration
+type AuthZENConfiguration struct {
+	PolicyDecisionPoint       string `json:"policy_decision_point"`
+	AccessEvaluationEndpoint  string `json:"access_evaluation_endpoint"`
+	AccessEvaluationsEndpoint string `json:"access_evaluations_endpoint"`
+}
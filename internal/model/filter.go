@@ -0,0 +1,41 @@
+package model
+
+// RowFilterRequest asks for the rows of a resource a subject may read. Columns maps the
+// record fields the policy may refer to onto the SQL columns they are stored in.
+type RowFilterRequest struct {
+	EvaluationRequest
+	Columns map[string]string `json:"columns"`
+}
+
+// RowFilter is the condition the rows a subject may read satisfy, as a parameterised
+// SQL predicate and as a JSON filter AST
+type RowFilter struct {
+	SQL            string        `json:"sql"`
+	Args           []interface{} `json:"args"`
+	Filter         FilterNode    `json:"filter"`
+	PolicyRevision string        `json:"policy_revision,omitempty"`
+}
+
+// Operators of a FilterNode
+const (
+	FilterTrue  = "true"
+	FilterFalse = "false"
+	FilterAnd   = "and"
+	FilterOr    = "or"
+	FilterNot   = "not"
+	FilterEq    = "eq"
+	FilterNeq   = "neq"
+	FilterLt    = "lt"
+	FilterLte   = "lte"
+	FilterGt    = "gt"
+	FilterGte   = "gte"
+)
+
+// FilterNode is a node of a filter AST. Logical nodes combine Args, comparisons
+// compare the record's Field with Value.
+type FilterNode struct {
+	Op    string       `json:"op"`
+	Field string       `json:"field,omitempty"`
+	Value interface{}  `json:"value,omitempty"`
+	Args  []FilterNode `json:"args,omitempty"`
+}
@@ -1,18 +1,101 @@
 package model
 
+import "time"
+
 type PolicyResponse struct {
-	Allow         bool        `json:"allow"`
-	Message       string      `json:"message,omitempty"`
-	AllowedFields []string    `json:"allowed_fields,omitempty"`
-	FilteredData  interface{} `json:"filtered_data,omitempty"`
+	Allow           bool                `json:"allow"`
+	Message         string              `json:"message,omitempty"`
+	AllowedFields   []string            `json:"allowed_fields,omitempty"`
+	FieldSources    map[string][]string `json:"field_sources,omitempty"`
+	FilteredData    interface{}         `json:"filtered_data,omitempty"`
+	Impersonation   *Impersonation      `json:"impersonation,omitempty"`
+	BreakGlass      *BreakGlassGrant    `json:"break_glass,omitempty"`
+	PolicyRevision  string              `json:"policy_revision,omitempty"`
+	SnapshotVersion uint64              `json:"snapshot_version,omitempty"`
+	Models          map[string]bool     `json:"models,omitempty"`
+	Explanation     *Explanation        `json:"explanation,omitempty"`
+}
+
+// Explanation describes how a decision was reached, for the explain API
+type Explanation struct {
+	Mode          string              `json:"mode"`
+	MatchedRoles  []string            `json:"matched_roles"`
+	CombinedRoles []string            `json:"combined_roles"`
+	Permissions   []RBACPermission    `json:"permissions"`
+	FieldSources  map[string][]string `json:"field_sources"`
+	Trace         []string            `json:"trace"`
+	Combination   *CombinationTrace   `json:"combination,omitempty"`
+}
+
+// CombinationTrace describes how the decisions of the policies of a resource type were combined
+type CombinationTrace struct {
+	Algorithm     string           `json:"algorithm"`
+	Fields        string           `json:"fields,omitempty"`
+	Policies      []PolicyDecision `json:"policies"`
+	Decision      string           `json:"decision"`
+	AllowedFields []string         `json:"allowed_fields,omitempty"`
+}
+
+// PolicyDecision is the decision of one of the combined policies
+type PolicyDecision struct {
+	Policy        string   `json:"policy"`
+	Decision      string   `json:"decision"`
+	AllowedFields []string `json:"allowed_fields,omitempty"`
 }
 
 type EvaluationRequest struct {
-	UserID       string      `json:"user_id"`
-	ResourceType string      `json:"resource_type"`
-	ResourceID   string      `json:"resource_id"`
-	Action       string      `json:"action"`
-	Data         interface{} `json:"data,omitempty"`
+	UserID       string       `json:"user_id"`
+	ResourceType string       `json:"resource_type"`
+	ResourceID   string       `json:"resource_id"`
+	Action       string       `json:"action"`
+	Data         interface{}  `json:"data,omitempty"`
+	ActAs        string       `json:"act_as,omitempty"`
+	Purpose      string       `json:"purpose,omitempty"`
+	SubjectType  string       `json:"subject_type,omitempty"`
+	Environment  *Environment `json:"environment,omitempty"`
+}
+
+// Environment is the context a request was made in, as observed by the PEP
+type Environment struct {
+	ClientIP    string    `json:"client_ip,omitempty"`
+	RequestTime time.Time `json:"request_time"`
+	// Timezone is the server-configured timezone time-of-day rules are evaluated in
+	Timezone string `json:"timezone,omitempty"`
+	// ClientTimezone is the timezone the client declared. It is informational only.
+	ClientTimezone string   `json:"client_timezone,omitempty"`
+	TLS            *TLSInfo `json:"tls,omitempty"`
+}
+
+// TLSInfo describes the TLS connection a request was made over
+type TLSInfo struct {
+	Version           string `json:"version"`
+	CipherSuite       string `json:"cipher_suite"`
+	ServerName        string `json:"server_name,omitempty"`
+	ClientCertificate bool   `json:"client_certificate"`
+}
+
+// BatchEvaluationRequest is a set of evaluations sharing default values.
+// Fields an evaluation leaves empty are taken from Defaults.
+type BatchEvaluationRequest struct {
+	Defaults    EvaluationRequest   `json:"defaults"`
+	Evaluations []EvaluationRequest `json:"evaluations"`
+}
+
+// BatchEvaluationResult is the decision of one evaluation in a batch, or why it could not be made
+type BatchEvaluationResult struct {
+	Decision *PolicyResponse `json:"decision,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// BatchEvaluationResponse holds the results of a batch in the order of its evaluations
+type BatchEvaluationResponse struct {
+	Evaluations []BatchEvaluationResult `json:"evaluations"`
+}
+
+// Impersonation identifies an operator acting as another user
+type Impersonation struct {
+	OperatorID string `json:"operator_id"`
+	TargetID   string `json:"target_id"`
 }
 
 // RBAC specific types
@@ -22,6 +105,34 @@ type RBACPermission struct {
 	Action     string `json:"action"`
 }
 
+// RolePurpose is a purpose of use a role may declare when accessing a resource
+type RolePurpose struct {
+	Role       string `json:"role"`
+	ResourceID string `json:"resource_id"`
+	Purpose    string `json:"purpose"`
+}
+
+// PurposeField is a field a purpose of use may expose for a resource
+type PurposeField struct {
+	Purpose    string `json:"purpose"`
+	ResourceID string `json:"resource_id"`
+	Field      string `json:"field"`
+}
+
+// RoleParent is a role inheriting the permissions and fields of its parent role
+type RoleParent struct {
+	Role       string `json:"role"`
+	ParentRole string `json:"parent_role"`
+}
+
+// FieldPermission is a field of a resource a role may access when performing an action
+type FieldPermission struct {
+	Role       string `json:"role"`
+	ResourceID string `json:"resource_id"`
+	Action     string `json:"action"`
+	Field      string `json:"field"`
+}
+
 type RBACPolicy struct {
 	Permissions []RBACPermission `json:"permissions"`
 }
@@ -33,6 +144,51 @@ type UserAttributes struct {
 	EmploymentTypeID string `json:"employment_type_id"`
 }
 
+// UserPermissions are the effective permissions of a user
+type UserPermissions struct {
+	UserID         string                `json:"user_id"`
+	Resources      []ResourcePermissions `json:"resources"`
+	PolicyRevision string                `json:"policy_revision,omitempty"`
+}
+
+// ResourcePermissions are the actions a user is allowed on a resource and the fields each action exposes
+type ResourcePermissions struct {
+	ResourceType  string              `json:"resource_type"`
+	ResourceID    string              `json:"resource_id"`
+	Actions       []string            `json:"actions"`
+	AllowedFields map[string][]string `json:"allowed_fields"`
+}
+
+// ResourceGrantee is a user holding a permission on a resource through one of their roles,
+// either granted to the role or to a role it inherits from
+type ResourceGrantee struct {
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	Role     string `json:"role"`
+	RoleName string `json:"role_name"`
+	Action   string `json:"action"`
+}
+
+// ResourceAccess is an action a user may perform on a resource, the roles it is granted through
+// and the fields it exposes without a declared purpose and for each purpose the roles are bound to
+type ResourceAccess struct {
+	UserID        string              `json:"user_id"`
+	UserName      string              `json:"user_name"`
+	Action        string              `json:"action"`
+	Roles         []string            `json:"roles"`
+	RoleNames     []string            `json:"role_names"`
+	AllowedFields []string            `json:"allowed_fields"`
+	PurposeFields map[string][]string `json:"purpose_fields,omitempty"`
+}
+
+// ResourceAccessReport lists who may access a resource
+type ResourceAccessReport struct {
+	ResourceType   string           `json:"resource_type"`
+	ResourceID     string           `json:"resource_id"`
+	Access         []ResourceAccess `json:"access"`
+	PolicyRevision string           `json:"policy_revision,omitempty"`
+}
+
 // ResourceAttributes represents attributes associated with a resource
 type ResourceAttributes struct {
 	DepartmentID string `json:"department_id"`
@@ -44,3 +200,42 @@ type Relationship struct {
 	ObjectID  string `json:"object_id"`
 	Type      string `json:"type"`
 }
+
+// BreakGlassRequest is a request for temporary emergency access to a resource
+type BreakGlassRequest struct {
+	UserID          string `json:"user_id"`
+	ResourceType    string `json:"resource_type"`
+	Justification   string `json:"justification"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+}
+
+// BreakGlassGrant is a time-boxed emergency access grant
+type BreakGlassGrant struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"user_id"`
+	ResourceID    string     `json:"resource_id"`
+	ResourceType  string     `json:"resource_type"`
+	Justification string     `json:"justification"`
+	GrantedAt     time.Time  `json:"granted_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy     string     `json:"revoked_by,omitempty"`
+}
+
+// PolicyVersion is an immutable version of a tenant's Rego modules and data
+type PolicyVersion struct {
+	ID        string                 `json:"id"`
+	TenantID  string                 `json:"tenant_id"`
+	Version   int                    `json:"version"`
+	Modules   map[string]string      `json:"modules"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedBy string                 `json:"created_by"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// PolicyActivation records a policy version being made the active one
+type PolicyActivation struct {
+	Version     int       `json:"version"`
+	ActivatedBy string    `json:"activated_by"`
+	ActivatedAt time.Time `json:"activated_at"`
+}
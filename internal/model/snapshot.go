@@ -0,0 +1,102 @@
+package model
+
+import "encoding/json"
+
+// PRPTables are the rows of the PRP tables decisions are evaluated from. Field names follow
+// the columns so that rows in change notifications decode into the same types.
+type PRPTables struct {
+	Resources        []ResourceRow
+	Actions          []ActionRow
+	Roles            []RoleRow
+	UserRoles        []UserRoleRow
+	RolePermissions  []RolePermissionRow
+	RoleParents      []RoleParentRow
+	FieldPermissions []FieldPermissionRow
+	Purposes         []PurposeRow
+	RolePurposes     []RolePurposeRow
+	PurposeFields    []PurposeFieldRow
+}
+
+// ResourceRow is a row of the resources table
+type ResourceRow struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+}
+
+// ActionRow is a row of the actions table
+type ActionRow struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RoleRow is a row of the roles table
+type RoleRow struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+}
+
+// UserRoleRow is a row of the user_roles table
+type UserRoleRow struct {
+	ID       string `json:"id"`
+	UserID   string `json:"user_id"`
+	RoleID   string `json:"role_id"`
+	TenantID string `json:"tenant_id"`
+}
+
+// RolePermissionRow is a row of the role_permissions table
+type RolePermissionRow struct {
+	ID         string `json:"id"`
+	RoleID     string `json:"role_id"`
+	ResourceID string `json:"resource_id"`
+	ActionID   string `json:"action_id"`
+}
+
+// RoleParentRow is a row of the role_parents table
+type RoleParentRow struct {
+	RoleID       string `json:"role_id"`
+	ParentRoleID string `json:"parent_role_id"`
+}
+
+// FieldPermissionRow is a row of the field_permissions table
+type FieldPermissionRow struct {
+	ID         string `json:"id"`
+	RoleID     string `json:"role_id"`
+	ResourceID string `json:"resource_id"`
+	ActionID   string `json:"action_id"`
+	Field      string `json:"field"`
+	Position   int    `json:"position"`
+}
+
+// PurposeRow is a row of the purposes table
+type PurposeRow struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RolePurposeRow is a row of the role_purposes table
+type RolePurposeRow struct {
+	ID         string `json:"id"`
+	RoleID     string `json:"role_id"`
+	ResourceID string `json:"resource_id"`
+	PurposeID  string `json:"purpose_id"`
+}
+
+// PurposeFieldRow is a row of the purpose_fields table
+type PurposeFieldRow struct {
+	ID         string `json:"id"`
+	PurposeID  string `json:"purpose_id"`
+	ResourceID string `json:"resource_id"`
+	Field      string `json:"field"`
+	Position   int    `json:"position"`
+}
+
+// PRPChange is a change to a row of a PRP table as notified by the PRP triggers.
+// Old is null for inserts, New for deletes, and both for truncates.
+type PRPChange struct {
+	Table string          `json:"table"`
+	Op    string          `json:"op"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
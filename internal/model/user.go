@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // User represents a user in the system
 type User struct {
 	ID             string `json:"id"`
@@ -30,3 +32,12 @@ type Attribute struct {
 	Name  string      `json:"name"`
 	Value interface{} `json:"value"`
 }
+
+// APIKey represents a hashed API key issued to a machine client
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	OwnerID   string     `json:"owner_id"`
+	TenantID  string     `json:"tenant_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -3,16 +3,15 @@ package pkg
 import (
 	"context"
 	"fmt"
-	"log"
 	"sync"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // DBManager is a database manager.
 type DBManager struct {
 	mu       sync.RWMutex
-	clients  map[string]*pgx.Conn
+	clients  map[string]*pgxpool.Pool
 	settings map[string]DBConfig
 }
 
@@ -26,16 +25,23 @@ type DBConfig struct {
 	SSLMode  string
 }
 
+// ConnString returns the connection URL of the database.
+func (c DBConfig) ConnString() string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
+		c.User, c.Password, c.Host, c.Port, c.DBName, c.SSLMode)
+}
+
 // NewDBManager creates a new DBManager.
 func NewDBManager(settings map[string]DBConfig) *DBManager {
 	return &DBManager{
-		clients:  make(map[string]*pgx.Conn),
+		clients:  make(map[string]*pgxpool.Pool),
 		settings: settings,
 	}
 }
 
-// GetClient returns a database client.
-func (m *DBManager) GetClient(dbName string) (*pgx.Conn, error) {
+// GetClient returns a database client. The client is a connection pool, so that it can be
+// shared by concurrent requests.
+func (m *DBManager) GetClient(dbName string) (*pgxpool.Pool, error) {
 	m.mu.RLock()
 	client, exists := m.clients[dbName]
 	m.mu.RUnlock()
@@ -57,15 +63,13 @@ func (m *DBManager) GetClient(dbName string) (*pgx.Conn, error) {
 		return nil, fmt.Errorf("database configuration for %s not found", dbName)
 	}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		config.User, config.Password, config.Host, config.Port, config.DBName, config.SSLMode)
-
-	db, err := pgx.Connect(context.Background(), connStr)
+	db, err := pgxpool.New(context.Background(), config.ConnString())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database %s: %w", dbName, err)
 	}
 
 	if err := db.Ping(context.Background()); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database %s: %w", dbName, err)
 	}
 
@@ -78,11 +82,8 @@ func (m *DBManager) CloseAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	ctx := context.Background()
 	for name, client := range m.clients {
-		if err := client.Close(ctx); err != nil {
-			log.Printf("failed to close database %s: %v", name, err)
-		}
+		client.Close()
 		delete(m.clients, name)
 	}
 }
@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// ErrInvalidToken is returned when a JWT is malformed, badly signed, expired or has no expiry.
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTKeyFunc returns the verification key for a token: []byte for HS256, *rsa.PublicKey for RS256.
+type JWTKeyFunc func(alg, kid string) (interface{}, error)
+
+// SignJWT signs the claims as a compact JWS with the given algorithm and key.
+func SignJWT(claims map[string]interface{}, alg, kid string, key interface{}) (string, error) {
+	var method jwt.SigningMethod
+	switch alg {
+	case AlgHS256:
+		if _, ok := key.([]byte); !ok {
+			return "", fmt.Errorf("HS256 requires a []byte key, got %T", key)
+		}
+		method = jwt.SigningMethodHS256
+	case AlgRS256:
+		if _, ok := key.(*rsa.PrivateKey); !ok {
+			return "", fmt.Errorf("RS256 requires an *rsa.PrivateKey, got %T", key)
+		}
+		method = jwt.SigningMethodRS256
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	token := jwt.NewWithClaims(method, jwt.MapClaims(claims))
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(key)
+}
+
+// VerifyJWT verifies the signature and the exp and nbf claims of a compact JWS and returns its claims.
+// Tokens without an exp claim are rejected.
+func VerifyJWT(token string, keyFunc JWTKeyFunc) (map[string]interface{}, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256}),
+		jwt.WithExpirationRequired(),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return keyFunc(t.Method.Alg(), kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// HasAudience reports whether the aud claim, a string or an array of strings, contains audience.
+func HasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadRSAPublicKey reads a PEM encoded RSA public key.
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in %s is not an RSA key", path)
+	}
+
+	return publicKey, nil
+}
+
+// JWK is an RSA public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKSet is a JSON Web Key Set as served by an OpenID provider's jwks_uri.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewRSAJWK encodes an RSA public key as a JWK for RS256 signatures.
+func NewRSAJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: AlgRS256,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// RSAPublicKey decodes the JWK into an RSA public key.
+func (k JWK) RSAPublicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("malformed modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("malformed exponent: %w", err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerifyJWT(t *testing.T) {
+	secret := []byte("test-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	keyFunc := func(alg, kid string) (interface{}, error) {
+		switch {
+		case alg == AlgHS256:
+			return secret, nil
+		case alg == AlgRS256 && kid == "key-1":
+			return &rsaKey.PublicKey, nil
+		}
+		return nil, fmt.Errorf("no key for %s/%s", alg, kid)
+	}
+
+	sign := func(t *testing.T, claims map[string]interface{}, alg, kid string, key interface{}) string {
+		t.Helper()
+		token, err := SignJWT(claims, alg, kid, key)
+		if err != nil {
+			t.Fatalf("SignJWT() error = %v", err)
+		}
+		return token
+	}
+
+	valid := func(extra map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub": "11111111-1111-1111-1111-111111111111",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		return claims
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"x","exp":%d}`, time.Now().Add(time.Hour).Unix()))) + "."
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "Valid_HS256",
+			token: sign(t, valid(nil), AlgHS256, "", secret),
+		},
+		{
+			name:  "Valid_RS256",
+			token: sign(t, valid(nil), AlgRS256, "key-1", rsaKey),
+		},
+		{
+			name:    "Missing_exp",
+			token:   sign(t, map[string]interface{}{"sub": "11111111-1111-1111-1111-111111111111"}, AlgHS256, "", secret),
+			wantErr: true,
+		},
+		{
+			name:    "Expired",
+			token:   sign(t, valid(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}), AlgHS256, "", secret),
+			wantErr: true,
+		},
+		{
+			name:    "Not_yet_valid",
+			token:   sign(t, valid(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()}), AlgHS256, "", secret),
+			wantErr: true,
+		},
+		{
+			name:    "Wrong_secret",
+			token:   sign(t, valid(nil), AlgHS256, "", []byte("other-secret")),
+			wantErr: true,
+		},
+		{
+			name:    "Unknown_key_ID",
+			token:   sign(t, valid(nil), AlgRS256, "key-2", rsaKey),
+			wantErr: true,
+		},
+		{
+			name:    "Unsigned",
+			token:   unsigned,
+			wantErr: true,
+		},
+		{
+			name:    "Malformed",
+			token:   "not-a-token",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := VerifyJWT(tt.token, keyFunc)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("VerifyJWT() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyJWT() error = %v", err)
+			}
+			if claims["sub"] != "11111111-1111-1111-1111-111111111111" {
+				t.Errorf("VerifyJWT() sub = %v, want the signed subject", claims["sub"])
+			}
+		})
+	}
+}
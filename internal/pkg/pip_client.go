@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// PIPClient is a PolicyInformationProvider requesting the PIP's HTTP API.
+type PIPClient struct {
+	baseURL string
+	client  interfaces.HTTPClient
+}
+
+// NewPIPClient creates a PIPClient for the PIP at baseURL whose requests time out after timeout.
+func NewPIPClient(baseURL string, timeout time.Duration) *PIPClient {
+	return &PIPClient{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// GetRoles returns the roles assigned to the user.
+func (c *PIPClient) GetRoles(ctx context.Context, userID string) ([]model.Role, error) {
+	var roles []model.Role
+	if err := c.get(ctx, userID, "roles", &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetAttributes returns the attributes of the user.
+func (c *PIPClient) GetAttributes(ctx context.Context, userID string) (map[string]interface{}, error) {
+	var attributes map[string]interface{}
+	if err := c.get(ctx, userID, "attributes", &attributes); err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
+
+// GetRelationships returns the relationships the user is the subject or object of.
+func (c *PIPClient) GetRelationships(ctx context.Context, userID string) ([]model.Relationship, error) {
+	var relationships []model.Relationship
+	if err := c.get(ctx, userID, "relationships", &relationships); err != nil {
+		return nil, err
+	}
+	return relationships, nil
+}
+
+// get decodes the response of GET /users/{userID}/{endpoint} into v.
+func (c *PIPClient) get(ctx context.Context, userID, endpoint string, v interface{}) error {
+	target := fmt.Sprintf("%s/users/%s/%s", c.baseURL, url.PathEscape(userID), endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create PIP %s request: %w", endpoint, err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request PIP %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("PIP %s request failed with status %d", endpoint, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode PIP %s: %w", endpoint, err)
+	}
+	return nil
+}
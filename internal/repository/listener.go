@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
+)
+
+// PRPChangesChannel is the channel the PRP triggers notify row changes on
+const PRPChangesChannel = "prp_changes"
+
+// ChangeListener receives the row changes the PRP triggers notify on a dedicated connection
+type ChangeListener struct {
+	connString string
+	conn       *pgx.Conn
+}
+
+// NewChangeListener creates a ChangeListener for the database at connString
+func NewChangeListener(connString string) *ChangeListener {
+	return &ChangeListener{connString: connString}
+}
+
+// Listen connects, reconnecting if the connection was lost, and starts listening for changes.
+// Changes committed while not listening are missed.
+func (l *ChangeListener) Listen(ctx context.Context) error {
+	if l.conn != nil && !l.conn.IsClosed() {
+		l.conn.Close(ctx)
+	}
+
+	conn, err := pgx.Connect(ctx, l.connString)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+PRPChangesChannel); err != nil {
+		conn.Close(ctx)
+		return fmt.Errorf("failed to listen on %s: %w", PRPChangesChannel, err)
+	}
+	l.conn = conn
+	return nil
+}
+
+// WaitForChange waits for the next change. It returns the context's error when the context
+// is done first and the connection is still usable.
+func (l *ChangeListener) WaitForChange(ctx context.Context) (*model.PRPChange, error) {
+	if l.conn == nil {
+		return nil, fmt.Errorf("not listening on %s", PRPChangesChannel)
+	}
+
+	notification, err := l.conn.WaitForNotification(ctx)
+	if err != nil {
+		if ctx.Err() != nil && !l.conn.IsClosed() {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	var change model.PRPChange
+	if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+		return nil, fmt.Errorf("invalid change notification: %w", err)
+	}
+	return &change, nil
+}
+
+// Ping checks that the connection is alive
+func (l *ChangeListener) Ping(ctx context.Context) error {
+	if l.conn == nil {
+		return fmt.Errorf("not listening on %s", PRPChangesChannel)
+	}
+	return l.conn.Ping(ctx)
+}
+
+// Close closes the connection
+func (l *ChangeListener) Close(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close(ctx)
+}
@@ -6,22 +6,44 @@ import (
 	"log"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/bmf-san/poc-opa-access-control-system/internal/interfaces"
 	"github.com/bmf-san/poc-opa-access-control-system/internal/model"
 )
 
 type Repository struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewRepository(db *pgx.Conn) interfaces.Repository {
+func NewRepository(db *pgxpool.Pool) interfaces.Repository {
 	return &Repository{db: db}
 }
 
+// effectiveRolesCTE selects the roles of user $1 and every role they inherit from.
+// UNION discards roles already visited, so cycles in role_parents terminate.
+const effectiveRolesCTE = `
+WITH RECURSIVE effective_roles(role_id) AS (
+    SELECT role_id FROM user_roles WHERE user_id = $1
+    UNION
+    SELECT rp.parent_role_id
+    FROM role_parents rp
+    JOIN effective_roles er ON rp.role_id = er.role_id
+)`
+
+// assignedRolesCTE selects the roles in $1 and every role they inherit from, for subjects
+// whose roles are assigned outside the PRP, e.g. by the PIP
+const assignedRolesCTE = `
+WITH RECURSIVE effective_roles(role_id) AS (
+    SELECT id FROM roles WHERE id::text = ANY($1)
+    UNION
+    SELECT rp.parent_role_id
+    FROM role_parents rp
+    JOIN effective_roles er ON rp.role_id = er.role_id
+)`
+
 func (r *Repository) GetUserRoles(ctx context.Context, userID string) ([]string, []model.RBACPermission, error) {
 	var roles []string
-	var permissions []model.RBACPermission
 
 	// Get roles
 	rows, err := r.db.Query(ctx, `
@@ -43,52 +65,77 @@ func (r *Repository) GetUserRoles(ctx context.Context, userID string) ([]string,
 		roles = append(roles, role)
 	}
 
-	// Get permissions
-	rows, err = r.db.Query(ctx, `
+	// Get permissions of the roles and the roles they inherit from
+	permissions, err := r.queryPermissions(ctx, effectiveRolesCTE, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return roles, permissions, nil
+}
+
+// GetPermissionsForRoles returns the permissions of the roles and the roles they inherit from
+func (r *Repository) GetPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.RBACPermission, error) {
+	return r.queryPermissions(ctx, assignedRolesCTE, roleIDs)
+}
+
+// queryPermissions returns the permissions of the effective roles selected by rolesCTE
+func (r *Repository) queryPermissions(ctx context.Context, rolesCTE string, arg interface{}) ([]model.RBACPermission, error) {
+	var permissions []model.RBACPermission
+
+	rows, err := r.db.Query(ctx, rolesCTE+`
 		SELECT r.id, res.id, a.name
 		FROM roles r
 		JOIN role_permissions rp ON r.id = rp.role_id
 		JOIN resources res ON rp.resource_id = res.id
 		JOIN actions a ON rp.action_id = a.id
-		JOIN user_roles ur ON r.id = ur.role_id
-		WHERE ur.user_id = $1
-	`, userID)
+		JOIN effective_roles er ON r.id = er.role_id
+	`, arg)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var perm model.RBACPermission
 		if err := rows.Scan(&perm.Role, &perm.ResourceID, &perm.Action); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		permissions = append(permissions, perm)
 	}
 
-	return roles, permissions, nil
+	return permissions, rows.Err()
 }
 
 func (r *Repository) GetUserAttributes(ctx context.Context, userID string) (*model.UserAttributes, error) {
 	user := &model.UserAttributes{}
 	err := r.db.QueryRow(ctx, `
-		SELECT u.department_id, d.name, u.employment_type_id
+		SELECT
+			COALESCE(MAX(a.value) FILTER (WHERE a.name = 'department_id'), ''),
+			COALESCE(MAX(a.value) FILTER (WHERE a.name = 'department_name'), ''),
+			COALESCE(MAX(a.value) FILTER (WHERE a.name = 'employment_type_id'), '')
 		FROM users u
-		JOIN departments d ON u.department_id = d.id
-		WHERE u.id = $1
+		LEFT JOIN attributes a ON a.user_id = u.id
+		WHERE u.id::text = $1
+		GROUP BY u.id
 	`, userID).Scan(&user.DepartmentID, &user.DepartmentName, &user.EmploymentTypeID)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("user '%s': %w", userID, interfaces.ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
+// GetResourceAttributes returns the attributes of an employee record, which are those of the
+// user it belongs to. A record without a department has an empty DepartmentID.
 func (r *Repository) GetResourceAttributes(ctx context.Context, resourceID string) (*model.ResourceAttributes, error) {
 	resource := &model.ResourceAttributes{}
 	err := r.db.QueryRow(ctx, `
-		SELECT department_id
-		FROM users
-		WHERE id = $1
+		SELECT COALESCE(MAX(value), '')
+		FROM attributes
+		WHERE user_id::text = $1 AND name = 'department_id'
 	`, resourceID).Scan(&resource.DepartmentID)
 	if err != nil {
 		return nil, err
@@ -100,7 +147,7 @@ func (r *Repository) GetUserRelationships(ctx context.Context, userID string) ([
 	var relationships []model.Relationship
 
 	rows, err := r.db.Query(ctx, `
-SELECT subject_id, object_id, relation
+SELECT subject_id, object_id, relationship_type
 FROM relationships
 WHERE subject_id = $1 OR object_id = $1
 `, userID)
@@ -134,7 +181,7 @@ LIMIT 1
 
 	if err == pgx.ErrNoRows {
 		log.Printf("[ERROR] No resource found with type '%s'", resourceType)
-		return "", fmt.Errorf("resource type '%s' not found", resourceType)
+		return "", fmt.Errorf("resource type '%s': %w", resourceType, interfaces.ErrNotFound)
 	}
 	if err != nil {
 		log.Printf("[ERROR] Database error while getting resource ID: %v", err)
@@ -144,3 +191,518 @@ LIMIT 1
 	log.Printf("[DEBUG] Found resource ID '%s' for type '%s'", resourceID, resourceType)
 	return resourceID, nil
 }
+
+// GetResources returns the resource types registered for the tenant, ordered by name
+func (r *Repository) GetResources(ctx context.Context) ([]model.Resource, error) {
+	var resources []model.Resource
+
+	rows, err := r.db.Query(ctx, `
+SELECT id, name
+FROM resources
+WHERE tenant_id = '11111111-1111-1111-1111-111111111111'
+ORDER BY name
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var resource model.Resource
+		if err := rows.Scan(&resource.ID, &resource.Name); err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, rows.Err()
+}
+
+// GetResourceGrantees returns the users whose roles, or roles they inherit from, hold a permission
+// on the resource, with the role each user was assigned
+func (r *Repository) GetResourceGrantees(ctx context.Context, resourceID string) ([]model.ResourceGrantee, error) {
+	var grantees []model.ResourceGrantee
+
+	rows, err := r.db.Query(ctx, `
+WITH RECURSIVE user_effective_roles(user_id, assigned_role_id, role_id) AS (
+    SELECT user_id, role_id, role_id FROM user_roles
+    UNION
+    SELECT uer.user_id, uer.assigned_role_id, rp.parent_role_id
+    FROM role_parents rp
+    JOIN user_effective_roles uer ON rp.role_id = uer.role_id
+)
+SELECT DISTINCT u.id, u.name, r.id, r.name, a.name
+FROM user_effective_roles uer
+JOIN users u ON uer.user_id = u.id
+JOIN roles r ON uer.assigned_role_id = r.id
+JOIN role_permissions rp ON uer.role_id = rp.role_id
+JOIN actions a ON rp.action_id = a.id
+WHERE rp.resource_id = $1
+ORDER BY u.name, a.name, r.name
+`, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var grantee model.ResourceGrantee
+		if err := rows.Scan(&grantee.UserID, &grantee.UserName, &grantee.Role, &grantee.RoleName, &grantee.Action); err != nil {
+			return nil, err
+		}
+		grantees = append(grantees, grantee)
+	}
+
+	return grantees, rows.Err()
+}
+
+func (r *Repository) GetRolePurposes(ctx context.Context, userID string) ([]model.RolePurpose, error) {
+	return r.queryRolePurposes(ctx, effectiveRolesCTE, userID)
+}
+
+// GetRolePurposesForRoles returns the purposes bound to the roles and the roles they inherit from
+func (r *Repository) GetRolePurposesForRoles(ctx context.Context, roleIDs []string) ([]model.RolePurpose, error) {
+	return r.queryRolePurposes(ctx, assignedRolesCTE, roleIDs)
+}
+
+// queryRolePurposes returns the purposes bound to the effective roles selected by rolesCTE
+func (r *Repository) queryRolePurposes(ctx context.Context, rolesCTE string, arg interface{}) ([]model.RolePurpose, error) {
+	var purposes []model.RolePurpose
+
+	rows, err := r.db.Query(ctx, rolesCTE+`
+SELECT rp.role_id, rp.resource_id, p.name
+FROM role_purposes rp
+JOIN purposes p ON rp.purpose_id = p.id
+JOIN effective_roles er ON rp.role_id = er.role_id
+`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var purpose model.RolePurpose
+		if err := rows.Scan(&purpose.Role, &purpose.ResourceID, &purpose.Purpose); err != nil {
+			return nil, err
+		}
+		purposes = append(purposes, purpose)
+	}
+
+	return purposes, rows.Err()
+}
+
+// GetPurposeFields returns the fields each purpose of use may expose, per resource
+func (r *Repository) GetPurposeFields(ctx context.Context) ([]model.PurposeField, error) {
+	var fields []model.PurposeField
+
+	rows, err := r.db.Query(ctx, `
+SELECT p.name, pf.resource_id, pf.field
+FROM purpose_fields pf
+JOIN purposes p ON pf.purpose_id = p.id
+ORDER BY p.name, pf.resource_id, pf.position, pf.field
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var field model.PurposeField
+		if err := rows.Scan(&field.Purpose, &field.ResourceID, &field.Field); err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, rows.Err()
+}
+
+func (r *Repository) GetFieldPermissions(ctx context.Context, userID string) ([]model.FieldPermission, error) {
+	return r.queryFieldPermissions(ctx, effectiveRolesCTE, userID)
+}
+
+// GetFieldPermissionsForRoles returns the field permissions of the roles and the roles they inherit from
+func (r *Repository) GetFieldPermissionsForRoles(ctx context.Context, roleIDs []string) ([]model.FieldPermission, error) {
+	return r.queryFieldPermissions(ctx, assignedRolesCTE, roleIDs)
+}
+
+// queryFieldPermissions returns the field permissions of the effective roles selected by rolesCTE
+func (r *Repository) queryFieldPermissions(ctx context.Context, rolesCTE string, arg interface{}) ([]model.FieldPermission, error) {
+	var permissions []model.FieldPermission
+
+	rows, err := r.db.Query(ctx, rolesCTE+`
+SELECT fp.role_id, fp.resource_id, a.name, fp.field
+FROM field_permissions fp
+JOIN actions a ON fp.action_id = a.id
+JOIN effective_roles er ON fp.role_id = er.role_id
+ORDER BY fp.role_id, fp.resource_id, a.name, fp.position
+`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var permission model.FieldPermission
+		if err := rows.Scan(&permission.Role, &permission.ResourceID, &permission.Action, &permission.Field); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (r *Repository) GetRoleParents(ctx context.Context, userID string) ([]model.RoleParent, error) {
+	return r.queryRoleParents(ctx, effectiveRolesCTE, userID)
+}
+
+// GetRoleParentsForRoles returns the parent roles of the roles and the roles they inherit from
+func (r *Repository) GetRoleParentsForRoles(ctx context.Context, roleIDs []string) ([]model.RoleParent, error) {
+	return r.queryRoleParents(ctx, assignedRolesCTE, roleIDs)
+}
+
+// queryRoleParents returns the parent roles of the effective roles selected by rolesCTE
+func (r *Repository) queryRoleParents(ctx context.Context, rolesCTE string, arg interface{}) ([]model.RoleParent, error) {
+	var parents []model.RoleParent
+
+	rows, err := r.db.Query(ctx, rolesCTE+`
+SELECT rp.role_id, rp.parent_role_id
+FROM role_parents rp
+JOIN effective_roles er ON rp.role_id = er.role_id
+`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var parent model.RoleParent
+		if err := rows.Scan(&parent.Role, &parent.ParentRole); err != nil {
+			return nil, err
+		}
+		parents = append(parents, parent)
+	}
+
+	return parents, rows.Err()
+}
+
+func (r *Repository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	err := r.db.QueryRow(ctx, `
+SELECT id, name, owner_id, tenant_id, expires_at
+FROM api_keys
+WHERE key_hash = $1
+`, keyHash).Scan(&key.ID, &key.Name, &key.OwnerID, &key.TenantID, &key.ExpiresAt)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("api key: %w", interfaces.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	return key, nil
+}
+
+func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	user := &model.User{}
+	err := r.db.QueryRow(ctx, `
+SELECT id, name, email, tenant_id
+FROM users
+WHERE email = $1
+`, email).Scan(&user.ID, &user.Name, &user.Email, &user.Tenant)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("user with email '%s': %w", email, interfaces.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	return user, nil
+}
+
+// LoadPRPTables reads the PRP tables decisions are evaluated from in one consistent snapshot.
+// The transaction runs on a connection of its own from the pool, so that loading from a
+// background goroutine never shares a connection with concurrent decisions.
+func (r *Repository) LoadPRPTables(ctx context.Context) (*model.PRPTables, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tables := &model.PRPTables{}
+	if tables.Resources, err = loadRows(ctx, tx, `SELECT id, tenant_id, name FROM resources`,
+		func(row pgx.CollectableRow, r *model.ResourceRow) error {
+			return row.Scan(&r.ID, &r.TenantID, &r.Name)
+		}); err != nil {
+		return nil, fmt.Errorf("loading resources: %w", err)
+	}
+	if tables.Actions, err = loadRows(ctx, tx, `SELECT id, name FROM actions`,
+		func(row pgx.CollectableRow, a *model.ActionRow) error {
+			return row.Scan(&a.ID, &a.Name)
+		}); err != nil {
+		return nil, fmt.Errorf("loading actions: %w", err)
+	}
+	if tables.Roles, err = loadRows(ctx, tx, `SELECT id, tenant_id, name FROM roles`,
+		func(row pgx.CollectableRow, r *model.RoleRow) error {
+			return row.Scan(&r.ID, &r.TenantID, &r.Name)
+		}); err != nil {
+		return nil, fmt.Errorf("loading roles: %w", err)
+	}
+	if tables.UserRoles, err = loadRows(ctx, tx, `SELECT id, user_id, role_id, tenant_id FROM user_roles`,
+		func(row pgx.CollectableRow, ur *model.UserRoleRow) error {
+			return row.Scan(&ur.ID, &ur.UserID, &ur.RoleID, &ur.TenantID)
+		}); err != nil {
+		return nil, fmt.Errorf("loading user roles: %w", err)
+	}
+	if tables.RolePermissions, err = loadRows(ctx, tx, `SELECT id, role_id, resource_id, action_id FROM role_permissions`,
+		func(row pgx.CollectableRow, rp *model.RolePermissionRow) error {
+			return row.Scan(&rp.ID, &rp.RoleID, &rp.ResourceID, &rp.ActionID)
+		}); err != nil {
+		return nil, fmt.Errorf("loading role permissions: %w", err)
+	}
+	if tables.RoleParents, err = loadRows(ctx, tx, `SELECT role_id, parent_role_id FROM role_parents`,
+		func(row pgx.CollectableRow, rp *model.RoleParentRow) error {
+			return row.Scan(&rp.RoleID, &rp.ParentRoleID)
+		}); err != nil {
+		return nil, fmt.Errorf("loading role parents: %w", err)
+	}
+	if tables.FieldPermissions, err = loadRows(ctx, tx, `SELECT id, role_id, resource_id, action_id, field, position FROM field_permissions`,
+		func(row pgx.CollectableRow, fp *model.FieldPermissionRow) error {
+			return row.Scan(&fp.ID, &fp.RoleID, &fp.ResourceID, &fp.ActionID, &fp.Field, &fp.Position)
+		}); err != nil {
+		return nil, fmt.Errorf("loading field permissions: %w", err)
+	}
+	if tables.Purposes, err = loadRows(ctx, tx, `SELECT id, name FROM purposes`,
+		func(row pgx.CollectableRow, p *model.PurposeRow) error {
+			return row.Scan(&p.ID, &p.Name)
+		}); err != nil {
+		return nil, fmt.Errorf("loading purposes: %w", err)
+	}
+	if tables.RolePurposes, err = loadRows(ctx, tx, `SELECT id, role_id, resource_id, purpose_id FROM role_purposes`,
+		func(row pgx.CollectableRow, rp *model.RolePurposeRow) error {
+			return row.Scan(&rp.ID, &rp.RoleID, &rp.ResourceID, &rp.PurposeID)
+		}); err != nil {
+		return nil, fmt.Errorf("loading role purposes: %w", err)
+	}
+	if tables.PurposeFields, err = loadRows(ctx, tx, `SELECT id, purpose_id, resource_id, field, position FROM purpose_fields`,
+		func(row pgx.CollectableRow, pf *model.PurposeFieldRow) error {
+			return row.Scan(&pf.ID, &pf.PurposeID, &pf.ResourceID, &pf.Field, &pf.Position)
+		}); err != nil {
+		return nil, fmt.Errorf("loading purpose fields: %w", err)
+	}
+
+	return tables, tx.Commit(ctx)
+}
+
+// loadRows reads every row of the query with scan
+func loadRows[T any](ctx context.Context, tx pgx.Tx, query string, scan func(pgx.CollectableRow, *T) error) ([]T, error) {
+	rows, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (T, error) {
+		var value T
+		err := scan(row, &value)
+		return value, err
+	})
+}
+
+func (r *Repository) CreateBreakGlassGrant(ctx context.Context, grant *model.BreakGlassGrant) error {
+	err := r.db.QueryRow(ctx, `
+INSERT INTO break_glass_grants (user_id, tenant_id, resource_id, justification, expires_at)
+SELECT u.id, u.tenant_id, $2, $3, $4
+FROM users u
+WHERE u.id = $1
+RETURNING id, granted_at
+`, grant.UserID, grant.ResourceID, grant.Justification, grant.ExpiresAt).Scan(&grant.ID, &grant.GrantedAt)
+
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("user '%s': %w", grant.UserID, interfaces.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	log.Printf("[DEBUG] Created break-glass grant '%s' for user '%s'", grant.ID, grant.UserID)
+	return nil
+}
+
+func (r *Repository) GetActiveBreakGlassGrants(ctx context.Context, userID string) ([]model.BreakGlassGrant, error) {
+	var grants []model.BreakGlassGrant
+
+	rows, err := r.db.Query(ctx, `
+SELECT g.id, g.user_id, g.resource_id, res.name, g.justification, g.granted_at, g.expires_at
+FROM break_glass_grants g
+JOIN resources res ON g.resource_id = res.id
+WHERE g.user_id = $1
+  AND g.revoked_at IS NULL
+  AND g.expires_at > CURRENT_TIMESTAMP
+`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var grant model.BreakGlassGrant
+		if err := rows.Scan(&grant.ID, &grant.UserID, &grant.ResourceID, &grant.ResourceType,
+			&grant.Justification, &grant.GrantedAt, &grant.ExpiresAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
+func (r *Repository) RevokeBreakGlassGrant(ctx context.Context, grantID, revokedBy string) error {
+	tag, err := r.db.Exec(ctx, `
+UPDATE break_glass_grants
+SET revoked_at = CURRENT_TIMESTAMP, revoked_by = $2
+WHERE id = $1
+  AND revoked_at IS NULL
+`, grantID, revokedBy)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("active break-glass grant '%s': %w", grantID, interfaces.ErrNotFound)
+	}
+
+	log.Printf("[DEBUG] Revoked break-glass grant '%s' by '%s'", grantID, revokedBy)
+	return nil
+}
+
+func (r *Repository) CreatePolicyVersion(ctx context.Context, version *model.PolicyVersion) error {
+	if version.Data == nil {
+		version.Data = map[string]interface{}{}
+	}
+
+	err := r.db.QueryRow(ctx, `
+INSERT INTO policy_versions (tenant_id, version, modules, data, created_by)
+SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4
+FROM policy_versions
+WHERE tenant_id = $1
+RETURNING id, version, created_at
+`, version.TenantID, version.Modules, version.Data, version.CreatedBy).Scan(&version.ID, &version.Version, &version.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	log.Printf("[DEBUG] Created policy version %d for tenant '%s'", version.Version, version.TenantID)
+	return nil
+}
+
+func (r *Repository) GetPolicyVersion(ctx context.Context, tenantID string, version int) (*model.PolicyVersion, error) {
+	v := &model.PolicyVersion{}
+	err := r.db.QueryRow(ctx, `
+SELECT id, tenant_id, version, modules, data, COALESCE(created_by::text, ''), created_at
+FROM policy_versions
+WHERE tenant_id = $1
+  AND version = $2
+`, tenantID, version).Scan(&v.ID, &v.TenantID, &v.Version, &v.Modules, &v.Data, &v.CreatedBy, &v.CreatedAt)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("policy version %d: %w", version, interfaces.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	return v, nil
+}
+
+func (r *Repository) ListPolicyVersions(ctx context.Context, tenantID string) ([]model.PolicyVersion, error) {
+	var versions []model.PolicyVersion
+
+	rows, err := r.db.Query(ctx, `
+SELECT id, tenant_id, version, modules, data, COALESCE(created_by::text, ''), created_at
+FROM policy_versions
+WHERE tenant_id = $1
+ORDER BY version DESC
+`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v model.PolicyVersion
+		if err := rows.Scan(&v.ID, &v.TenantID, &v.Version, &v.Modules, &v.Data, &v.CreatedBy, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+func (r *Repository) GetActivePolicyVersion(ctx context.Context, tenantID string) (*model.PolicyVersion, error) {
+	v := &model.PolicyVersion{}
+	err := r.db.QueryRow(ctx, `
+SELECT pv.id, pv.tenant_id, pv.version, pv.modules, pv.data, COALESCE(pv.created_by::text, ''), pv.created_at
+FROM policy_activations pa
+JOIN policy_versions pv ON pa.policy_version_id = pv.id
+WHERE pa.tenant_id = $1
+ORDER BY pa.id DESC
+LIMIT 1
+`, tenantID).Scan(&v.ID, &v.TenantID, &v.Version, &v.Modules, &v.Data, &v.CreatedBy, &v.CreatedAt)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("active policy version: %w", interfaces.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	return v, nil
+}
+
+func (r *Repository) ActivatePolicyVersion(ctx context.Context, tenantID string, version int, activatedBy string) error {
+	tag, err := r.db.Exec(ctx, `
+INSERT INTO policy_activations (tenant_id, policy_version_id, activated_by)
+SELECT tenant_id, id, $3
+FROM policy_versions
+WHERE tenant_id = $1
+  AND version = $2
+`, tenantID, version, activatedBy)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("policy version %d: %w", version, interfaces.ErrNotFound)
+	}
+
+	log.Printf("[DEBUG] Activated policy version %d for tenant '%s' by '%s'", version, tenantID, activatedBy)
+	return nil
+}
+
+func (r *Repository) GetPolicyActivations(ctx context.Context, tenantID string) ([]model.PolicyActivation, error) {
+	var activations []model.PolicyActivation
+
+	rows, err := r.db.Query(ctx, `
+SELECT pv.version, COALESCE(pa.activated_by::text, ''), pa.activated_at
+FROM policy_activations pa
+JOIN policy_versions pv ON pa.policy_version_id = pv.id
+WHERE pa.tenant_id = $1
+ORDER BY pa.id DESC
+`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var activation model.PolicyActivation
+		if err := rows.Scan(&activation.Version, &activation.ActivatedBy, &activation.ActivatedAt); err != nil {
+			return nil, err
+		}
+		activations = append(activations, activation)
+	}
+
+	return activations, rows.Err()
+}
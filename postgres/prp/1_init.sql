@@ -23,6 +23,7 @@ CREATE TABLE roles (
     id UUID PRIMARY KEY,
     tenant_id UUID NOT NULL,
     name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
@@ -38,6 +39,25 @@ CREATE TABLE users (
     FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
 );
 
+-- Attributes of users served by the PIP
+CREATE TABLE attributes (
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL, -- ex. "location", "clearance"
+    value TEXT NOT NULL,
+    PRIMARY KEY (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Relationships between users served by the PIP
+CREATE TABLE relationships (
+    subject_id UUID NOT NULL,
+    object_id UUID NOT NULL,
+    relationship_type TEXT NOT NULL, -- ex. "manages", "delegates_to"
+    PRIMARY KEY (subject_id, object_id, relationship_type),
+    FOREIGN KEY (subject_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (object_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 CREATE TABLE role_permissions (
     id UUID PRIMARY KEY,
     role_id UUID NOT NULL,
@@ -56,3 +76,179 @@ CREATE TABLE user_roles (
     FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
     FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
 );
+
+CREATE TABLE break_glass_grants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    tenant_id UUID NOT NULL,
+    resource_id UUID NOT NULL,
+    justification TEXT NOT NULL,
+    granted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    revoked_by UUID,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE,
+    FOREIGN KEY (revoked_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_break_glass_grants_active ON break_glass_grants (user_id, expires_at) WHERE revoked_at IS NULL;
+
+CREATE TABLE purposes (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE -- "payroll", "performance_review", "support"
+);
+
+CREATE TABLE role_purposes (
+    id UUID PRIMARY KEY,
+    role_id UUID NOT NULL,
+    resource_id UUID NOT NULL,
+    purpose_id UUID NOT NULL,
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE,
+    FOREIGN KEY (purpose_id) REFERENCES purposes(id) ON DELETE CASCADE,
+    UNIQUE (role_id, resource_id, purpose_id)
+);
+
+-- Fields a purpose of use may expose for a resource
+CREATE TABLE purpose_fields (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    purpose_id UUID NOT NULL,
+    resource_id UUID NOT NULL,
+    field TEXT NOT NULL, -- ex. "email", "department_name"
+    position INTEGER NOT NULL DEFAULT 0, -- order of the field in decisions
+    UNIQUE (purpose_id, resource_id, field),
+    FOREIGN KEY (purpose_id) REFERENCES purposes(id) ON DELETE CASCADE,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE
+);
+
+-- A role inherits the permissions and fields of its parent roles
+CREATE TABLE role_parents (
+    role_id UUID NOT NULL,
+    parent_role_id UUID NOT NULL,
+    PRIMARY KEY (role_id, parent_role_id),
+    CHECK (role_id <> parent_role_id),
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+
+CREATE TABLE field_permissions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    role_id UUID NOT NULL,
+    resource_id UUID NOT NULL,
+    action_id UUID NOT NULL,
+    field TEXT NOT NULL, -- ex. "email", "department_name"
+    position INTEGER NOT NULL DEFAULT 0, -- order of the field in decisions
+    UNIQUE (role_id, resource_id, action_id, field),
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE,
+    FOREIGN KEY (action_id) REFERENCES actions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE, -- hex encoded SHA-256 of the key
+    owner_id UUID NOT NULL,
+    tenant_id UUID NOT NULL,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
+);
+
+CREATE TABLE policy_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL,
+    version INTEGER NOT NULL,
+    modules JSONB NOT NULL, -- Rego sources keyed by file name
+    data JSONB NOT NULL DEFAULT '{}',
+    created_by UUID,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, version),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Policy versions are immutable once uploaded
+CREATE FUNCTION reject_policy_version_update() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'policy versions are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER policy_versions_immutable
+    BEFORE UPDATE ON policy_versions
+    FOR EACH ROW EXECUTE FUNCTION reject_policy_version_update();
+
+-- The latest activation of a tenant is its active policy version
+CREATE TABLE policy_activations (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id UUID NOT NULL,
+    policy_version_id UUID NOT NULL,
+    activated_by UUID,
+    activated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE,
+    FOREIGN KEY (policy_version_id) REFERENCES policy_versions(id) ON DELETE CASCADE,
+    FOREIGN KEY (activated_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_policy_activations_tenant ON policy_activations (tenant_id, id DESC);
+
+-- Notify the PDPs of changes to the tables decisions are evaluated from, so that
+-- their in-memory snapshots can be updated without reloading
+CREATE FUNCTION notify_prp_change() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('prp_changes', json_build_object(
+        'table', TG_TABLE_NAME,
+        'op', TG_OP,
+        'old', CASE WHEN TG_OP IN ('UPDATE', 'DELETE') THEN row_to_json(OLD) END,
+        'new', CASE WHEN TG_OP IN ('INSERT', 'UPDATE') THEN row_to_json(NEW) END
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER resources_notify AFTER INSERT OR UPDATE OR DELETE ON resources
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER actions_notify AFTER INSERT OR UPDATE OR DELETE ON actions
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER roles_notify AFTER INSERT OR UPDATE OR DELETE ON roles
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER user_roles_notify AFTER INSERT OR UPDATE OR DELETE ON user_roles
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER role_permissions_notify AFTER INSERT OR UPDATE OR DELETE ON role_permissions
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER role_parents_notify AFTER INSERT OR UPDATE OR DELETE ON role_parents
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER field_permissions_notify AFTER INSERT OR UPDATE OR DELETE ON field_permissions
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER purposes_notify AFTER INSERT OR UPDATE OR DELETE ON purposes
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER role_purposes_notify AFTER INSERT OR UPDATE OR DELETE ON role_purposes
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER purpose_fields_notify AFTER INSERT OR UPDATE OR DELETE ON purpose_fields
+    FOR EACH ROW EXECUTE FUNCTION notify_prp_change();
+
+-- A truncate is notified once per table without rows
+CREATE TRIGGER resources_notify_truncate AFTER TRUNCATE ON resources
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER actions_notify_truncate AFTER TRUNCATE ON actions
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER roles_notify_truncate AFTER TRUNCATE ON roles
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER user_roles_notify_truncate AFTER TRUNCATE ON user_roles
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER role_permissions_notify_truncate AFTER TRUNCATE ON role_permissions
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER role_parents_notify_truncate AFTER TRUNCATE ON role_parents
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER field_permissions_notify_truncate AFTER TRUNCATE ON field_permissions
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER purposes_notify_truncate AFTER TRUNCATE ON purposes
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER role_purposes_notify_truncate AFTER TRUNCATE ON role_purposes
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
+CREATE TRIGGER purpose_fields_notify_truncate AFTER TRUNCATE ON purpose_fields
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_prp_change();
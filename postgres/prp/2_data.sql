@@ -5,12 +5,17 @@ INSERT INTO tenants (id, name, created_at, updated_at) VALUES
 -- Resources
 INSERT INTO resources (id, tenant_id, name, created_at, updated_at) VALUES
 ('11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', 'employees', NOW(), NOW()),
-('22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', 'departments', NOW(), NOW());
+('22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', 'departments', NOW(), NOW()),
+('33333333-3333-3333-3333-333333333333', '11111111-1111-1111-1111-111111111111', 'users', NOW(), NOW()),
+('44444444-4444-4444-4444-444444444444', '11111111-1111-1111-1111-111111111111', 'admin', NOW(), NOW());
 
 -- Actions
 INSERT INTO actions (id, name) VALUES
 ('11111111-1111-1111-1111-111111111111', 'view'),
-('22222222-2222-2222-2222-222222222222', 'edit');
+('22222222-2222-2222-2222-222222222222', 'edit'),
+('33333333-3333-3333-3333-333333333333', 'impersonate'),
+('44444444-4444-4444-4444-444444444444', 'break_glass'),
+('55555555-5555-5555-5555-555555555555', 'manage');
 
 -- Users
 INSERT INTO users (id, tenant_id, name, email, created_at, updated_at) VALUES
@@ -23,28 +28,121 @@ INSERT INTO users (id, tenant_id, name, email, created_at, updated_at) VALUES
 ('77777777-7777-7777-7777-777777777777', '11111111-1111-1111-1111-111111111111', 'Alice HR', 'alice@example.com', NOW(), NOW()),
 
 -- Sales
-('66666666-6666-6666-6666-666666666666', '11111111-1111-1111-1111-111111111111', 'Sarah Sales', 'sarah@example.com', NOW(), NOW());
+('66666666-6666-6666-6666-666666666666', '11111111-1111-1111-1111-111111111111', 'Sarah Sales', 'sarah@example.com', NOW(), NOW()),
+
+-- Support
+('88888888-8888-8888-8888-888888888888', '11111111-1111-1111-1111-111111111111', 'Sam Support', 'sam@example.com', NOW(), NOW()),
+
+-- Administration
+('99999999-9999-9999-9999-999999999999', '11111111-1111-1111-1111-111111111111', 'Ada Admin', 'ada@example.com', NOW(), NOW()),
+
+-- Service accounts
+('aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa', '11111111-1111-1111-1111-111111111111', 'Payroll Batch', 'payroll-batch@example.com', NOW(), NOW());
 
 -- Roles
 INSERT INTO roles (id, tenant_id, name, created_at, updated_at) VALUES
 ('11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', 'manager', NOW(), NOW()),
-('22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', 'employee', NOW(), NOW());
+('22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', 'employee', NOW(), NOW()),
+('33333333-3333-3333-3333-333333333333', '11111111-1111-1111-1111-111111111111', 'support', NOW(), NOW()),
+('44444444-4444-4444-4444-444444444444', '11111111-1111-1111-1111-111111111111', 'admin', NOW(), NOW());
 
 -- Role Permissions
 -- Manager permissions
 INSERT INTO role_permissions (id, role_id, resource_id, action_id) VALUES
 ('11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111'), -- managers can view employees
 ('22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '22222222-2222-2222-2222-222222222222'), -- managers can edit employees
-('33333333-3333-3333-3333-333333333333', '11111111-1111-1111-1111-111111111111', '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111'); -- managers can view departments
+('33333333-3333-3333-3333-333333333333', '11111111-1111-1111-1111-111111111111', '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111'), -- managers can view departments
+('66666666-6666-6666-6666-666666666666', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '44444444-4444-4444-4444-444444444444'); -- managers can break glass on employees
 
 -- Employee permissions
 INSERT INTO role_permissions (id, role_id, resource_id, action_id) VALUES
 ('44444444-4444-4444-4444-444444444444', '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111'); -- employees can view employees
 
+-- Support permissions
+INSERT INTO role_permissions (id, role_id, resource_id, action_id) VALUES
+('55555555-5555-5555-5555-555555555555', '33333333-3333-3333-3333-333333333333', '33333333-3333-3333-3333-333333333333', '33333333-3333-3333-3333-333333333333'); -- support can impersonate users
+
+-- Admin permissions
+INSERT INTO role_permissions (id, role_id, resource_id, action_id) VALUES
+('77777777-7777-7777-7777-777777777777', '44444444-4444-4444-4444-444444444444', '44444444-4444-4444-4444-444444444444', '55555555-5555-5555-5555-555555555555'); -- admins can manage the PDP
+
 -- User Roles
 INSERT INTO user_roles (id, user_id, role_id, tenant_id) VALUES
 ('11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111'), -- John is manager
 ('22222222-2222-2222-2222-222222222222', '55555555-5555-5555-5555-555555555555', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111'), -- Jane is manager
 ('33333333-3333-3333-3333-333333333333', '66666666-6666-6666-6666-666666666666', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111'), -- Sarah is manager
 ('44444444-4444-4444-4444-444444444444', '44444444-4444-4444-4444-444444444444', '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111'), -- Bob is employee
-('55555555-5555-5555-5555-555555555555', '77777777-7777-7777-7777-777777777777', '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111'); -- Alice is employee
+('55555555-5555-5555-5555-555555555555', '77777777-7777-7777-7777-777777777777', '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111'), -- Alice is employee
+('66666666-6666-6666-6666-666666666666', '88888888-8888-8888-8888-888888888888', '33333333-3333-3333-3333-333333333333', '11111111-1111-1111-1111-111111111111'), -- Sam is support
+('77777777-7777-7777-7777-777777777777', '99999999-9999-9999-9999-999999999999', '44444444-4444-4444-4444-444444444444', '11111111-1111-1111-1111-111111111111'), -- Ada is admin
+('88888888-8888-8888-8888-888888888888', 'aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa', '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111'); -- Payroll Batch is employee
+
+-- Purposes
+INSERT INTO purposes (id, name) VALUES
+('11111111-1111-1111-1111-111111111111', 'payroll'),
+('22222222-2222-2222-2222-222222222222', 'performance_review'),
+('33333333-3333-3333-3333-333333333333', 'support');
+
+-- Role Purposes
+INSERT INTO role_purposes (id, role_id, resource_id, purpose_id) VALUES
+('11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111'), -- managers may access employees for payroll
+('22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', '22222222-2222-2222-2222-222222222222'); -- managers may access employees for performance reviews
+-- Employees are not bound to a purpose, so they keep their fields without declaring one
+
+-- Purpose Fields
+INSERT INTO purpose_fields (purpose_id, resource_id, field, position)
+SELECT '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', field, position -- payroll may expose employment details
+FROM unnest(ARRAY['id', 'name', 'email', 'employment_type_id', 'employment_type', 'joined_at']) WITH ORDINALITY AS f(field, position);
+
+INSERT INTO purpose_fields (purpose_id, resource_id, field, position)
+SELECT '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', field, position -- performance reviews may expose the position in the organization
+FROM unnest(ARRAY['id', 'name', 'department_id', 'department_name', 'position', 'joined_at']) WITH ORDINALITY AS f(field, position);
+
+INSERT INTO purpose_fields (purpose_id, resource_id, field, position)
+SELECT '33333333-3333-3333-3333-333333333333', '11111111-1111-1111-1111-111111111111', field, position -- support may expose contact details
+FROM unnest(ARRAY['id', 'name', 'email', 'department_name']) WITH ORDINALITY AS f(field, position);
+
+-- Role Parents
+INSERT INTO role_parents (role_id, parent_role_id) VALUES
+('11111111-1111-1111-1111-111111111111', '22222222-2222-2222-2222-222222222222'); -- managers inherit the employee role
+
+-- Field Permissions
+INSERT INTO field_permissions (role_id, resource_id, action_id, field, position)
+SELECT '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', action_id, field, position -- managers can view, edit and break glass on all employee fields
+FROM unnest(ARRAY['id', 'name', 'email', 'department_id', 'department_name', 'employment_type_id', 'employment_type', 'position', 'joined_at']) WITH ORDINALITY AS f(field, position)
+CROSS JOIN unnest(ARRAY['11111111-1111-1111-1111-111111111111', '22222222-2222-2222-2222-222222222222', '44444444-4444-4444-4444-444444444444']::UUID[]) AS a(action_id);
+
+INSERT INTO field_permissions (role_id, resource_id, action_id, field, position)
+SELECT '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', field, position -- employees can view basic employee fields
+FROM unnest(ARRAY['id', 'name', 'department_name', 'employment_type']) WITH ORDINALITY AS f(field, position);
+
+INSERT INTO field_permissions (role_id, resource_id, action_id, field, position)
+SELECT '11111111-1111-1111-1111-111111111111', '22222222-2222-2222-2222-222222222222', '11111111-1111-1111-1111-111111111111', field, position -- managers can view departments
+FROM unnest(ARRAY['id', 'name', 'description']) WITH ORDINALITY AS f(field, position);
+
+-- User Attributes (the department of an employee record is that of its user)
+INSERT INTO attributes (user_id, name, value) VALUES
+('11111111-1111-1111-1111-111111111111', 'department_id', '11111111-1111-1111-1111-111111111111'),
+('11111111-1111-1111-1111-111111111111', 'department_name', 'Engineering'),
+('11111111-1111-1111-1111-111111111111', 'employment_type_id', '11111111-1111-1111-1111-111111111111'),
+('44444444-4444-4444-4444-444444444444', 'department_id', '11111111-1111-1111-1111-111111111111'),
+('44444444-4444-4444-4444-444444444444', 'department_name', 'Engineering'),
+('44444444-4444-4444-4444-444444444444', 'employment_type_id', '11111111-1111-1111-1111-111111111111'),
+('55555555-5555-5555-5555-555555555555', 'department_id', '22222222-2222-2222-2222-222222222222'),
+('55555555-5555-5555-5555-555555555555', 'department_name', 'HR'),
+('55555555-5555-5555-5555-555555555555', 'employment_type_id', '11111111-1111-1111-1111-111111111111'),
+('77777777-7777-7777-7777-777777777777', 'department_id', '22222222-2222-2222-2222-222222222222'),
+('77777777-7777-7777-7777-777777777777', 'department_name', 'HR'),
+('77777777-7777-7777-7777-777777777777', 'employment_type_id', '11111111-1111-1111-1111-111111111111'),
+('66666666-6666-6666-6666-666666666666', 'department_id', '33333333-3333-3333-3333-333333333333'),
+('66666666-6666-6666-6666-666666666666', 'department_name', 'Sales'),
+('66666666-6666-6666-6666-666666666666', 'employment_type_id', '11111111-1111-1111-1111-111111111111');
+
+-- Relationships
+INSERT INTO relationships (subject_id, object_id, relationship_type) VALUES
+('11111111-1111-1111-1111-111111111111', '44444444-4444-4444-4444-444444444444', 'manages'), -- John manages Bob
+('55555555-5555-5555-5555-555555555555', '77777777-7777-7777-7777-777777777777', 'manages'); -- Jane manages Alice
+
+-- API Keys
+INSERT INTO api_keys (id, name, key_hash, owner_id, tenant_id, expires_at) VALUES
+('11111111-1111-1111-1111-111111111111', 'payroll-batch', 'eae05cfd4e16b9f927a899b5c6e2f54e5f984ad5f83c931d839bececb95669cd', 'aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa', '11111111-1111-1111-1111-111111111111', NULL); -- key: demo-payroll-batch-key